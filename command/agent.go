@@ -26,6 +26,7 @@ import (
 	"github.com/hashicorp/go-secure-stdlib/reloadutil"
 	"github.com/hashicorp/vault/api"
 	agentConfig "github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/command/agent/exec"
 	"github.com/hashicorp/vault/command/agent/template"
 	"github.com/hashicorp/vault/command/agentproxyshared"
 	"github.com/hashicorp/vault/command/agentproxyshared/auth"
@@ -511,6 +512,8 @@ func (c *AgentCommand) Run(args []string) int {
 		}
 	}
 
+	es := c.newExecServer(config, templateNamespace)
+
 	var listeners []net.Listener
 
 	// If there are templates, add an in-process listener
@@ -588,6 +591,9 @@ func (c *AgentCommand) Run(args []string) int {
 		if "metrics_only" != lnConfig.Role {
 			mux.Handle(consts.AgentPathCacheClear, leaseCache.HandleCacheClear(ctx))
 			mux.Handle(consts.AgentPathQuit, c.handleQuit(quitEnabled))
+			if es != nil {
+				mux.Handle(consts.AgentPathExecStatus, es.HandleStatus())
+			}
 			mux.Handle("/", muxHandler)
 		}
 
@@ -642,6 +648,13 @@ func (c *AgentCommand) Run(args []string) int {
 				if err != nil {
 					c.outputErrors(err)
 				}
+				// Forward the configured signal to the exec child process, whose
+				// own configuration isn't reloaded with the Agent's
+				if es != nil && config.Exec.ReloadSignal != nil {
+					if err := es.Signal(config.Exec.ReloadSignal); err != nil {
+						c.logger.Error("failed to forward signal to exec child process", "signal", config.Exec.ReloadSignal, "error", err)
+					}
+				}
 				// Send the 'reloaded' message on the relevant channel
 				select {
 				case c.reloadedCh <- struct{}{}:
@@ -677,7 +690,7 @@ func (c *AgentCommand) Run(args []string) int {
 
 	// Start auto-auth and sink servers
 	if method != nil {
-		enableTokenCh := len(config.Templates) > 0
+		enableTokenCh := templateTokenChEnabled(config)
 
 		// Auth Handler is going to set its own retry values, so we want to
 		// work on a copy of the client to not affect other subsystems.
@@ -778,6 +791,17 @@ func (c *AgentCommand) Run(args []string) int {
 			ts.Stop()
 		})
 
+		// The exec server receives the same auto-auth tokens as the template
+		// server, the two of them don't run together as env_template and
+		// template blocks are mutually exclusive
+		if es != nil {
+			g.Add(func() error {
+				return es.Run(ctx, ah.TemplateTokenCh)
+			}, func(error) {
+				cancelFunc()
+			})
+		}
+
 	}
 
 	// Server configuration output
@@ -822,6 +846,30 @@ func (c *AgentCommand) Run(args []string) int {
 	return exitCode
 }
 
+// newExecServer returns the exec server that renders the env templates as
+// environment variables for the child process it supervises, or nil if the
+// config has no exec and env_template blocks. Like the template server, it's
+// run with the auto-auth tokens, and its status is served on the listeners.
+func (c *AgentCommand) newExecServer(config *agentConfig.Config, namespace string) *exec.Server {
+	if config.Exec == nil || len(config.EnvTemplates) == 0 {
+		return nil
+	}
+	return exec.NewServer(&exec.ServerConfig{
+		Logger:      c.logger.Named("exec.server"),
+		LogLevel:    c.logger.GetLevel(),
+		LogWriter:   c.logWriter,
+		AgentConfig: config,
+		Namespace:   namespace,
+	})
+}
+
+// templateTokenChEnabled reports whether the auth handler should send its
+// tokens on the template token channel, which is read by the template server
+// or, for env templates, by the exec server
+func templateTokenChEnabled(config *agentConfig.Config) bool {
+	return len(config.Templates) > 0 || (config.Exec != nil && len(config.EnvTemplates) > 0)
+}
+
 // applyConfigOverrides ensures that the config object accurately reflects the desired
 // settings as configured by the user. It applies the relevant config setting based
 // on the precedence (env var overrides file config, cli overrides env var).
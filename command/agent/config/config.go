@@ -5,12 +5,16 @@ package config
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -51,6 +55,10 @@ type Config struct {
 	DisableKeepAlivesAutoAuth   bool                       `hcl:"-"`
 	Exec                        *ExecConfig                `hcl:"exec,optional"`
 	EnvTemplates                []*ctconfig.TemplateConfig `hcl:"env_template,optional"`
+
+	// EnvTemplateTransforms maps an env_template's environment variable name
+	// to the name of the transform applied to its rendered contents
+	EnvTemplateTransforms map[string]string `hcl:"-"`
 }
 
 const (
@@ -168,11 +176,160 @@ type TemplateConfig struct {
 }
 
 type ExecConfig struct {
+	// Name, if set, tags the log messages of the exec server and of its child
+	// process, so that they can be told apart from the Agent's other logs
+	Name string `hcl:"name,optional" mapstructure:"name"`
+
 	Command                []string  `hcl:"command,attr" mapstructure:"command"`
 	RestartOnSecretChanges string    `hcl:"restart_on_secret_changes,optional" mapstructure:"restart_on_secret_changes"`
 	RestartStopSignal      os.Signal `hcl:"-" mapstructure:"restart_stop_signal"`
+
+	// CommandFile is the path of a file whose contents are the command, as an
+	// alternative to Command for long or generated commands. It's read again
+	// every time the child process is started, so that changes to it apply
+	// from the next restart. Exactly one of Command, CommandFile and Argv is
+	// set.
+	CommandFile string `hcl:"command_file,optional" mapstructure:"command_file"`
+
+	// Argv is the command as the program and each of its arguments, as an
+	// alternative to Command. Unlike Command, it's never parsed or run
+	// through a shell, even if it only has one element, so its elements may
+	// contain spaces and quotes.
+	Argv []string `hcl:"argv,optional" mapstructure:"argv"`
+
+	// InstanceEnv passes the child process an instance id, which stays the
+	// same when it's restarted, and the number of times it has been restarted,
+	// so that it can tell that the Agent restarted it. They're set in the
+	// InstanceIDEnvVar and RestartCountEnvVar environment variables, which
+	// default to VAULT_EXEC_INSTANCE_ID and VAULT_EXEC_RESTART_COUNT, and
+	// override any other values of them.
+	InstanceEnv        bool   `hcl:"instance_env,optional" mapstructure:"instance_env"`
+	InstanceIDEnvVar   string `hcl:"instance_id_env_var,optional" mapstructure:"instance_id_env_var"`
+	RestartCountEnvVar string `hcl:"restart_count_env_var,optional" mapstructure:"restart_count_env_var"`
+
+	// InjectToken passes the Agent's current Vault token to the child
+	// process, for programs which are themselves Vault clients, in the
+	// TokenEnvVar environment variable, which defaults to VAULT_TOKEN. Each
+	// child process gets the token that's current when it's started, a
+	// rotated token doesn't restart the child process by itself. It's off by
+	// default, as the token is then readable by the child process, and by
+	// anything which can read its environment.
+	InjectToken bool   `hcl:"inject_token,optional" mapstructure:"inject_token"`
+	TokenEnvVar string `hcl:"token_env_var,optional" mapstructure:"token_env_var"`
+
+	// Namespace is the namespace the env templates are rendered against,
+	// instead of the Agent's templating namespace, which is the namespace of
+	// the VAULT_NAMESPACE environment variable or of the auto_auth method.
+	// The Agent's token must have access to the secrets in it.
+	Namespace string `hcl:"namespace,optional" mapstructure:"namespace"`
+
+	// InheritEnvAllowlist and InheritEnvDenylist control which of the Agent's
+	// own environment variables are passed to the child process. At most one
+	// of them may be set. Rendered env_template values are always passed.
+	InheritEnvAllowlist []string `hcl:"inherit_env_allowlist,optional" mapstructure:"inherit_env_allowlist"`
+	InheritEnvDenylist  []string `hcl:"inherit_env_denylist,optional" mapstructure:"inherit_env_denylist"`
+
+	// ArgTemplates enables substitution of `{{ env "NAME" }}` placeholders in
+	// the command and its arguments with the rendered env_template values.
+	// Note that command line arguments are visible to other users on the
+	// host through process listings (e.g. ps or /proc/<pid>/cmdline), so
+	// secrets passed this way are less protected than environment variables.
+	// When the command is a single string run through a shell, the rendered
+	// values are also subject to shell interpretation.
+	ArgTemplates bool `hcl:"arg_templates,optional" mapstructure:"arg_templates"`
+
+	// OutputBufferSize is the number of bytes of the child process's most
+	// recent output that are kept for diagnostics if it exits unexpectedly
+	OutputBufferSize int `hcl:"output_buffer_size,optional" mapstructure:"output_buffer_size"`
+
+	// StartupDelay is how long to wait after the initial render before the
+	// child process is started for the first time. It isn't applied when the
+	// child is restarted.
+	StartupDelay time.Duration `hcl:"-" mapstructure:"startup_delay"`
+
+	// RestartStrategy controls how the child process is restarted when the
+	// secrets change. "stop_start" stops the running process before starting
+	// the new one. "overlap" starts the new process first, and only stops the
+	// old process once HealthCheckCommand succeeds, within HealthCheckTimeout.
+	RestartStrategy    string        `hcl:"restart_strategy,optional" mapstructure:"restart_strategy"`
+	HealthCheckCommand []string      `hcl:"health_check_command,optional" mapstructure:"health_check_command"`
+	HealthCheckTimeout time.Duration `hcl:"-" mapstructure:"health_check_timeout"`
+
+	// CommandTimeout is the maximum amount of time the child process may run
+	// before it is stopped, which is useful for supervising one-shot jobs.
+	// Zero means the child process may run forever.
+	CommandTimeout time.Duration `hcl:"-" mapstructure:"command_timeout"`
+
+	// KillTimeout is how long the child process has to stop after receiving
+	// RestartStopSignal, before it is forcefully killed with SIGKILL
+	KillTimeout time.Duration `hcl:"-" mapstructure:"kill_timeout"`
+
+	// StaticEnv holds environment variables with fixed values, which are
+	// passed to the child process along with the rendered env_template values.
+	// When a name is in both, StaticEnvPrecedence decides which value is used:
+	// "template" (the default) uses the rendered value, and "static" uses the
+	// value from StaticEnv. Both are applied after the inherited environment,
+	// so they override the Agent's own environment variables.
+	StaticEnv           map[string]string `hcl:"static_env,optional" mapstructure:"static_env"`
+	StaticEnvPrecedence string            `hcl:"static_env_precedence,optional" mapstructure:"static_env_precedence"`
+
+	// AllocatePTY starts the child process in its own session, with a
+	// pseudo-terminal as its controlling terminal and its stdin, stdout and
+	// stderr, for programs which behave differently, e.g. with line buffering
+	// or colors, when they aren't run in a terminal. The child's output is
+	// copied from the terminal to the Agent's stdout, and the Agent's stdin
+	// isn't passed on. It's supported on Linux, macOS and FreeBSD.
+	AllocatePTY bool `hcl:"allocate_pty,optional" mapstructure:"allocate_pty"`
+
+	// ReloadSignal is the signal forwarded to the child process when the Agent
+	// itself receives SIGHUP, e.g. to make it reload its own configuration. If
+	// it isn't set, the child process isn't signalled.
+	ReloadSignal os.Signal `hcl:"-" mapstructure:"reload_signal"`
+
+	// ForwardSignals are the signals which the Agent relays to the child
+	// process when it receives them, instead of handling them itself, e.g.
+	// SIGUSR1 for a program which reopens its logs. The signals the Agent
+	// handles itself, SIGINT, SIGTERM and SIGHUP, can't be forwarded; use
+	// ReloadSignal to signal the child process on SIGHUP.
+	ForwardSignals []os.Signal `hcl:"-" mapstructure:"forward_signals"`
+
+	// RenderOnce stops watching the env templates once they have rendered
+	// and the child process has been started, for one-shot jobs which should
+	// run once with fresh secrets. The child process is never restarted, and
+	// the Agent exits with its exit code when it exits.
+	RenderOnce bool `hcl:"render_once,optional" mapstructure:"render_once"`
+
+	// InitialRenderTimeout is how long the env templates may take to all
+	// render for the first time, before the exec server gives up and reports
+	// the templates which never rendered. Zero means waiting forever.
+	InitialRenderTimeout time.Duration `hcl:"-" mapstructure:"initial_render_timeout"`
+
+	// RenderQuietPeriod is how long the exec server waits after a render of
+	// the env templates for further renders, before deciding whether to
+	// restart the running child process with the latest one. It coalesces
+	// secrets that change in quick succession into a single restart. Zero
+	// means every render is acted on immediately.
+	RenderQuietPeriod time.Duration `hcl:"-" mapstructure:"render_quiet_period"`
+
+	// BounceLatencyBudget is how long bouncing the child process for a
+	// complete render may take, e.g. stopping the old process and waiting
+	// for startup_delay or the health check, before a warning is logged.
+	// Zero means no budget. The latency is measured either way.
+	BounceLatencyBudget time.Duration `hcl:"-" mapstructure:"bounce_latency_budget"`
+
+	// WatchFiles are the paths of files other than the env templates, such
+	// as the child process's own configuration, whose changes restart the
+	// child process, subject to the same restart_on_secret_changes policy as
+	// changed secrets. Changes are acted on once the files haven't changed
+	// for WatchFilesDebounce, which defaults to one second, so that a file
+	// written in several steps restarts the child process once.
+	WatchFiles         []string      `hcl:"watch_files,optional" mapstructure:"watch_files"`
+	WatchFilesDebounce time.Duration `hcl:"-" mapstructure:"watch_files_debounce"`
 }
 
+// ptyPlatforms are the operating systems which support exec.allocate_pty
+var ptyPlatforms = []string{"linux", "darwin", "freebsd"}
+
 func NewConfig() *Config {
 	return &Config{
 		SharedConfig: new(configutil.SharedConfig),
@@ -283,6 +440,20 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.EnvTemplates = append(result.EnvTemplates, envTmpl)
 	}
 
+	for envVar, transform := range c.EnvTemplateTransforms {
+		if result.EnvTemplateTransforms == nil {
+			result.EnvTemplateTransforms = make(map[string]string)
+		}
+		result.EnvTemplateTransforms[envVar] = transform
+	}
+
+	for envVar, transform := range c2.EnvTemplateTransforms {
+		if result.EnvTemplateTransforms == nil {
+			result.EnvTemplateTransforms = make(map[string]string)
+		}
+		result.EnvTemplateTransforms[envVar] = transform
+	}
+
 	return result
 }
 
@@ -378,15 +549,117 @@ func (c *Config) validateEnvTemplateConfig() error {
 		return fmt.Errorf("'template' cannot be specified with 'env_template' entries")
 	}
 
-	if len(c.Exec.Command) == 0 {
-		return fmt.Errorf("'exec' requires a non-empty 'command' field")
+	if len(c.Exec.Command) == 0 && c.Exec.CommandFile == "" && len(c.Exec.Argv) == 0 {
+		return fmt.Errorf("'exec' requires a non-empty 'command', 'command_file' or 'argv' field")
+	}
+
+	if len(c.Exec.Command) > 0 && c.Exec.CommandFile != "" {
+		return fmt.Errorf("'exec.command' and 'exec.command_file' cannot be specified together")
+	}
+
+	if len(c.Exec.Argv) > 0 {
+		if len(c.Exec.Command) > 0 || c.Exec.CommandFile != "" {
+			return fmt.Errorf("'exec.argv' cannot be specified with 'exec.command' or 'exec.command_file'")
+		}
+		if strings.TrimSpace(c.Exec.Argv[0]) == "" {
+			return fmt.Errorf("'exec.argv' must start with a non-empty program")
+		}
 	}
 
 	if !slices.Contains([]string{"always", "never"}, c.Exec.RestartOnSecretChanges) {
 		return fmt.Errorf("'exec.restart_on_secret_changes' unexpected value: %q", c.Exec.RestartOnSecretChanges)
 	}
 
-	uniqueKeys := make(map[string]struct{})
+	if !slices.Contains([]string{"stop_start", "overlap"}, c.Exec.RestartStrategy) {
+		return fmt.Errorf("'exec.restart_strategy' unexpected value: %q", c.Exec.RestartStrategy)
+	}
+
+	if c.Exec.RestartStrategy == "overlap" && len(c.Exec.HealthCheckCommand) == 0 {
+		return fmt.Errorf("'exec.restart_strategy' \"overlap\" requires a non-empty 'health_check_command' field")
+	}
+
+	if c.Exec.KillTimeout < 0 {
+		return fmt.Errorf("'exec.kill_timeout' must not be negative")
+	}
+
+	if c.Exec.CommandTimeout < 0 {
+		return fmt.Errorf("'exec.command_timeout' must not be negative")
+	}
+
+	if c.Exec.HealthCheckTimeout < 0 {
+		return fmt.Errorf("'exec.health_check_timeout' must not be negative")
+	}
+
+	if c.Exec.StartupDelay < 0 {
+		return fmt.Errorf("'exec.startup_delay' must not be negative")
+	}
+
+	if c.Exec.InitialRenderTimeout < 0 {
+		return fmt.Errorf("'exec.initial_render_timeout' must not be negative")
+	}
+
+	if c.Exec.RenderQuietPeriod < 0 {
+		return fmt.Errorf("'exec.render_quiet_period' must not be negative")
+	}
+
+	if c.Exec.BounceLatencyBudget < 0 {
+		return fmt.Errorf("'exec.bounce_latency_budget' must not be negative")
+	}
+
+	if c.Exec.WatchFilesDebounce < 0 {
+		return fmt.Errorf("'exec.watch_files_debounce' must not be negative")
+	}
+
+	if len(c.Exec.WatchFiles) > 0 && c.Exec.RenderOnce {
+		return fmt.Errorf("'exec.watch_files' cannot be specified with 'exec.render_once', which never restarts the child process")
+	}
+
+	agentSignals := map[os.Signal]string{os.Interrupt: "SIGINT", syscall.SIGTERM: "SIGTERM", syscall.SIGHUP: "SIGHUP"}
+	uncaughtSignals := map[os.Signal]string{os.Kill: "SIGKILL", ctsignals.SIGNULL: "SIGNULL"}
+	for _, sig := range c.Exec.ForwardSignals {
+		if name, ok := agentSignals[sig]; ok {
+			return fmt.Errorf("'exec.forward_signals' cannot contain %s, which is handled by the Agent itself", name)
+		}
+		if name, ok := uncaughtSignals[sig]; ok {
+			return fmt.Errorf("'exec.forward_signals' cannot contain %s, which can't be caught", name)
+		}
+	}
+
+	if c.Exec.OutputBufferSize < 0 {
+		return fmt.Errorf("'exec.output_buffer_size' must not be negative")
+	}
+
+	if c.Exec.AllocatePTY && !slices.Contains(ptyPlatforms, runtime.GOOS) {
+		return fmt.Errorf("'exec.allocate_pty' is not supported on %s", runtime.GOOS)
+	}
+
+	if len(c.Exec.InheritEnvAllowlist) > 0 && len(c.Exec.InheritEnvDenylist) > 0 {
+		return fmt.Errorf("'exec.inherit_env_allowlist' and 'exec.inherit_env_denylist' cannot be specified together")
+	}
+
+	if err := validateEnvTemplateNames(c.EnvTemplates); err != nil {
+		return err
+	}
+
+	if !slices.Contains([]string{"template", "static"}, c.Exec.StaticEnvPrecedence) {
+		return fmt.Errorf("'exec.static_env_precedence' unexpected value: %q", c.Exec.StaticEnvPrecedence)
+	}
+
+	if err := validateStaticEnvNames(c.Exec.StaticEnv); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(c.Exec.InstanceIDEnvVar, "=\x00") {
+		return fmt.Errorf("'exec.instance_id_env_var' is not a valid environment variable name: %q", c.Exec.InstanceIDEnvVar)
+	}
+
+	if strings.ContainsAny(c.Exec.RestartCountEnvVar, "=\x00") {
+		return fmt.Errorf("'exec.restart_count_env_var' is not a valid environment variable name: %q", c.Exec.RestartCountEnvVar)
+	}
+
+	if strings.ContainsAny(c.Exec.TokenEnvVar, "=\x00") {
+		return fmt.Errorf("'exec.token_env_var' is not a valid environment variable name: %q", c.Exec.TokenEnvVar)
+	}
 
 	for _, template := range c.EnvTemplates {
 		// Required:
@@ -399,19 +672,10 @@ func (c *Config) validateEnvTemplateConfig() error {
 		//   - right_delimiter
 		//   - ExtFuncMap
 		//   - function_denylist / function_blacklist
-
-		if template.MapToEnvironmentVariable == nil {
-			return fmt.Errorf("env_template: an environment variable name is required")
-		}
+		//   - transform (parsed separately into EnvTemplateTransforms)
 
 		key := *template.MapToEnvironmentVariable
 
-		if _, exists := uniqueKeys[key]; exists {
-			return fmt.Errorf("env_template: duplicate environment variable name: %q", key)
-		}
-
-		uniqueKeys[key] = struct{}{}
-
 		if template.Contents == nil && template.Source == nil {
 			return fmt.Errorf("env_template[%s]: either 'contents' or 'source' must be specified", key)
 		}
@@ -1217,6 +1481,18 @@ func parseExec(result *Config, list *ast.ObjectList) error {
 		return errors.New("error converting config")
 	}
 
+	// the "static_env" value is a []map[string]interface{}, flatten it into a
+	// map[string]interface{} with the last value winning, as for env_template
+	if staticEnv, ok := parsed["static_env"].([]map[string]interface{}); ok {
+		flattened := make(map[string]interface{})
+		for _, m := range staticEnv {
+			for k, v := range m {
+				flattened[k] = v
+			}
+		}
+		parsed["static_env"] = flattened
+	}
+
 	var execConfig ExecConfig
 	var md mapstructure.Metadata
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
@@ -1247,10 +1523,96 @@ func parseExec(result *Config, list *ast.ObjectList) error {
 		execConfig.RestartOnSecretChanges = "always"
 	}
 
+	if execConfig.RestartStrategy == "" {
+		execConfig.RestartStrategy = "stop_start"
+	}
+
+	if execConfig.StaticEnvPrecedence == "" {
+		execConfig.StaticEnvPrecedence = "template"
+	}
+
+	execConfig.Namespace = namespace.Canonicalize(execConfig.Namespace)
+
 	result.Exec = &execConfig
 	return nil
 }
 
+// validateEnvTemplateNames ensures that every env_template maps to a valid
+// and distinct environment variable name. All offending names are reported
+// together rather than one at a time.
+func validateEnvTemplateNames(templates []*ctconfig.TemplateConfig) error {
+	var invalid, duplicates []string
+	seen := make(map[string]int, len(templates))
+
+	for _, template := range templates {
+		if template.MapToEnvironmentVariable == nil {
+			return fmt.Errorf("env_template: an environment variable name is required")
+		}
+
+		key := *template.MapToEnvironmentVariable
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			invalid = append(invalid, strconv.Quote(key))
+		}
+
+		seen[key]++
+		if seen[key] == 2 {
+			duplicates = append(duplicates, strconv.Quote(key))
+		}
+	}
+
+	var errs *multierror.Error
+	if len(invalid) > 0 {
+		errs = multierror.Append(errs, fmt.Errorf("env_template: invalid environment variable names: %s", strings.Join(invalid, ", ")))
+	}
+	if len(duplicates) > 0 {
+		errs = multierror.Append(errs, fmt.Errorf("env_template: duplicate environment variable names: %s", strings.Join(duplicates, ", ")))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// validateStaticEnvNames ensures that every exec.static_env entry has a valid
+// environment variable name, reporting all of the invalid names together
+func validateStaticEnvNames(staticEnv map[string]string) error {
+	var invalid []string
+	for name := range staticEnv {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			invalid = append(invalid, strconv.Quote(name))
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+
+	sort.Strings(invalid)
+	return fmt.Errorf("exec.static_env: invalid environment variable names: %s", strings.Join(invalid, ", "))
+}
+
+// envTemplateTransforms are the functions which may be applied to the
+// rendered contents of an env_template using its 'transform' field
+var envTemplateTransforms = map[string]func(string) string{
+	"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"trim":   strings.TrimSpace,
+	"upper":  strings.ToUpper,
+	"lower":  strings.ToLower,
+}
+
+// TransformEnvTemplateContents applies the named transform to the rendered
+// contents of an env_template. Transforms run after rendering. An empty
+// transform returns the contents unchanged.
+func TransformEnvTemplateContents(transform, contents string) (string, error) {
+	if transform == "" {
+		return contents, nil
+	}
+
+	fn, ok := envTemplateTransforms[transform]
+	if !ok {
+		return "", fmt.Errorf("unknown env_template transform: %q", transform)
+	}
+
+	return fn(contents), nil
+}
+
 func parseEnvTemplates(result *Config, list *ast.ObjectList) error {
 	name := "env_template"
 
@@ -1274,6 +1636,20 @@ func parseEnvTemplates(result *Config, list *ast.ObjectList) error {
 			return errors.New("error converting config")
 		}
 
+		// 'transform' isn't part of the consul-template config, so remove it
+		// before decoding and keep track of it separately
+		var transform string
+		if raw, ok := parsed["transform"]; ok {
+			transform, ok = raw.(string)
+			if !ok {
+				return fmt.Errorf("'transform' must be a string")
+			}
+			if _, ok := envTemplateTransforms[transform]; !ok {
+				return fmt.Errorf("'transform' unexpected value: %q", transform)
+			}
+			delete(parsed, "transform")
+		}
+
 		var templateConfig ctconfig.TemplateConfig
 		var md mapstructure.Metadata
 		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
@@ -1305,6 +1681,13 @@ func parseEnvTemplates(result *Config, list *ast.ObjectList) error {
 
 		templateConfig.MapToEnvironmentVariable = pointerutil.StringPtr(environmentVariableName)
 
+		if transform != "" {
+			if result.EnvTemplateTransforms == nil {
+				result.EnvTemplateTransforms = make(map[string]string)
+			}
+			result.EnvTemplateTransforms[environmentVariableName] = transform
+		}
+
 		envTemplates = append(envTemplates, &templateConfig)
 	}
 
@@ -5,6 +5,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -2166,6 +2167,14 @@ func TestLoadConfigFile_EnvTemplates_Complex(t *testing.T) {
 			t.Fatalf("expected environment variable %s", expected)
 		}
 	}
+
+	if transform := cfg.EnvTemplateTransforms["FOO_USER"]; transform != "trim" {
+		t.Fatalf("expected FOO_USER transform to be 'trim', got %q", transform)
+	}
+
+	if transform, ok := cfg.EnvTemplateTransforms["FOO_PASSWORD"]; ok {
+		t.Fatalf("expected no FOO_PASSWORD transform, got %q", transform)
+	}
 }
 
 // TestLoadConfigFile_EnvTemplates_WithSource loads and validates an
@@ -2179,6 +2188,14 @@ func TestLoadConfigFile_EnvTemplates_WithSource(t *testing.T) {
 	if err := cfg.ValidateConfig(); err != nil {
 		t.Fatalf("validation error: %s", err)
 	}
+
+	if !slices.Equal(cfg.Exec.WatchFiles, []string{"/path/to/my/app.conf", "/path/to/my/app.d/extra.conf"}) {
+		t.Fatalf("exec.watch_files does not have expected value: %v", cfg.Exec.WatchFiles)
+	}
+
+	if cfg.Exec.WatchFilesDebounce != 250*time.Millisecond {
+		t.Fatalf("expected cfg.Exec.WatchFilesDebounce to be 250ms, got %s", cfg.Exec.WatchFilesDebounce)
+	}
 }
 
 // TestLoadConfigFile_EnvTemplates_NoName ensures that env_template with no name triggers an error
@@ -2189,6 +2206,14 @@ func TestLoadConfigFile_EnvTemplates_NoName(t *testing.T) {
 	}
 }
 
+// TestLoadConfigFile_EnvTemplates_InvalidTransform ensures that an unknown transform triggers an error
+func TestLoadConfigFile_EnvTemplates_InvalidTransform(t *testing.T) {
+	_, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-invalid-transform.hcl")
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
 // TestLoadConfigFile_EnvTemplates_ExecInvalidSignal ensures that an invalid signal triggers an error
 func TestLoadConfigFile_EnvTemplates_ExecInvalidSignal(t *testing.T) {
 	_, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-invalid-signal.hcl")
@@ -2221,6 +2246,48 @@ func TestLoadConfigFile_EnvTemplates_ExecSimple(t *testing.T) {
 	if cfg.Exec.RestartStopSignal != syscall.SIGTERM {
 		t.Fatalf("expected cfg.Exec.RestartStopSignal to be 'syscall.SIGTERM', got '%s'", cfg.Exec.RestartStopSignal)
 	}
+
+	if cfg.Exec.ReloadSignal != nil {
+		t.Fatalf("expected cfg.Exec.ReloadSignal to be unset, got %q", cfg.Exec.ReloadSignal)
+	}
+
+	if cfg.Exec.ArgTemplates {
+		t.Fatal("expected cfg.Exec.ArgTemplates to be false")
+	}
+
+	if cfg.Exec.RestartStrategy != "stop_start" {
+		t.Fatalf("expected cfg.Exec.RestartStrategy to be 'stop_start', got %q", cfg.Exec.RestartStrategy)
+	}
+
+	if cfg.Exec.StaticEnvPrecedence != "template" {
+		t.Fatalf("expected cfg.Exec.StaticEnvPrecedence to be 'template', got %q", cfg.Exec.StaticEnvPrecedence)
+	}
+}
+
+// TestLoadConfigFile_EnvTemplates_ExecArgv validates that the exec command can
+// be given as an argv array, whose elements are kept as they are
+func TestLoadConfigFile_EnvTemplates_ExecArgv(t *testing.T) {
+	cfg, err := LoadConfigFile("./test-fixtures/config-env-templates-argv.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	if err := cfg.ValidateConfig(); err != nil {
+		t.Fatalf("validation error: %s", err)
+	}
+
+	if !slices.Equal(cfg.Exec.Argv, []string{"/path/to/my app", "--greeting", "hello world"}) {
+		t.Fatalf("exec.argv does not have expected value, got %q", cfg.Exec.Argv)
+	}
+
+	if len(cfg.Exec.Command) != 0 {
+		t.Fatalf("expected cfg.Exec.Command to be empty, got %q", cfg.Exec.Command)
+	}
+
+	cfg.Exec.Argv = []string{" ", "--greeting"}
+	if err := cfg.ValidateConfig(); err == nil || !strings.Contains(err.Error(), "must start with a non-empty program") {
+		t.Fatalf("expected an error for an argv without a program, got %v", err)
+	}
 }
 
 // TestLoadConfigFile_EnvTemplates_ExecComplex validates the exec section with non-default parameters
@@ -2245,6 +2312,106 @@ func TestLoadConfigFile_EnvTemplates_ExecComplex(t *testing.T) {
 	if cfg.Exec.RestartStopSignal != syscall.SIGINT {
 		t.Fatalf("expected cfg.Exec.RestartStopSignal to be 'syscall.SIGINT', got %q", cfg.Exec.RestartStopSignal)
 	}
+
+	if cfg.Exec.ReloadSignal != syscall.SIGHUP {
+		t.Fatalf("expected cfg.Exec.ReloadSignal to be 'syscall.SIGHUP', got %q", cfg.Exec.ReloadSignal)
+	}
+
+	if !slices.Equal(cfg.Exec.ForwardSignals, []os.Signal{syscall.SIGQUIT, syscall.SIGALRM}) {
+		t.Fatalf("expected cfg.Exec.ForwardSignals to be SIGQUIT and SIGALRM, got %v", cfg.Exec.ForwardSignals)
+	}
+
+	if !slices.Equal(cfg.Exec.InheritEnvDenylist, []string{"VAULT_TOKEN"}) {
+		t.Fatal("exec.inherit_env_denylist does not have expected value")
+	}
+
+	if !cfg.Exec.ArgTemplates {
+		t.Fatal("expected cfg.Exec.ArgTemplates to be true")
+	}
+
+	if cfg.Exec.OutputBufferSize != 8192 {
+		t.Fatalf("expected cfg.Exec.OutputBufferSize to be 8192, got %d", cfg.Exec.OutputBufferSize)
+	}
+
+	if cfg.Exec.StartupDelay != 5*time.Second {
+		t.Fatalf("expected cfg.Exec.StartupDelay to be 5s, got %s", cfg.Exec.StartupDelay)
+	}
+
+	if cfg.Exec.RestartStrategy != "overlap" {
+		t.Fatalf("expected cfg.Exec.RestartStrategy to be 'overlap', got %q", cfg.Exec.RestartStrategy)
+	}
+
+	if !slices.Equal(cfg.Exec.HealthCheckCommand, []string{"curl", "-f", "http://localhost:8080/health"}) {
+		t.Fatal("exec.health_check_command does not have expected value")
+	}
+
+	if cfg.Exec.HealthCheckTimeout != 10*time.Second {
+		t.Fatalf("expected cfg.Exec.HealthCheckTimeout to be 10s, got %s", cfg.Exec.HealthCheckTimeout)
+	}
+
+	if cfg.Exec.CommandTimeout != time.Hour {
+		t.Fatalf("expected cfg.Exec.CommandTimeout to be 1h, got %s", cfg.Exec.CommandTimeout)
+	}
+
+	if cfg.Exec.KillTimeout != 15*time.Second {
+		t.Fatalf("expected cfg.Exec.KillTimeout to be 15s, got %s", cfg.Exec.KillTimeout)
+	}
+
+	if cfg.Exec.InitialRenderTimeout != 2*time.Minute {
+		t.Fatalf("expected cfg.Exec.InitialRenderTimeout to be 2m, got %s", cfg.Exec.InitialRenderTimeout)
+	}
+
+	if cfg.Exec.RenderQuietPeriod != 500*time.Millisecond {
+		t.Fatalf("expected cfg.Exec.RenderQuietPeriod to be 500ms, got %s", cfg.Exec.RenderQuietPeriod)
+	}
+
+	if cfg.Exec.BounceLatencyBudget != 3*time.Second {
+		t.Fatalf("expected cfg.Exec.BounceLatencyBudget to be 3s, got %s", cfg.Exec.BounceLatencyBudget)
+	}
+
+	if len(cfg.Exec.StaticEnv) != 2 || cfg.Exec.StaticEnv["APP_MODE"] != "production" || cfg.Exec.StaticEnv["LOG_LEVEL"] != "info" {
+		t.Fatalf("exec.static_env does not have expected value: %v", cfg.Exec.StaticEnv)
+	}
+
+	if cfg.Exec.StaticEnvPrecedence != "static" {
+		t.Fatalf("expected cfg.Exec.StaticEnvPrecedence to be 'static', got %q", cfg.Exec.StaticEnvPrecedence)
+	}
+
+	if !cfg.Exec.AllocatePTY {
+		t.Fatal("expected cfg.Exec.AllocatePTY to be true")
+	}
+
+	if !cfg.Exec.InstanceEnv {
+		t.Fatal("expected cfg.Exec.InstanceEnv to be true")
+	}
+
+	if cfg.Exec.InstanceIDEnvVar != "" {
+		t.Fatalf("expected cfg.Exec.InstanceIDEnvVar to be empty, got %q", cfg.Exec.InstanceIDEnvVar)
+	}
+
+	if cfg.Exec.RestartCountEnvVar != "APP_RESTARTS" {
+		t.Fatalf("expected cfg.Exec.RestartCountEnvVar to be 'APP_RESTARTS', got %q", cfg.Exec.RestartCountEnvVar)
+	}
+
+	if !cfg.Exec.InjectToken {
+		t.Fatal("expected cfg.Exec.InjectToken to be true")
+	}
+
+	if cfg.Exec.TokenEnvVar != "APP_VAULT_TOKEN" {
+		t.Fatalf("expected cfg.Exec.TokenEnvVar to be 'APP_VAULT_TOKEN', got %q", cfg.Exec.TokenEnvVar)
+	}
+
+	if cfg.Exec.Namespace != "team-a/" {
+		t.Fatalf("expected cfg.Exec.Namespace to be 'team-a/', got %q", cfg.Exec.Namespace)
+	}
+
+	if cfg.Exec.Name != "app" {
+		t.Fatalf("expected cfg.Exec.Name to be 'app', got %q", cfg.Exec.Name)
+	}
+
+	if !cfg.Exec.RenderOnce {
+		t.Fatal("expected cfg.Exec.RenderOnce to be true")
+	}
 }
 
 // TestLoadConfigFile_Bad_EnvTemplates_MissingExec ensures that ValidateConfig
@@ -2260,6 +2427,150 @@ func TestLoadConfigFile_Bad_EnvTemplates_MissingExec(t *testing.T) {
 	}
 }
 
+// TestLoadConfigFile_Bad_EnvTemplates_InheritEnvConflict ensures that
+// ValidateConfig errors when both an inherited environment allowlist and
+// denylist are specified
+func TestLoadConfigFile_Bad_EnvTemplates_InheritEnvConflict(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-inherit-env-conflict.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	if err := config.ValidateConfig(); err == nil {
+		t.Fatal("expected an error from ValidateConfig: inherit_env_allowlist and inherit_env_denylist are mutually exclusive")
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_CommandConflict ensures that
+// ValidateConfig errors when both a command and a command file are specified
+func TestLoadConfigFile_Bad_EnvTemplates_CommandConflict(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-command-conflict.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	if err := config.ValidateConfig(); err == nil {
+		t.Fatal("expected an error from ValidateConfig: command and command_file are mutually exclusive")
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_ArgvConflict ensures that ValidateConfig
+// errors when both a command and an argv are specified
+func TestLoadConfigFile_Bad_EnvTemplates_ArgvConflict(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-argv-conflict.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	if err := config.ValidateConfig(); err == nil {
+		t.Fatal("expected an error from ValidateConfig: command and argv are mutually exclusive")
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_OverlapNoHealthCheck ensures that
+// ValidateConfig errors when the "overlap" restart strategy is used without a
+// health check command
+func TestLoadConfigFile_Bad_EnvTemplates_OverlapNoHealthCheck(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-overlap-no-health-check.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	if err := config.ValidateConfig(); err == nil {
+		t.Fatal("expected an error from ValidateConfig: restart_strategy overlap requires health_check_command")
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_WatchFilesRenderOnce ensures that
+// ValidateConfig errors for watched files with render_once, as the child
+// process would never be restarted for them
+func TestLoadConfigFile_Bad_EnvTemplates_WatchFilesRenderOnce(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-watch-files-render-once.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	if err := config.ValidateConfig(); err == nil {
+		t.Fatal("expected an error from ValidateConfig: watch_files can't be used with render_once")
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_ForwardSignals ensures that
+// ValidateConfig errors for a forwarded signal which the Agent handles itself
+func TestLoadConfigFile_Bad_EnvTemplates_ForwardSignals(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-forward-signals.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	err = config.ValidateConfig()
+	if err == nil || !strings.Contains(err.Error(), "cannot contain SIGTERM") {
+		t.Fatalf("expected an error from ValidateConfig for forwarding SIGTERM, got %v", err)
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_InvalidNames ensures that ValidateConfig
+// errors for duplicate or invalid environment variable names, and reports all
+// offending names
+func TestLoadConfigFile_Bad_EnvTemplates_InvalidNames(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-invalid-names.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	err = config.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected an error from ValidateConfig: duplicate and invalid environment variable names")
+	}
+
+	for _, name := range []string{`"FOO"`, `"BAR=BAZ"`} {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("expected error to contain %s, got: %s", name, err)
+		}
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_InvalidStaticEnv ensures that
+// ValidateConfig errors for invalid exec.static_env variable names
+func TestLoadConfigFile_Bad_EnvTemplates_InvalidStaticEnv(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/bad-config-env-templates-invalid-static-env.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	err = config.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected an error from ValidateConfig: invalid static_env variable name")
+	}
+
+	if !strings.Contains(err.Error(), `"LOG=LEVEL"`) {
+		t.Fatalf("expected error to contain \"LOG=LEVEL\", got: %s", err)
+	}
+}
+
+// TestLoadConfigFile_Bad_EnvTemplates_UnsupportedPTY ensures that
+// ValidateConfig errors when exec.allocate_pty is set on a platform which
+// doesn't support it
+func TestLoadConfigFile_Bad_EnvTemplates_UnsupportedPTY(t *testing.T) {
+	config, err := LoadConfigFile("./test-fixtures/config-env-templates-complex.hcl")
+	if err != nil {
+		t.Fatalf("error loading config file: %s", err)
+	}
+
+	platforms := ptyPlatforms
+	ptyPlatforms = nil
+	defer func() { ptyPlatforms = platforms }()
+
+	err = config.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected an error from ValidateConfig: allocate_pty is not supported")
+	}
+
+	if !strings.Contains(err.Error(), "'exec.allocate_pty' is not supported") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
 // TestLoadConfigFile_Bad_EnvTemplates_WithProxy ensures that ValidateConfig
 // errors when both env_template and api_proxy stanzas are present
 func TestLoadConfigFile_Bad_EnvTemplates_WithProxy(t *testing.T) {
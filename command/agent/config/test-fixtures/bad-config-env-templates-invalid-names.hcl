@@ -0,0 +1,32 @@
+auto_auth {
+
+  method {
+    type = "token_file"
+
+    config {
+      token_file_path = "/home/username/.vault-token"
+    }
+  }
+}
+
+vault {
+  address = "http://localhost:8200"
+}
+
+env_template "FOO" {
+  contents = "{{ with secret \"secret/data/foo\" }}{{ .Data.data.lock }}{{ end }}"
+}
+
+# Error: duplicate environment variable name
+env_template "FOO" {
+  contents = "{{ with secret \"secret/data/foo\" }}{{ .Data.data.user }}{{ end }}"
+}
+
+# Error: environment variable names cannot contain '='
+env_template "BAR=BAZ" {
+  contents = "{{ with secret \"secret/data/foo\" }}{{ .Data.data.password }}{{ end }}"
+}
+
+exec {
+  command = ["env"]
+}
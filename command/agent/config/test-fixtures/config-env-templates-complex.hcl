@@ -25,10 +25,39 @@ env_template "FOO_PASSWORD" {
 env_template "FOO_USER" {
   contents             = "{{ with secret \"secret/data/foo\" }}{{ .Data.data.user }}{{ end }}"
   error_on_missing_key = false
+  transform            = "trim"
 }
 
 exec {
+  name                      = "app"
   command                   = ["env"]
   restart_on_secret_changes = "never"
   restart_stop_signal       = "SIGINT"
+  reload_signal             = "SIGHUP"
+  forward_signals           = ["SIGQUIT", "SIGALRM"]
+  inherit_env_denylist      = ["VAULT_TOKEN"]
+  arg_templates             = true
+  output_buffer_size        = 8192
+  startup_delay             = "5s"
+  restart_strategy          = "overlap"
+  health_check_command      = ["curl", "-f", "http://localhost:8080/health"]
+  health_check_timeout      = "10s"
+  command_timeout           = "1h"
+  kill_timeout              = "15s"
+  initial_render_timeout    = "2m"
+  render_quiet_period       = "500ms"
+  bounce_latency_budget     = "3s"
+  static_env_precedence     = "static"
+  allocate_pty              = true
+  instance_env              = true
+  restart_count_env_var     = "APP_RESTARTS"
+  inject_token              = true
+  token_env_var             = "APP_VAULT_TOKEN"
+  namespace                 = "team-a"
+  render_once               = true
+
+  static_env = {
+    APP_MODE  = "production"
+    LOG_LEVEL = "info"
+  }
 }
@@ -12,5 +12,7 @@ env_template "MY_PASSWORD" {
 }
 
 exec {
-  command = ["/path/to/my/app", "arg1", "arg2"]
+  command              = ["/path/to/my/app", "arg1", "arg2"]
+  watch_files          = ["/path/to/my/app.conf", "/path/to/my/app.d/extra.conf"]
+  watch_files_debounce = "250ms"
 }
@@ -0,0 +1,84 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// envSizeWarningRatio is the share of the platform's limit on the combined
+// size of the command line and environment above which a warning is logged
+const envSizeWarningRatio = 0.9
+
+// envLimits are a platform's limits on what can be passed to a new process.
+// Zero means there's no such limit.
+type envLimits struct {
+	// total is the maximum combined size of the command line arguments and
+	// environment variables, including their terminating NUL bytes
+	total int
+
+	// perString is the maximum size of a single argument or variable
+	perString int
+}
+
+// platformEnvLimits are the default limits of the platforms which have them.
+// On Linux, the total is a quarter of the default 8MiB stack size, and each
+// string is limited to MAX_ARG_STRLEN. macOS's ARG_MAX is 1MiB, and on
+// Windows a variable can have at most 32767 characters.
+var platformEnvLimits = map[string]envLimits{
+	"linux":   {total: 2 * 1024 * 1024, perString: 128 * 1024},
+	"darwin":  {total: 1024 * 1024},
+	"windows": {perString: 32767},
+}
+
+// envSize returns the size of the command line and environment as the
+// platform's limits count it, each string with a terminating NUL byte
+func envSize(args []string, env []string) int {
+	size := 0
+	for _, s := range args {
+		size += len(s) + 1
+	}
+	for _, kv := range env {
+		size += len(kv) + 1
+	}
+	return size
+}
+
+// oversizedEnvVars returns the sorted names of the environment variables
+// which are larger than the given size
+func oversizedEnvVars(env []string, size int) []string {
+	var names []string
+	for _, kv := range env {
+		if len(kv)+1 > size {
+			name, _, _ := strings.Cut(kv, "=")
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// warnEnvSize logs a warning if the child process's command line and
+// environment are close to, or over, the platform's limits, as starting it
+// would then fail with an error that doesn't point at the rendered secrets
+func (s *Server) warnEnvSize(args []string, env []string) {
+	limits, ok := platformEnvLimits[runtime.GOOS]
+	if !ok {
+		return
+	}
+
+	if limits.total > 0 {
+		if size := envSize(args, env); float64(size) >= envSizeWarningRatio*float64(limits.total) {
+			s.logger.Warn("the command line and environment of the process are close to the platform's size limit, starting it may fail", "size", size, "limit", limits.total)
+		}
+	}
+	if limits.perString > 0 {
+		if names := oversizedEnvVars(env, limits.perString); len(names) > 0 {
+			s.logger.Warn("environment variables are over the platform's size limit for a single variable, starting the process will likely fail", "env_vars", names, "limit", limits.perString)
+		}
+	}
+}
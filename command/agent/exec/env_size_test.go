@@ -0,0 +1,31 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEnvSize verifies that the command line and environment are sized like
+// the platforms count them, with a NUL byte after each string
+func TestEnvSize(t *testing.T) {
+	require.Zero(t, envSize(nil, nil))
+	require.Equal(t, len("app\x00--verbose\x00FOO=bar\x00"), envSize([]string{"app", "--verbose"}, []string{"FOO=bar"}))
+}
+
+// TestOversizedEnvVars verifies that only the environment variables over the
+// size limit are reported, by name
+func TestOversizedEnvVars(t *testing.T) {
+	env := []string{
+		"SMALL=1",
+		"LARGE=" + strings.Repeat("x", 10),
+		"AT_LIMIT=" + strings.Repeat("x", 6),
+		"ALSO_LARGE=" + strings.Repeat("x", 20),
+	}
+	require.Empty(t, oversizedEnvVars(env, 100))
+	require.Equal(t, []string{"ALSO_LARGE", "LARGE"}, oversizedEnvVars(env, len("AT_LIMIT=xxxxxx")+1))
+}
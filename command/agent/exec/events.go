@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import "time"
+
+// EventType is the kind of a child process lifecycle Event
+type EventType string
+
+const (
+	// EventChildStarted is published when a child process has been started
+	EventChildStarted EventType = "child_started"
+
+	// EventChildStopped is published when the exec server has stopped a child
+	// process, e.g. to restart it or because the Agent is shutting down
+	EventChildStopped EventType = "child_stopped"
+
+	// EventChildRestarting is published when the running child process is
+	// about to be replaced by a new one, before either is stopped or started
+	EventChildRestarting EventType = "child_restarting"
+
+	// EventChildExited is published when a child process has exited on its
+	// own, e.g. because it crashed
+	EventChildExited EventType = "child_exited"
+
+	// EventBounceTriggered is published when changed secrets, or changed
+	// exec.watch_files, are about to restart the running child process
+	EventBounceTriggered EventType = "bounce_triggered"
+)
+
+// Event describes a change in the lifecycle of the exec server's child
+// process, it's passed to ServerConfig.EventHandler
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// PID is the pid of the child process the event is about
+	PID int
+
+	// Reason says why a child process was stopped or bounced
+	Reason string
+
+	// ExitCode is the exit code of the child process, for EventChildExited and
+	// EventChildStopped
+	ExitCode int
+
+	// ChangedEnvVars are the names of the environment variables whose change
+	// triggered a bounce, for EventBounceTriggered
+	ChangedEnvVars []string
+
+	// ChangedFiles are the paths of the exec.watch_files whose change
+	// triggered a bounce, for EventBounceTriggered
+	ChangedFiles []string
+}
+
+// publish passes the event to the configured EventHandler, if there is one
+func (s *Server) publish(event Event) {
+	if s.config.EventHandler == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	s.config.EventHandler(event)
+}
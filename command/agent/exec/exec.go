@@ -2,31 +2,84 @@ package exec
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	osexec "os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/consul-template/child"
 	ctconfig "github.com/hashicorp/consul-template/config"
 	"github.com/hashicorp/consul-template/manager"
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-uuid"
+	"k8s.io/utils/strings/slices"
 
 	"github.com/hashicorp/vault/command/agent/config"
 	"github.com/hashicorp/vault/command/agent/internal/ctmanager"
 	"github.com/hashicorp/vault/helper/useragent"
 	"github.com/hashicorp/vault/sdk/helper/pointerutil"
+	"github.com/hashicorp/vault/sdk/logical"
 )
 
-type childProcessState uint8
+const (
+	// defaultHealthCheckTimeout is how long a new child process may take to
+	// pass its health check when restarting with the "overlap" strategy
+	defaultHealthCheckTimeout = 30 * time.Second
+
+	// defaultKillTimeout is how long the child process has to stop after
+	// receiving RestartStopSignal, before it is sent SIGKILL
+	defaultKillTimeout = 30 * time.Second
+
+	// healthCheckInterval is how often the health check command is retried
+	healthCheckInterval = time.Second
+
+	// defaultInstanceIDEnvVar and defaultRestartCountEnvVar are the names of
+	// the environment variables set by exec.instance_env, unless they're
+	// configured otherwise
+	defaultInstanceIDEnvVar   = "VAULT_EXEC_INSTANCE_ID"
+	defaultRestartCountEnvVar = "VAULT_EXEC_RESTART_COUNT"
+
+	// defaultTokenEnvVar is the name of the environment variable set by
+	// exec.inject_token, unless it's configured otherwise
+	defaultTokenEnvVar = "VAULT_TOKEN"
+)
+
+// ChildProcessState is the lifecycle state of the exec server's child process
+type ChildProcessState uint8
 
 const (
-	childProcessStateNotStarted childProcessState = iota
-	childProcessStateRunning
-	childProcessStateRestarting
-	childProcessStateStopped
+	ChildProcessStateNotStarted ChildProcessState = iota
+	ChildProcessStateRunning
+	ChildProcessStateRestarting
+	ChildProcessStateStopped
 )
 
+func (s ChildProcessState) String() string {
+	switch s {
+	case ChildProcessStateNotStarted:
+		return "not_started"
+	case ChildProcessStateRunning:
+		return "running"
+	case ChildProcessStateRestarting:
+		return "restarting"
+	case ChildProcessStateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
 type ServerConfig struct {
 	Logger      hclog.Logger
 	AgentConfig *config.Config
@@ -41,6 +94,35 @@ type ServerConfig struct {
 	// the same io.Writer that Vault Agent itself is using.
 	LogLevel  hclog.Level
 	LogWriter io.Writer
+
+	// DryRun renders the env templates and prints the resulting environment
+	// variables and command to DryRunWriter, without starting the child
+	// process. Run returns once the templates have been rendered. If
+	// DryRunRedact is set, the rendered values are not printed.
+	DryRun       bool
+	DryRunRedact bool
+	DryRunWriter io.Writer
+
+	// RestartPolicy decides whether the running child process is restarted
+	// when the env templates render new contents. If it's nil, the policy is
+	// chosen by exec.restart_on_secret_changes.
+	RestartPolicy RestartPolicy
+
+	// EventHandler, if set, is called with each lifecycle Event of the child
+	// process, so that other Agent subsystems, or code embedding the Server,
+	// can react to them. It's called from the Run go-routine, and must not
+	// block.
+	EventHandler func(Event)
+}
+
+// childProcess is the child process supervised by the Server, it's a
+// consul-template child, or a ptyChild when exec.allocate_pty is set
+type childProcess interface {
+	Start() error
+	Stop()
+	Pid() int
+	Signal(os.Signal) error
+	ExitCh() <-chan int
 }
 
 type Server struct {
@@ -59,41 +141,208 @@ type Server struct {
 
 	logger hclog.Logger
 
-	childProcess      *child.Child
-	childProcessState childProcessState
+	// restartPolicy is the configured RestartPolicy, or the one for
+	// exec.restart_on_secret_changes
+	restartPolicy RestartPolicy
+
+	// newChild creates the child process for the given input, tests replace
+	// it to supervise fake child processes. It's child.New by default.
+	newChild func(*child.NewInput) (childProcess, error)
+
+	// childProcessLock guards childProcess and childProcessState, which are
+	// only modified by the Run go-routine, against concurrent readers such as
+	// Signal. The Run go-routine is also the only one that bounces and stops
+	// the child process, so it reads them without the lock, and a shutdown
+	// can't interleave with a bounce. childProcess is only set once it has
+	// started, so it's nil, or a started child, which may have exited since.
+	childProcessLock  sync.RWMutex
+	childProcess      childProcess
+	childProcessState ChildProcessState
+
+	// bookkeeping of the child process for Status, also guarded by
+	// childProcessLock
+	childProcessStartTime    time.Time
+	childProcessRestartCount int
+	childProcessLastExitCode *int
+	childProcessKillCount    int
+
+	// childProcessUptime is how long the child processes which have been
+	// stopped or have exited ran for, in total
+	childProcessUptime time.Duration
+
+	// childProcessPID is the pid of the current child process, which is kept
+	// once it has exited so that its exit can be reported
+	childProcessPID int
+
+	// instanceID identifies the child process across its restarts, it's
+	// passed to it when exec.instance_env is set
+	instanceID string
+
+	// vaultToken is the latest token received by Run, it's passed to each new
+	// child process when exec.inject_token is set. It's only used by the Run
+	// go-routine, and must never be logged
+	vaultToken string
 
 	// exit channel of the child process
 	childProcessExitCh chan int
 
+	// childProcessTimeoutCh receives when the child process has been running
+	// for longer than the configured command timeout
+	childProcessTimeoutCh chan struct{}
+
+	// childProcessOutput holds the tail of the current child process's
+	// combined stdout and stderr, it's replaced for every new child process
+	childProcessOutput *outputBuffer
+
+	// lastRenderedEnvVars holds the sorted environment variables the current
+	// child process was started with, so that a re-render which produces the
+	// same contents (e.g. after a token rotation) doesn't bounce the child
+	lastRenderedEnvVars []string
+
+	// previousRenderedEnvVars holds the sorted environment variables from the
+	// latest complete render, whether or not it bounced the child, and
+	// envVarLastChanged the render time at which each of their values last
+	// changed. envVarLastChanged is guarded by childProcessLock for Status
+	previousRenderedEnvVars []string
+	envVarLastChanged       map[string]time.Time
+
 	// we need to start a different go-routine to watch the
 	// child process each time we restart it.
 	// this function closes the old watcher go-routine so it doesn't leak
 	childProcessExitCodeCloser func()
+
+	// watchers tracks the go-routines watching the child processes and
+	// exec.watch_files. Their sends are abandoned once they're closed, and
+	// Run waits for all of them to return before it does
+	watchers sync.WaitGroup
+}
+
+// Status is a point-in-time snapshot of the exec server's child process
+type Status struct {
+	State         string    `json:"state"`
+	PID           int       `json:"pid"`
+	LastStartTime time.Time `json:"last_start_time"`
+	RestartCount  int       `json:"restart_count"`
+	LastExitCode  *int      `json:"last_exit_code"`
+
+	// KillCount is the number of times a child process didn't stop within
+	// the kill timeout, and had to be sent SIGKILL
+	KillCount int `json:"kill_count"`
+
+	// EnvVarsLastChanged is the time at which the rendered value of each
+	// environment variable last changed
+	EnvVarsLastChanged map[string]time.Time `json:"env_vars_last_changed"`
 }
 
 type ProcessExitError struct {
 	ExitCode int
+
+	// Output is the tail of the child process's combined stdout and stderr
+	Output string
+
+	// RestartCount is the number of times the child process was restarted
+	// before it exited, and TotalUptime how long the child processes ran for,
+	// in total, so that a process which failed on its first start can be
+	// told apart from one which exited after running for a long time
+	RestartCount int
+	TotalUptime  time.Duration
 }
 
 func (e *ProcessExitError) Error() string {
-	return fmt.Sprintf("process exited with %d", e.ExitCode)
+	if e.RestartCount == 0 {
+		return fmt.Sprintf("process exited with %d after running for %s", e.ExitCode, e.TotalUptime.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("process exited with %d after running for %s, with %d restarts", e.ExitCode, e.TotalUptime.Round(time.Millisecond), e.RestartCount)
+}
+
+// ProcessTimeoutError is returned when the child process was stopped because
+// it ran for longer than the configured command timeout
+type ProcessTimeoutError struct {
+	Timeout time.Duration
+
+	// Output is the tail of the child process's combined stdout and stderr
+	Output string
+}
+
+func (e *ProcessTimeoutError) Error() string {
+	return fmt.Sprintf("process did not exit within %s", e.Timeout)
+}
+
+// TemplateRenderError is returned when the env templates could not be
+// rendered, as opposed to the child process failing
+type TemplateRenderError struct {
+	Err error
+}
+
+func (e *TemplateRenderError) Error() string {
+	return fmt.Sprintf("template server: %s", e.Err)
+}
+
+func (e *TemplateRenderError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError is returned when the exec server or the child process cannot be
+// set up, usually because of the given configuration
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid exec server configuration: %s", e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
 }
 
 func NewServer(cfg *ServerConfig) *Server {
+	logger := cfg.Logger
+	if cfg.AgentConfig != nil && cfg.AgentConfig.Exec != nil && cfg.AgentConfig.Exec.Name != "" {
+		// consul-template's runner logs through the process wide logger, so
+		// only the exec server's and the child's own logs are tagged
+		logger = logger.With("exec_name", cfg.AgentConfig.Exec.Name)
+	}
+
 	server := Server{
-		logger:             cfg.Logger,
+		logger:             logger,
 		config:             cfg,
-		childProcessState:  childProcessStateNotStarted,
+		newChild:           newConsulTemplateChild,
+		childProcessState:  ChildProcessStateNotStarted,
 		childProcessExitCh: make(chan int),
+
+		childProcessTimeoutCh: make(chan struct{}),
 	}
 
 	return &server
 }
 
+// newConsulTemplateChild creates a consul-template child process
+func newConsulTemplateChild(input *child.NewInput) (childProcess, error) {
+	proc, err := child.New(input)
+	if err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
+
+// Run renders the env templates and supervises the child process until the
+// context is cancelled. Errors are returned as a *ConfigError if the server
+// could not be set up, a *TemplateRenderError if the templates failed to
+// render, a *ProcessExitError if the child process exited on its own, or a
+// *ProcessTimeoutError if it was stopped after exceeding the command timeout.
 func (s *Server) Run(ctx context.Context, incomingVaultToken chan string) error {
 	latestToken := new(string)
 	s.logger.Info("starting exec server")
 	defer func() {
+		// neither the runner nor the go-routines watching the child process
+		// and exec.watch_files may outlive Run, which no longer receives
+		// from them, whether it returns for a shutdown or early with an error
+		if s.runner != nil {
+			s.runner.Stop()
+		}
+		s.closeWatcher()
+		s.watchers.Wait()
 		s.logger.Info("exec server stopped")
 	}()
 
@@ -102,42 +351,113 @@ func (s *Server) Run(ctx context.Context, incomingVaultToken chan string) error
 		return nil
 	}
 
+	restartPolicy, err := s.configuredRestartPolicy()
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	s.restartPolicy = restartPolicy
+
+	// the command file is read again for every child process, reading it now
+	// reports a missing or empty file before the templates are rendered
+	if _, err := s.command(); err != nil {
+		return &ConfigError{Err: err}
+	}
+
+	// changes of exec.watch_files bounce the running child process. A nil
+	// channel never receives, so without watched files the case is never
+	// selected
+	var watchedFilesCh <-chan []string
+	if paths := s.config.AgentConfig.Exec.WatchFiles; len(paths) > 0 && !s.config.DryRun {
+		files, err := newWatchedFiles(paths, s.watchFilesDebounce(), s.logger)
+		if err != nil {
+			return &ConfigError{Err: err}
+		}
+		watchCtx, cancelWatch := context.WithCancel(ctx)
+		defer cancelWatch()
+		s.watchers.Add(1)
+		go func() {
+			defer s.watchers.Done()
+			files.run(watchCtx)
+		}()
+		watchedFilesCh = files.changedCh
+	}
+
+	// the signals of exec.forward_signals are relayed to the child process
+	// instead of taking their default action on the Agent. A nil channel
+	// never receives, so without them the case is never selected
+	var forwardedSignalCh chan os.Signal
+	if signals := s.config.AgentConfig.Exec.ForwardSignals; len(signals) > 0 && !s.config.DryRun {
+		forwardedSignalCh = make(chan os.Signal, len(signals))
+		signal.Notify(forwardedSignalCh, signals...)
+		defer signal.Stop(forwardedSignalCh)
+	}
+
+	if s.config.AgentConfig.Exec.InstanceEnv {
+		s.instanceID, err = uuid.GenerateUUID()
+		if err != nil {
+			return &ConfigError{Err: fmt.Errorf("unable to generate the child process's instance id: %w", err)}
+		}
+	}
+
 	managerConfig := ctmanager.ManagerConfig{
 		AgentConfig: s.config.AgentConfig,
-		Namespace:   s.config.Namespace,
+		Namespace:   s.templateNamespace(),
 		LogLevel:    s.config.LogLevel,
 		LogWriter:   s.config.LogWriter,
 	}
 
 	runnerConfig, err := ctmanager.NewConfig(managerConfig, s.config.AgentConfig.EnvTemplates)
 	if err != nil {
-		return fmt.Errorf("template server failed to generate runner config: %w", err)
+		return &ConfigError{Err: fmt.Errorf("template server failed to generate runner config: %w", err)}
 	}
 
 	// We leave this in "dry" mode, as there are no files to render;
 	// we will get the environment variables rendered contents from the incoming events
 	s.runner, err = manager.NewRunner(runnerConfig, true)
 	if err != nil {
-		return fmt.Errorf("template server failed to create: %w", err)
+		return &ConfigError{Err: fmt.Errorf("template server failed to create: %w", err)}
 	}
 
 	s.numberOfTemplates = len(s.runner.TemplateConfigMapping())
 
+	// renderedTemplates holds the IDs of the templates which have rendered at
+	// least once, so that the ones which never did can be reported if the
+	// initial render timeout expires. A nil channel never receives, so without
+	// a timeout Run waits for the initial render forever.
+	renderedTemplates := make(map[string]struct{}, s.numberOfTemplates)
+	var initialRenderTimeoutCh <-chan time.Time
+	initialRenderTimeout := s.config.AgentConfig.Exec.InitialRenderTimeout
+	if initialRenderTimeout > 0 {
+		timer := time.NewTimer(initialRenderTimeout)
+		defer timer.Stop()
+		initialRenderTimeoutCh = timer.C
+	}
+
+	// while the child process is running, complete renders are held back for
+	// the render quiet period, and only the latest of them may bounce it
+	quietPeriod := &renderQuietPeriod{duration: s.config.AgentConfig.Exec.RenderQuietPeriod}
+	defer quietPeriod.stop()
+
+	// with exec.render_once, the runner is stopped once the child process
+	// has been started, and new tokens no longer re-render the templates
+	renderedOnce := false
+
 	for {
 		select {
 		case <-ctx.Done():
 			s.runner.Stop()
-			if s.childProcess != nil {
-				s.childProcess.Stop()
-			}
-			s.childProcessState = childProcessStateStopped
+			s.stopChildProcess("shutdown")
 			return nil
 		case token := <-incomingVaultToken:
+			if renderedOnce {
+				continue
+			}
 			if token != *latestToken {
 				s.logger.Info("exec server received new token")
 
 				s.runner.Stop()
 				*latestToken = token
+				s.vaultToken = token
 				newTokenConfig := ctconfig.Config{
 					Vault: &ctconfig.VaultConfig{
 						Token:           latestToken,
@@ -145,7 +465,9 @@ func (s *Server) Run(ctx context.Context, incomingVaultToken chan string) error
 					},
 				}
 
-				// got a new auth token, merge it in with the existing config
+				// got a new auth token, merge it in with the existing config.
+				// The new runner will re-render all templates, but the child
+				// process is only bounced if the rendered contents changed
 				runnerConfig = runnerConfig.Merge(&newTokenConfig)
 				s.runner, err = manager.NewRunner(runnerConfig, true)
 				if err != nil {
@@ -156,23 +478,31 @@ func (s *Server) Run(ctx context.Context, incomingVaultToken chan string) error
 			}
 
 		case err := <-s.runner.ErrCh:
-			s.logger.Error("template server error", "error", err.Error())
+			s.logger.Error("template server error", "namespace", managerConfig.Namespace, "error", err.Error())
 			s.runner.StopImmediately()
 
 			// Return after stopping the runner if exit on retry failure was specified
 			if s.config.AgentConfig.TemplateConfig != nil && s.config.AgentConfig.TemplateConfig.ExitOnRetryFailure {
-				return fmt.Errorf("template server: %w", err)
+				return &TemplateRenderError{Err: err}
 			}
 
 			s.runner, err = manager.NewRunner(runnerConfig, true)
 			if err != nil {
-				return fmt.Errorf("template server failed to create: %w", err)
+				return &ConfigError{Err: fmt.Errorf("template server failed to create: %w", err)}
 			}
 			go s.runner.Start()
 		case <-s.runner.TemplateRenderedCh():
 			// A template has been rendered, figure out what to do
 			s.logger.Debug("template rendered")
 			events := s.runner.RenderEvents()
+			for id, event := range events {
+				if !event.LastWouldRender.IsZero() {
+					renderedTemplates[id] = struct{}{}
+				}
+			}
+			if len(renderedTemplates) >= s.numberOfTemplates {
+				initialRenderTimeoutCh = nil
+			}
 
 			// This checks if we've finished rendering the initial set of templates,
 			// for every consecutive re-render len(events) should equal s.numberOfTemplates
@@ -184,6 +514,7 @@ func (s *Server) Run(ctx context.Context, incomingVaultToken chan string) error
 			// assume the renders are finished, until we find otherwise
 			doneRendering := true
 			var renderedEnvVars []string
+			renderTimes := make(map[string]time.Time, len(events))
 			for _, event := range events {
 				// This template hasn't been rendered
 				if event.LastWouldRender.IsZero() {
@@ -191,88 +522,856 @@ func (s *Server) Run(ctx context.Context, incomingVaultToken chan string) error
 					break
 				} else {
 					for _, tcfg := range event.TemplateConfigs {
-						envVar := fmt.Sprintf("%s=%s", *tcfg.MapToEnvironmentVariable, event.Contents)
-						renderedEnvVars = append(renderedEnvVars, envVar)
+						name := *tcfg.MapToEnvironmentVariable
+						contents, err := config.TransformEnvTemplateContents(s.config.AgentConfig.EnvTemplateTransforms[name], string(event.Contents))
+						if err != nil {
+							return &ConfigError{Err: fmt.Errorf("env_template[%s]: %w", name, err)}
+						}
+						renderedEnvVars = append(renderedEnvVars, fmt.Sprintf("%s=%s", name, contents))
+						renderTimes[name] = event.LastWouldRender
 					}
 				}
 			}
 
 			if doneRendering {
-				s.logger.Debug("done rendering templates/detected change, bouncing process")
-				if err := s.bounceCmd(renderedEnvVars); err != nil {
-					return fmt.Errorf("unable to bounce command: %w", err)
+				// the order of render events is not stable, sort to compare
+				sort.Strings(renderedEnvVars)
+				s.recordRender(renderedEnvVars, renderTimes)
+				if quietPeriod.duration > 0 && s.childProcessState == ChildProcessStateRunning {
+					s.logger.Debug("done rendering templates, waiting for the render quiet period", "render_quiet_period", quietPeriod.duration)
+					quietPeriod.add(renderedEnvVars)
+					continue
 				}
+				if err := s.bounceOnRender(ctx, renderedEnvVars); err != nil {
+					return err
+				}
+
+				if s.config.DryRun {
+					s.runner.Stop()
+					return nil
+				}
+
+				if s.config.AgentConfig.Exec.RenderOnce && s.childProcessState == ChildProcessStateRunning {
+					s.logger.Info("rendered the env templates once, no longer watching them for changes")
+					s.runner.Stop()
+					renderedOnce = true
+				}
+			}
+		case <-quietPeriod.C():
+			if err := s.bounceOnRender(ctx, quietPeriod.take()); err != nil {
+				return err
 			}
+		case changed := <-watchedFilesCh:
+			if renderedOnce {
+				continue
+			}
+			if err := s.bounceOnFileChange(ctx, changed); err != nil {
+				return err
+			}
+		case sig := <-forwardedSignalCh:
+			if err := s.Signal(sig); err != nil {
+				s.logger.Error("failed to forward signal to process", "signal", sig, "error", err)
+			}
+		case <-initialRenderTimeoutCh:
+			s.runner.Stop()
+			unrendered := unrenderedTemplates(s.runner.TemplateConfigMapping(), renderedTemplates)
+			s.logger.Error("env templates did not render within the initial render timeout", "initial_render_timeout", initialRenderTimeout, "templates", unrendered)
+			return &TemplateRenderError{Err: fmt.Errorf("env templates did not render within %s: %s", initialRenderTimeout, strings.Join(unrendered, ", "))}
 		case exitCode := <-s.childProcessExitCh:
 			// process exited on its own
-			return &ProcessExitError{ExitCode: exitCode}
+			s.childProcessLock.Lock()
+			s.childProcessState = ChildProcessStateStopped
+			s.childProcessLastExitCode = &exitCode
+			s.childProcessUptime += time.Since(s.childProcessStartTime)
+			pid := s.childProcessPID
+			restartCount := s.childProcessRestartCount
+			uptime := s.childProcessUptime
+			s.childProcessLock.Unlock()
+			s.publish(Event{Type: EventChildExited, PID: pid, ExitCode: exitCode})
+
+			output := s.childProcessOutput.String()
+			if exitCode != 0 {
+				s.logger.Error("process exited", "exit_code", exitCode, "restart_count", restartCount, "total_uptime", uptime, "output", output)
+			}
+			return &ProcessExitError{
+				ExitCode:     exitCode,
+				Output:       output,
+				RestartCount: restartCount,
+				TotalUptime:  uptime,
+			}
+		case <-s.childProcessTimeoutCh:
+			timeout := s.config.AgentConfig.Exec.CommandTimeout
+			s.logger.Error("process did not exit within the command timeout, stopping it", "command_timeout", timeout, "process_id", s.childProcess.Pid())
+			s.stopChildProcess("command timeout")
+			return &ProcessTimeoutError{Timeout: timeout, Output: s.childProcessOutput.String()}
 		}
 	}
 }
 
-func (s *Server) bounceCmd(newEnvVars []string) error {
-	switch s.config.AgentConfig.Exec.RestartOnSecretChanges {
-	case "always":
-		if s.childProcessState == childProcessStateRunning {
+// bounceOnRender bounces the child process for a complete render's sorted
+// environment variables, unless shouldBounce declines it. The time the
+// bounce takes is measured, and a warning is logged if it's over the
+// exec.bounce_latency_budget
+func (s *Server) bounceOnRender(ctx context.Context, renderedEnvVars []string) error {
+	if !s.shouldBounce(renderedEnvVars) {
+		return nil
+	}
+
+	s.logger.Debug("done rendering templates/detected change, bouncing process")
+	if s.childProcessState == ChildProcessStateRunning {
+		s.publish(Event{
+			Type:           EventBounceTriggered,
+			PID:            s.childProcess.Pid(),
+			Reason:         "secrets changed",
+			ChangedEnvVars: changedEnvVars(s.lastRenderedEnvVars, renderedEnvVars),
+		})
+	}
+	start := time.Now()
+	if err := s.bounceCmd(ctx, renderedEnvVars); err != nil {
+		return bounceError(err)
+	}
+	metrics.MeasureSince([]string{"agent", "exec", "bounce_latency"}, start)
+
+	if budget := s.config.AgentConfig.Exec.BounceLatencyBudget; budget > 0 {
+		if latency := time.Since(start); latency > budget {
+			s.logger.Warn("bouncing the process took longer than the bounce latency budget", "latency", latency, "bounce_latency_budget", budget)
+		}
+	}
+
+	return nil
+}
+
+// bounceOnFileChange restarts the running child process, with the environment
+// it was started with, after the given exec.watch_files changed. The restart
+// policy decides whether it's restarted, and is passed the paths of the
+// changed files. Changes while no child process is running are ignored, as
+// the next child process reads the files when it starts anyway.
+func (s *Server) bounceOnFileChange(ctx context.Context, changed []string) error {
+	if s.childProcessState != ChildProcessStateRunning {
+		s.logger.Debug("watched files changed, but the process isn't running", "files", changed)
+		return nil
+	}
+
+	pid := s.childProcess.Pid()
+	if !s.restartPolicy.ShouldRestart(changed, s.lastExitCode(), s.childProcessState) {
+		s.logger.Info("detected change of watched files, but not restarting process", "process_id", pid, "files", changed)
+		return nil
+	}
+
+	s.logger.Info("watched files changed, bouncing process", "process_id", pid, "files", changed)
+	s.publish(Event{
+		Type:         EventBounceTriggered,
+		PID:          pid,
+		Reason:       "watched files changed",
+		ChangedFiles: changed,
+	})
+	if err := s.bounceCmd(ctx, s.lastRenderedEnvVars); err != nil {
+		return bounceError(err)
+	}
+
+	return nil
+}
+
+// bounceError returns the error Run returns for a failed bounce, a
+// *ConfigError as it is
+func bounceError(err error) error {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return configErr
+	}
+	return fmt.Errorf("unable to bounce command: %w", err)
+}
+
+// stopChildProcess stops the child process, if it was started, before Run
+// returns for the given reason. childProcessLock is only held to update the
+// state, so that Status and Signal don't block while the child process is
+// given time to stop.
+func (s *Server) stopChildProcess(reason string) {
+	if s.childProcess != nil {
+		pid := s.childProcess.Pid()
+		s.closeWatcher()
+		exitCode := s.stopCmd(s.childProcess)
+		if pid != 0 {
+			s.publish(Event{Type: EventChildStopped, PID: pid, Reason: reason, ExitCode: exitCode})
+		}
+	}
+
+	s.childProcessLock.Lock()
+	if s.childProcessState == ChildProcessStateRunning {
+		s.childProcessUptime += time.Since(s.childProcessStartTime)
+	}
+	s.childProcessState = ChildProcessStateStopped
+	s.childProcessLock.Unlock()
+}
+
+// unrenderedTemplates returns the sorted environment variable names of the
+// templates in the runner's template config mapping which haven't rendered yet
+func unrenderedTemplates(templateConfigMapping map[string][]*ctconfig.TemplateConfig, renderedTemplates map[string]struct{}) []string {
+	var names []string
+	for id, tcfgs := range templateConfigMapping {
+		if _, ok := renderedTemplates[id]; ok {
+			continue
+		}
+		for _, tcfg := range tcfgs {
+			names = append(names, *tcfg.MapToEnvironmentVariable)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Status returns a snapshot of the child process's current state
+func (s *Server) Status() Status {
+	s.childProcessLock.RLock()
+	defer s.childProcessLock.RUnlock()
+
+	status := Status{
+		State:         s.childProcessState.String(),
+		LastStartTime: s.childProcessStartTime,
+		RestartCount:  s.childProcessRestartCount,
+		LastExitCode:  s.childProcessLastExitCode,
+		KillCount:     s.childProcessKillCount,
+	}
+	if s.childProcess != nil && s.childProcessState == ChildProcessStateRunning {
+		status.PID = s.childProcess.Pid()
+	}
+	if len(s.envVarLastChanged) > 0 {
+		status.EnvVarsLastChanged = make(map[string]time.Time, len(s.envVarLastChanged))
+		for name, lastChanged := range s.envVarLastChanged {
+			status.EnvVarsLastChanged[name] = lastChanged
+		}
+	}
+
+	return status
+}
+
+// HandleStatus returns an http.Handler which responds with the exec server's
+// Status as JSON
+func (s *Server) HandleStatus() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			logical.RespondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Status()); err != nil {
+			s.logger.Error("failed to encode exec server status", "error", err)
+		}
+	})
+}
+
+// recordRender updates the time at which each environment variable last
+// changed, from a complete render's sorted environment variables and the
+// render time of each of them. Variables whose values are the same as in the
+// previous render keep their time, and removed variables are forgotten.
+func (s *Server) recordRender(renderedEnvVars []string, renderTimes map[string]time.Time) {
+	changed := changedEnvVars(s.previousRenderedEnvVars, renderedEnvVars)
+	s.previousRenderedEnvVars = renderedEnvVars
+	if len(changed) == 0 {
+		return
+	}
+
+	s.childProcessLock.Lock()
+	defer s.childProcessLock.Unlock()
+
+	if s.envVarLastChanged == nil {
+		s.envVarLastChanged = make(map[string]time.Time, len(renderedEnvVars))
+	}
+	for _, name := range changed {
+		renderTime, ok := renderTimes[name]
+		if !ok {
+			delete(s.envVarLastChanged, name)
+			continue
+		}
+		s.envVarLastChanged[name] = renderTime
+	}
+}
+
+// templateNamespace returns the namespace the env templates are rendered
+// against, exec.namespace if it's set, or the Agent's templating namespace
+func (s *Server) templateNamespace() string {
+	if ns := s.config.AgentConfig.Exec.Namespace; ns != "" {
+		return ns
+	}
+	return s.config.Namespace
+}
+
+// configuredRestartPolicy returns ServerConfig.RestartPolicy, or if it isn't
+// set, the policy for exec.restart_on_secret_changes
+func (s *Server) configuredRestartPolicy() (RestartPolicy, error) {
+	if s.config.RestartPolicy != nil {
+		return s.config.RestartPolicy, nil
+	}
+	return restartPolicyFromConfig(s.config.AgentConfig.Exec.RestartOnSecretChanges)
+}
+
+// shouldBounce reports whether the child process is started, or restarted,
+// for a complete render's sorted environment variables. A running child
+// process isn't restarted if the render is identical to the one it was
+// started with, e.g. after a token rotation, or if the restart policy
+// declines the change.
+func (s *Server) shouldBounce(renderedEnvVars []string) bool {
+	if s.childProcessState != ChildProcessStateRunning {
+		return true
+	}
+
+	if slices.Equal(renderedEnvVars, s.lastRenderedEnvVars) {
+		s.logger.Debug("done rendering templates, no changes detected, not bouncing process")
+		return false
+	}
+
+	changed := changedEnvVars(s.lastRenderedEnvVars, renderedEnvVars)
+	if !s.restartPolicy.ShouldRestart(changed, s.lastExitCode(), s.childProcessState) {
+		s.logger.Info("detected update, but not restarting process", "process_id", s.childProcess.Pid(), "changed", changed)
+		return false
+	}
+
+	return true
+}
+
+// lastExitCode returns the exit code of the previous child process, or -1 if
+// no child process has exited
+func (s *Server) lastExitCode() int {
+	s.childProcessLock.RLock()
+	defer s.childProcessLock.RUnlock()
+
+	if s.childProcessLastExitCode == nil {
+		return -1
+	}
+	return *s.childProcessLastExitCode
+}
+
+// recordStart updates the bookkeeping for the newly started childProcess, the
+// caller must hold childProcessLock
+func (s *Server) recordStart() {
+	if !s.childProcessStartTime.IsZero() {
+		s.childProcessRestartCount++
+	}
+	s.childProcessStartTime = time.Now()
+	s.childProcessPID = s.childProcess.Pid()
+}
+
+// Signal relays the given signal to the child process. It's used by the
+// command layer to forward a signal to the child when the Agent itself
+// receives SIGHUP, and by Run for the signals of exec.forward_signals. If the
+// child isn't running, e.g. because a restart is in progress, the signal is
+// dropped.
+func (s *Server) Signal(sig os.Signal) error {
+	s.childProcessLock.RLock()
+	defer s.childProcessLock.RUnlock()
+
+	if s.childProcess == nil || s.childProcessState != ChildProcessStateRunning {
+		s.logger.Debug("child process not running, not forwarding signal", "signal", sig)
+		return nil
+	}
+
+	s.logger.Info("forwarding signal to process", "signal", sig, "process_id", s.childProcess.Pid())
+	return s.childProcess.Signal(sig)
+}
+
+func (s *Server) bounceCmd(ctx context.Context, newEnvVars []string) error {
+	// the restart policy has already agreed to restart a running process
+	overlap := false
+	if s.childProcessState == ChildProcessStateRunning {
+		pid := s.childProcess.Pid()
+		s.publish(Event{Type: EventChildRestarting, PID: pid})
+		if s.config.AgentConfig.Exec.RestartStrategy == "overlap" {
+			// the old process is stopped once the new one is healthy
+			overlap = true
+		} else {
 			// process is running, need to kill it first
-			s.logger.Info("stopping process", "process_id", s.childProcess.Pid())
-			s.childProcessState = childProcessStateRestarting
-			s.childProcessExitCodeCloser()
-			s.childProcess.Stop()
+			s.logger.Info("stopping process", "process_id", pid)
+			s.childProcessLock.Lock()
+			s.childProcessState = ChildProcessStateRestarting
+			s.childProcessLock.Unlock()
+			s.closeWatcher()
+			exitCode := s.stopCmd(s.childProcess)
+			s.childProcessLock.Lock()
+			s.childProcessUptime += time.Since(s.childProcessStartTime)
+			s.childProcessLock.Unlock()
+			s.publish(Event{Type: EventChildStopped, PID: pid, Reason: "restart", ExitCode: exitCode})
 		}
-	case "never":
-		if s.childProcessState == childProcessStateRunning {
-			s.logger.Info("detected update, but not restarting process", "process_id", s.childProcess.Pid())
+	}
+
+	if delay := s.config.AgentConfig.Exec.StartupDelay; delay > 0 && !s.config.DryRun && s.childProcessState == ChildProcessStateNotStarted {
+		s.logger.Info("delaying initial start of process", "startup_delay", delay)
+		select {
+		case <-ctx.Done():
 			return nil
+		case <-time.After(delay):
 		}
-	default:
-		return fmt.Errorf("invalid value for restart-on-secret-changes: %q", s.config.AgentConfig.Exec.RestartOnSecretChanges)
 	}
 
-	args, subshell, err := child.CommandPrep(s.config.AgentConfig.Exec.Command)
+	// newEnvVars are kept as rendered, to compare with the next render
+	envVars := s.withStaticEnv(newEnvVars)
+
+	command, err := s.command()
 	if err != nil {
-		return fmt.Errorf("unable to parse command: %w", err)
+		return &ConfigError{Err: err}
+	}
+	renderedCommand := command
+	if s.config.AgentConfig.Exec.ArgTemplates {
+		renderedCommand, err = renderArgs(command, envVars)
+		if err != nil {
+			return &ConfigError{Err: fmt.Errorf("unable to render command arguments: %w", err)}
+		}
+	}
+
+	// exec.argv is already split into the program and its arguments, so it's
+	// passed on as it is, rather than through a shell
+	args, subshell := renderedCommand, false
+	if len(s.config.AgentConfig.Exec.Argv) == 0 {
+		args, subshell, err = child.CommandPrep(renderedCommand)
+		if err != nil {
+			return &ConfigError{Err: fmt.Errorf("unable to parse command: %w", err)}
+		}
 	}
 
+	if s.config.DryRun {
+		return s.printDryRun(command, args, envVars)
+	}
+
+	outputBufferSize := s.config.AgentConfig.Exec.OutputBufferSize
+	if outputBufferSize <= 0 {
+		outputBufferSize = defaultOutputBufferSize
+	}
+	output := newOutputBuffer(outputBufferSize)
+	env := append(s.inheritedEnv(), envVars...)
+	env = append(env, s.instanceEnv()...)
+	env = append(env, s.tokenEnv()...)
+	s.warnEnvSize(args, env)
+
 	childInput := &child.NewInput{
 		Stdin:        os.Stdin,
-		Stdout:       os.Stdout,
-		Stderr:       os.Stderr,
+		Stdout:       io.MultiWriter(os.Stdout, output),
+		Stderr:       io.MultiWriter(os.Stderr, output),
 		Command:      args[0],
 		Args:         args[1:],
-		Timeout:      0, // let it run forever
-		Env:          append(os.Environ(), newEnvVars...),
+		Timeout:      0, // the command timeout is enforced by watchCmd, so that Start doesn't block
+		Env:          env,
 		ReloadSignal: nil, // can't reload w/ new env vars
-		KillSignal:   s.config.AgentConfig.Exec.RestartStopSignal,
-		KillTimeout:  30 * time.Second,
+		KillSignal:   nil, // stopping, and escalating if needed, is handled by stopCmd
 		Splay:        0,
 		Setpgid:      subshell,
 		Logger:       s.logger.StandardLogger(nil),
 	}
 
-	proc, err := child.New(childInput)
+	var proc childProcess
+	if s.config.AgentConfig.Exec.AllocatePTY {
+		// the pty carries both stdout and stderr, the Agent's stdin isn't passed on
+		proc, err = newPTYChild(args, env, subshell, io.MultiWriter(os.Stdout, output), s.logger)
+	} else {
+		proc, err = s.newChild(childInput)
+	}
 	if err != nil {
-		return err
+		return &ConfigError{Err: err}
+	}
+
+	if overlap {
+		return s.overlapCmd(ctx, proc, output, env, newEnvVars)
+	}
+
+	// a child that failed to start is never made the current one, so the
+	// stopped one it was to replace, if any, is kept
+	s.childProcessLock.Lock()
+	if err := proc.Start(); err != nil {
+		s.childProcessLock.Unlock()
+		return fmt.Errorf("error starting child process: %w", err)
 	}
 	s.childProcess = proc
+	s.childProcessOutput = output
+	s.watchCmd(proc)
+	s.recordStart()
+	s.childProcessState = ChildProcessStateRunning
+	s.lastRenderedEnvVars = newEnvVars
+	pid := s.childProcessPID
+	s.childProcessLock.Unlock()
 
-	// listen if the child process exits and bubble it up to the main loop
-	go func() {
-		ctx, cancel := context.WithCancel(context.Background())
-		s.childProcessExitCodeCloser = cancel
+	s.publish(Event{Type: EventChildStarted, PID: pid})
+
+	return nil
+}
+
+// overlapCmd starts the new child process while the old one is still
+// running, and only stops the old process once the new one passes the
+// configured health check. If the health check fails, the new process is
+// stopped and the old one is kept running.
+func (s *Server) overlapCmd(ctx context.Context, proc childProcess, output *outputBuffer, env []string, newEnvVars []string) error {
+	s.logger.Info("starting new process before stopping the old one", "process_id", s.childProcess.Pid())
+	if err := proc.Start(); err != nil {
+		return fmt.Errorf("error starting child process: %w", err)
+	}
+
+	if err := s.waitForHealthy(ctx, proc, env); err != nil {
+		s.logger.Error("new process failed its health check, keeping the old process running", "process_id", proc.Pid(), "error", err)
+		s.stopCmd(proc)
+		return nil
+	}
+
+	// the old process may have exited while the health check was running,
+	// closing its watcher drops that exit, so it isn't taken for the new
+	// process's once the main loop resumes
+	oldProc := s.childProcess
+	oldStartTime := s.childProcessStartTime
+	s.closeWatcher()
+
+	s.childProcessLock.Lock()
+	s.childProcess = proc
+	s.childProcessOutput = output
+	s.watchCmd(proc)
+	s.recordStart()
+	s.lastRenderedEnvVars = newEnvVars
+	pid := s.childProcessPID
+	s.childProcessLock.Unlock()
+	s.publish(Event{Type: EventChildStarted, PID: pid})
+
+	oldPID := oldProc.Pid()
+	s.logger.Info("new process is healthy, stopping old process", "process_id", oldPID)
+	exitCode := s.stopCmd(oldProc)
+	s.childProcessLock.Lock()
+	s.childProcessUptime += time.Since(oldStartTime)
+	s.childProcessLock.Unlock()
+	if oldPID != 0 {
+		s.publish(Event{Type: EventChildStopped, PID: oldPID, Reason: "restart", ExitCode: exitCode})
+	}
+
+	return nil
+}
+
+// waitForHealthy runs the configured health check command until it succeeds,
+// the child process exits, or the health check timeout expires
+func (s *Server) waitForHealthy(ctx context.Context, proc childProcess, env []string) error {
+	healthCheck := s.config.AgentConfig.Exec.HealthCheckCommand
+	timeout := s.config.AgentConfig.Exec.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
 		select {
 		case exitCode := <-proc.ExitCh():
-			s.childProcessExitCh <- exitCode
-			return
+			return &ProcessExitError{ExitCode: exitCode}
+		default:
+		}
+
+		cmd := osexec.CommandContext(ctx, healthCheck[0], healthCheck[1:]...)
+		cmd.Env = env
+		err := cmd.Run()
+		if err == nil {
+			return nil
+		}
+		s.logger.Debug("health check failed", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("health check did not pass within %s: %w", timeout, err)
+		case <-time.After(healthCheckInterval):
+		}
+	}
+}
+
+// stopCmd stops the child process in two phases: it sends RestartStopSignal
+// and, if the process is still running after the kill timeout, escalates to
+// SIGKILL. Escalations are counted in the Status. It returns the process's exit
+// code, or 0 if it wasn't running.
+func (s *Server) stopCmd(proc childProcess) int {
+	exitCode := 0
+	// Pid is 0 if the process isn't running
+	if pid := proc.Pid(); pid != 0 {
+		exitCh := proc.ExitCh()
+		stopSignal := s.config.AgentConfig.Exec.RestartStopSignal
+		if stopSignal == nil {
+			stopSignal = syscall.SIGTERM
+		}
+		if err := proc.Signal(stopSignal); err != nil {
+			s.logger.Error("failed to send stop signal to process", "process_id", pid, "signal", stopSignal, "error", err)
+		}
+
+		killTimeout := s.killTimeout()
+		select {
+		case exitCode = <-exitCh:
+		case <-time.After(killTimeout):
+			s.childProcessLock.Lock()
+			s.childProcessKillCount++
+			s.childProcessLock.Unlock()
+
+			s.logger.Warn("process did not stop within the kill timeout, sending SIGKILL", "process_id", pid, "signal", stopSignal, "kill_timeout", killTimeout)
+			if err := proc.Signal(os.Kill); err != nil {
+				s.logger.Error("failed to kill process", "process_id", pid, "error", err)
+			}
+			exitCode = <-exitCh
+		}
+	}
+
+	// mark the child as stopped, so it doesn't report its exit
+	proc.Stop()
+	return exitCode
+}
+
+func (s *Server) killTimeout() time.Duration {
+	if timeout := s.config.AgentConfig.Exec.KillTimeout; timeout > 0 {
+		return timeout
+	}
+	return defaultKillTimeout
+}
+
+// watchFilesDebounce returns exec.watch_files_debounce, or the default if it
+// isn't set
+func (s *Server) watchFilesDebounce() time.Duration {
+	if debounce := s.config.AgentConfig.Exec.WatchFilesDebounce; debounce > 0 {
+		return debounce
+	}
+	return defaultWatchFilesDebounce
+}
+
+// closeWatcher closes the current child process's watcher, if one was
+// started. Closing it again does nothing
+func (s *Server) closeWatcher() {
+	if s.childProcessExitCodeCloser != nil {
+		s.childProcessExitCodeCloser()
+	}
+}
+
+// watchCmd listens for the child process exiting, or exceeding the command
+// timeout, and bubbles it up to the main loop. We need to start a different go-routine to watch the child
+// process each time we restart it, childProcessExitCodeCloser closes the
+// previous one so it doesn't leak.
+func (s *Server) watchCmd(proc childProcess) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.childProcessExitCodeCloser = cancel
+	exitCh := proc.ExitCh()
+
+	// a nil channel never receives, so the child runs forever without a timeout
+	var timeoutCh <-chan time.Time
+	var timer *time.Timer
+	if timeout := s.config.AgentConfig.Exec.CommandTimeout; timeout > 0 {
+		timer = time.NewTimer(timeout)
+		timeoutCh = timer.C
+	}
+
+	s.watchers.Add(1)
+	go func() {
+		defer s.watchers.Done()
+		if timer != nil {
+			defer timer.Stop()
+		}
+		// the sends are abandoned once the watcher is closed, as the main loop
+		// may no longer receive, e.g. because Run has returned
+		select {
+		case exitCode := <-exitCh:
+			select {
+			case s.childProcessExitCh <- exitCode:
+			case <-ctx.Done():
+			}
+		case <-timeoutCh:
+			select {
+			case s.childProcessTimeoutCh <- struct{}{}:
+			case <-ctx.Done():
+			}
 		case <-ctx.Done():
-			return
 		}
 	}()
+}
 
-	if err := s.childProcess.Start(); err != nil {
-		return fmt.Errorf("error starting child process: %w", err)
+// printDryRun writes the rendered environment variables and the prepared
+// command to the configured DryRunWriter instead of starting the child
+// process. command is the command before its arguments were rendered.
+func (s *Server) printDryRun(command []string, args []string, renderedEnvVars []string) error {
+	w := s.config.DryRunWriter
+	if w == nil {
+		w = os.Stdout
 	}
-	s.childProcessState = childProcessStateRunning
 
-	return nil
+	if s.config.DryRunRedact && s.config.AgentConfig.Exec.ArgTemplates {
+		// the args may contain rendered secrets, print them as configured
+		args = command
+	}
+
+	for _, kv := range renderedEnvVars {
+		if s.config.DryRunRedact {
+			name, _, _ := strings.Cut(kv, "=")
+			kv = name + "=<redacted>"
+		}
+		if _, err := fmt.Fprintln(w, kv); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(args, " "))
+	return err
+}
+
+// command returns exec.command, exec.argv if it's set, or the command read
+// from exec.command_file if it's set
+func (s *Server) command() ([]string, error) {
+	if path := s.config.AgentConfig.Exec.CommandFile; path != "" {
+		return readCommandFile(path)
+	}
+	if argv := s.config.AgentConfig.Exec.Argv; len(argv) > 0 {
+		return argv, nil
+	}
+	return s.config.AgentConfig.Exec.Command, nil
+}
+
+// readCommandFile reads a command from the file at path. The file's contents,
+// without surrounding whitespace, are the command, which is parsed like a
+// single string exec.command, so it's run through a shell if it has arguments.
+func readCommandFile(path string) ([]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read command file: %w", err)
+	}
+
+	command := strings.TrimSpace(string(contents))
+	if command == "" {
+		return nil, fmt.Errorf("command file %q is empty", path)
+	}
+	return []string{command}, nil
+}
+
+// inheritedEnv returns the subset of the Agent's environment that should be
+// passed on to the child process, according to the configured allowlist or
+// denylist. The rendered environment variables are appended separately and
+// are never filtered.
+func (s *Server) inheritedEnv() []string {
+	allowlist := s.config.AgentConfig.Exec.InheritEnvAllowlist
+	denylist := s.config.AgentConfig.Exec.InheritEnvDenylist
+
+	if len(allowlist) == 0 && len(denylist) == 0 {
+		return os.Environ()
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		switch {
+		case len(allowlist) > 0 && !slices.Contains(allowlist, name):
+			continue
+		case slices.Contains(denylist, name):
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	return env
+}
+
+// instanceEnv returns the environment variables which pass the next child
+// process its instance id, and the number of times it has been restarted, if
+// exec.instance_env is set. The first child process has a restart count of 0.
+func (s *Server) instanceEnv() []string {
+	execConfig := s.config.AgentConfig.Exec
+	if !execConfig.InstanceEnv {
+		return nil
+	}
+
+	instanceIDEnvVar := execConfig.InstanceIDEnvVar
+	if instanceIDEnvVar == "" {
+		instanceIDEnvVar = defaultInstanceIDEnvVar
+	}
+	restartCountEnvVar := execConfig.RestartCountEnvVar
+	if restartCountEnvVar == "" {
+		restartCountEnvVar = defaultRestartCountEnvVar
+	}
+
+	restartCount := 0
+	if !s.childProcessStartTime.IsZero() {
+		restartCount = s.childProcessRestartCount + 1
+	}
+
+	return []string{
+		fmt.Sprintf("%s=%s", instanceIDEnvVar, s.instanceID),
+		fmt.Sprintf("%s=%d", restartCountEnvVar, restartCount),
+	}
+}
+
+// tokenEnv returns the environment variable with the Agent's latest Vault
+// token, when exec.inject_token is set, for a child process which is itself a
+// Vault client. It overrides any other value of the variable. The child
+// process keeps the token it was started with, a rotated token is passed to
+// the next child process, e.g. when changed secrets restart it.
+func (s *Server) tokenEnv() []string {
+	execConfig := s.config.AgentConfig.Exec
+	if !execConfig.InjectToken || s.vaultToken == "" {
+		return nil
+	}
+
+	tokenEnvVar := execConfig.TokenEnvVar
+	if tokenEnvVar == "" {
+		tokenEnvVar = defaultTokenEnvVar
+	}
+
+	return []string{fmt.Sprintf("%s=%s", tokenEnvVar, s.vaultToken)}
+}
+
+// withStaticEnv merges exec.static_env into the rendered environment
+// variables. When a name is in both, the rendered value is kept, unless
+// exec.static_env_precedence is "static". The result is sorted.
+func (s *Server) withStaticEnv(renderedEnvVars []string) []string {
+	staticEnv := s.config.AgentConfig.Exec.StaticEnv
+	if len(staticEnv) == 0 {
+		return renderedEnvVars
+	}
+	staticFirst := s.config.AgentConfig.Exec.StaticEnvPrecedence == "static"
+
+	values := make(map[string]string, len(staticEnv)+len(renderedEnvVars))
+	for name, value := range staticEnv {
+		values[name] = value
+	}
+	for _, kv := range renderedEnvVars {
+		name, value, _ := strings.Cut(kv, "=")
+		if _, ok := staticEnv[name]; ok && staticFirst {
+			continue
+		}
+		values[name] = value
+	}
+
+	envVars := make([]string, 0, len(values))
+	for name, value := range values {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(envVars)
+
+	return envVars
+}
+
+// renderArgs substitutes `{{ env "NAME" }}` placeholders in each element of
+// the command with the value of the matching rendered environment variable
+func renderArgs(command []string, renderedEnvVars []string) ([]string, error) {
+	values := make(map[string]string, len(renderedEnvVars))
+	for _, kv := range renderedEnvVars {
+		name, value, _ := strings.Cut(kv, "=")
+		values[name] = value
+	}
+
+	funcs := template.FuncMap{
+		"env": func(name string) (string, error) {
+			value, ok := values[name]
+			if !ok {
+				return "", fmt.Errorf("no env_template found for %q", name)
+			}
+			return value, nil
+		},
+	}
+
+	rendered := make([]string, 0, len(command))
+	for i, arg := range command {
+		tmpl, err := template.New(fmt.Sprintf("arg[%d]", i)).Funcs(funcs).Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		var b strings.Builder
+		if err := tmpl.Execute(&b, nil); err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, b.String())
+	}
+
+	return rendered, nil
 }
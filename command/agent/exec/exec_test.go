@@ -0,0 +1,1301 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/consul-template/child"
+	ctconfig "github.com/hashicorp/consul-template/config"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/sdk/helper/pointerutil"
+)
+
+// newTestServer returns a Server for the given exec config, which hasn't been
+// started
+func newTestServer(execConfig *config.ExecConfig) *Server {
+	return NewServer(&ServerConfig{
+		Logger:      hclog.NewNullLogger(),
+		AgentConfig: &config.Config{Exec: execConfig},
+	})
+}
+
+// fakeChild is a childProcess which doesn't start a process. It exits with
+// exitCode when it's sent os.Kill, or any signal if exitOnSignal is set. Start
+// fails with startErr if it's set.
+type fakeChild struct {
+	exitOnSignal bool
+	exitCode     int
+	startErr     error
+
+	lock    sync.Mutex
+	exitCh  chan int
+	signals []os.Signal
+	started bool
+	exited  bool
+	stopped bool
+}
+
+func newFakeChild() *fakeChild {
+	return &fakeChild{exitCh: make(chan int, 1)}
+}
+
+func (c *fakeChild) Start() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.startErr != nil {
+		return c.startErr
+	}
+	c.started = true
+	return nil
+}
+
+func (c *fakeChild) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stopped = true
+}
+
+func (c *fakeChild) Pid() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.started || c.exited {
+		return 0
+	}
+	return 1234
+}
+
+func (c *fakeChild) Signal(sig os.Signal) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.signals = append(c.signals, sig)
+	if !c.exited && (c.exitOnSignal || sig == os.Kill) {
+		c.exit(c.exitCode)
+	}
+	return nil
+}
+
+// exit makes the child exit with the given code, the caller must hold lock
+func (c *fakeChild) exit(code int) {
+	c.exited = true
+	c.exitCh <- code
+}
+
+// exitNow makes the child exit on its own with the given code
+func (c *fakeChild) exitNow(code int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.exit(code)
+}
+
+func (c *fakeChild) ExitCh() <-chan int {
+	return c.exitCh
+}
+
+func (c *fakeChild) receivedSignals() []os.Signal {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]os.Signal(nil), c.signals...)
+}
+
+// TestServer_inheritedEnv verifies which of the Agent's environment variables
+// are passed on to the child process with an allowlist, a denylist, or
+// neither of them
+func TestServer_inheritedEnv(t *testing.T) {
+	t.Setenv("EXEC_TEST_ALLOWED", "allowed")
+	t.Setenv("EXEC_TEST_DENIED", "denied")
+
+	cases := map[string]struct {
+		execConfig *config.ExecConfig
+		included   []string
+		excluded   []string
+	}{
+		"no lists": {
+			execConfig: &config.ExecConfig{},
+			included:   []string{"EXEC_TEST_ALLOWED=allowed", "EXEC_TEST_DENIED=denied"},
+		},
+		"allowlist": {
+			execConfig: &config.ExecConfig{InheritEnvAllowlist: []string{"EXEC_TEST_ALLOWED", "EXEC_TEST_MISSING"}},
+			included:   []string{"EXEC_TEST_ALLOWED=allowed"},
+			excluded:   []string{"EXEC_TEST_DENIED=denied"},
+		},
+		"denylist": {
+			execConfig: &config.ExecConfig{InheritEnvDenylist: []string{"EXEC_TEST_DENIED"}},
+			included:   []string{"EXEC_TEST_ALLOWED=allowed"},
+			excluded:   []string{"EXEC_TEST_DENIED=denied"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			env := newTestServer(tc.execConfig).inheritedEnv()
+			for _, kv := range tc.included {
+				require.Contains(t, env, kv)
+			}
+			for _, kv := range tc.excluded {
+				require.NotContains(t, env, kv)
+			}
+		})
+	}
+
+	// only the allowed variables are passed, the rest of the environment isn't
+	env := newTestServer(&config.ExecConfig{InheritEnvAllowlist: []string{"EXEC_TEST_ALLOWED"}}).inheritedEnv()
+	require.Equal(t, []string{"EXEC_TEST_ALLOWED=allowed"}, env)
+}
+
+// TestServer_recordRender verifies that the time an environment variable last
+// changed is only updated when its rendered value changes, not on every
+// render, and that removed variables are dropped from the status
+func TestServer_recordRender(t *testing.T) {
+	s := NewServer(&ServerConfig{Logger: hclog.NewNullLogger()})
+	require.Empty(t, s.Status().EnvVarsLastChanged)
+
+	first := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.recordRender([]string{"BAR=1", "FOO=1"}, map[string]time.Time{"BAR": first, "FOO": first})
+	require.Equal(t, map[string]time.Time{"BAR": first, "FOO": first}, s.Status().EnvVarsLastChanged)
+
+	// a re-render with the same contents, e.g. after a token rotation
+	second := first.Add(time.Minute)
+	s.recordRender([]string{"BAR=1", "FOO=1"}, map[string]time.Time{"BAR": second, "FOO": second})
+	require.Equal(t, map[string]time.Time{"BAR": first, "FOO": first}, s.Status().EnvVarsLastChanged)
+
+	third := second.Add(time.Minute)
+	s.recordRender([]string{"BAR=1", "FOO=2"}, map[string]time.Time{"BAR": third, "FOO": third})
+	require.Equal(t, map[string]time.Time{"BAR": first, "FOO": third}, s.Status().EnvVarsLastChanged)
+
+	fourth := third.Add(time.Minute)
+	s.recordRender([]string{"FOO=2"}, map[string]time.Time{"FOO": fourth})
+	require.Equal(t, map[string]time.Time{"FOO": third}, s.Status().EnvVarsLastChanged)
+}
+
+// TestServer_shouldBounce verifies that a running child process isn't
+// restarted when a re-render produces the same environment variables it was
+// started with, e.g. after a token rotation, but is when a value changes
+func TestServer_shouldBounce(t *testing.T) {
+	s := newTestServer(&config.ExecConfig{})
+	s.restartPolicy = AlwaysRestart{}
+
+	// the first complete render always starts the child process
+	require.True(t, s.shouldBounce([]string{"FOO=1"}))
+
+	proc := newFakeChild()
+	require.NoError(t, proc.Start())
+	s.childProcess = proc
+	s.childProcessState = ChildProcessStateRunning
+	s.lastRenderedEnvVars = []string{"BAR=1", "FOO=1"}
+
+	require.False(t, s.shouldBounce([]string{"BAR=1", "FOO=1"}))
+	require.True(t, s.shouldBounce([]string{"BAR=1", "FOO=2"}))
+	require.True(t, s.shouldBounce([]string{"FOO=1"}))
+
+	// a child process which isn't running is started even if nothing changed
+	s.childProcessState = ChildProcessStateStopped
+	require.True(t, s.shouldBounce([]string{"BAR=1", "FOO=1"}))
+}
+
+// TestRenderArgs verifies that `{{ env "NAME" }}` placeholders in the command
+// are substituted with the rendered values, and that unknown names and
+// invalid templates are errors
+func TestRenderArgs(t *testing.T) {
+	renderedEnvVars := []string{"PORT=8080", "URL=https://example.com/?a=b"}
+
+	cases := map[string]struct {
+		command  []string
+		expected []string
+		err      string
+	}{
+		"no placeholders": {
+			command:  []string{"app", "--verbose"},
+			expected: []string{"app", "--verbose"},
+		},
+		"placeholders": {
+			command:  []string{"app", `--port={{ env "PORT" }}`, `{{ env "URL" }}`},
+			expected: []string{"app", "--port=8080", "https://example.com/?a=b"},
+		},
+		"unknown name": {
+			command: []string{"app", `{{ env "MISSING" }}`},
+			err:     `no env_template found for "MISSING"`,
+		},
+		"invalid template": {
+			command: []string{"app", `{{ env "PORT" }`},
+			err:     "arg[1]",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rendered, err := renderArgs(tc.command, renderedEnvVars)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, rendered)
+		})
+	}
+}
+
+// TestServer_Signal verifies that a signal is only relayed to the child
+// process while it's running, and dropped before it starts or during a
+// restart
+func TestServer_Signal(t *testing.T) {
+	s := newTestServer(&config.ExecConfig{})
+
+	// no child process yet
+	require.NoError(t, s.Signal(syscall.SIGHUP))
+
+	proc := newFakeChild()
+	require.NoError(t, proc.Start())
+	s.childProcess = proc
+	s.childProcessState = ChildProcessStateRestarting
+	require.NoError(t, s.Signal(syscall.SIGHUP))
+	require.Empty(t, proc.receivedSignals())
+
+	s.childProcessState = ChildProcessStateRunning
+	require.NoError(t, s.Signal(syscall.SIGHUP))
+	require.Equal(t, []os.Signal{syscall.SIGHUP}, proc.receivedSignals())
+}
+
+// TestServer_printDryRun verifies the dry run output, and that redacting it
+// hides the rendered values, including those templated into the arguments
+func TestServer_printDryRun(t *testing.T) {
+	cases := map[string]struct {
+		redact       bool
+		argTemplates bool
+		expected     string
+	}{
+		"plain": {
+			expected: "BAR=secret\nFOO=s3cr3t\napp --verbose\n",
+		},
+		"redacted": {
+			redact:   true,
+			expected: "BAR=<redacted>\nFOO=<redacted>\napp --verbose\n",
+		},
+		"arg templates": {
+			argTemplates: true,
+			expected:     "BAR=secret\nFOO=s3cr3t\napp --token=s3cr3t\n",
+		},
+		"redacted arg templates": {
+			redact:       true,
+			argTemplates: true,
+			expected:     "BAR=<redacted>\nFOO=<redacted>\napp --token={{ env \"FOO\" }}\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			command := []string{"app", "--verbose"}
+			args := command
+			if tc.argTemplates {
+				command = []string{"app", `--token={{ env "FOO" }}`}
+				args = []string{"app", "--token=s3cr3t"}
+			}
+
+			var b strings.Builder
+			s := NewServer(&ServerConfig{
+				Logger: hclog.NewNullLogger(),
+				AgentConfig: &config.Config{Exec: &config.ExecConfig{
+					Command:      command,
+					ArgTemplates: tc.argTemplates,
+				}},
+				DryRun:       true,
+				DryRunRedact: tc.redact,
+				DryRunWriter: &b,
+			})
+
+			require.NoError(t, s.printDryRun(command, args, []string{"BAR=secret", "FOO=s3cr3t"}))
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+// TestServer_command verifies that the command is exec.command, or the
+// contents of exec.command_file when it's set, and that a missing or empty
+// command file is reported
+func TestServer_command(t *testing.T) {
+	dir := t.TempDir()
+	commandFile := dir + "/command"
+	require.NoError(t, os.WriteFile(commandFile, []byte("  app --verbose\n"), 0o600))
+	emptyFile := dir + "/empty"
+	require.NoError(t, os.WriteFile(emptyFile, []byte(" \n"), 0o600))
+
+	cases := map[string]struct {
+		execConfig *config.ExecConfig
+		expected   []string
+		err        string
+	}{
+		"command": {
+			execConfig: &config.ExecConfig{Command: []string{"app", "--verbose"}},
+			expected:   []string{"app", "--verbose"},
+		},
+		"argv": {
+			execConfig: &config.ExecConfig{Argv: []string{"/opt/my app/app", "--name", "a b"}},
+			expected:   []string{"/opt/my app/app", "--name", "a b"},
+		},
+		"command file": {
+			execConfig: &config.ExecConfig{CommandFile: commandFile},
+			expected:   []string{"app --verbose"},
+		},
+		"missing command file": {
+			execConfig: &config.ExecConfig{CommandFile: dir + "/missing"},
+			err:        "unable to read command file",
+		},
+		"empty command file": {
+			execConfig: &config.ExecConfig{CommandFile: emptyFile},
+			err:        "is empty",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			command, err := newTestServer(tc.execConfig).command()
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, command)
+		})
+	}
+}
+
+// TestServer_watchCmd verifies that the watcher reports the child process's
+// exit and command timeout to the main loop, and that a watcher which has
+// been closed doesn't report them, even if it was already waiting to
+func TestServer_watchCmd(t *testing.T) {
+	t.Run("exit", func(t *testing.T) {
+		s := newTestServer(&config.ExecConfig{})
+		proc := newFakeChild()
+		s.watchCmd(proc)
+
+		proc.exitNow(3)
+		select {
+		case exitCode := <-s.childProcessExitCh:
+			require.Equal(t, 3, exitCode)
+		case <-time.After(5 * time.Second):
+			t.Fatal("exit wasn't reported")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s := newTestServer(&config.ExecConfig{CommandTimeout: 10 * time.Millisecond})
+		s.watchCmd(newFakeChild())
+
+		select {
+		case <-s.childProcessTimeoutCh:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout wasn't reported")
+		}
+	})
+
+	t.Run("closed after exit", func(t *testing.T) {
+		s := newTestServer(&config.ExecConfig{})
+		proc := newFakeChild()
+		s.watchCmd(proc)
+
+		// the watcher is blocked reporting the exit while nothing receives
+		proc.exitNow(3)
+		time.Sleep(50 * time.Millisecond)
+		s.childProcessExitCodeCloser()
+
+		select {
+		case exitCode := <-s.childProcessExitCh:
+			t.Fatalf("closed watcher reported exit code %d", exitCode)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("closed after timeout", func(t *testing.T) {
+		s := newTestServer(&config.ExecConfig{CommandTimeout: 10 * time.Millisecond})
+		s.watchCmd(newFakeChild())
+
+		time.Sleep(50 * time.Millisecond)
+		s.childProcessExitCodeCloser()
+
+		select {
+		case <-s.childProcessTimeoutCh:
+			t.Fatal("closed watcher reported the timeout")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+// TestServer_bounceCmd verifies the child process's state transitions when
+// it's started, when it's restarted with a new environment, without the old
+// process's exit being reported, and when the new process fails to start
+func TestServer_bounceCmd(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(&config.ExecConfig{
+		Command:         []string{"app", "--verbose"},
+		RestartStrategy: "stop_start",
+		KillTimeout:     time.Second,
+	})
+	var children []*fakeChild
+	var inputs []*child.NewInput
+	s.newChild = func(input *child.NewInput) (childProcess, error) {
+		proc := newFakeChild()
+		proc.exitOnSignal = true
+		if len(children) == 2 {
+			proc.startErr = errors.New("start failed")
+		}
+		children = append(children, proc)
+		inputs = append(inputs, input)
+		return proc, nil
+	}
+
+	require.NoError(t, s.bounceCmd(ctx, []string{"FOO=1"}))
+	require.Equal(t, ChildProcessStateRunning, s.childProcessState)
+	require.Same(t, children[0], s.childProcess)
+	require.Equal(t, []string{"FOO=1"}, s.lastRenderedEnvVars)
+	require.Equal(t, "app", inputs[0].Command)
+	require.Equal(t, []string{"--verbose"}, inputs[0].Args)
+	require.Contains(t, inputs[0].Env, "FOO=1")
+
+	require.NoError(t, s.bounceCmd(ctx, []string{"FOO=2"}))
+	require.Equal(t, []os.Signal{syscall.SIGTERM}, children[0].receivedSignals())
+	require.True(t, children[0].stopped)
+	require.Equal(t, ChildProcessStateRunning, s.childProcessState)
+	require.Same(t, children[1], s.childProcess)
+	require.Equal(t, []string{"FOO=2"}, s.lastRenderedEnvVars)
+	require.Contains(t, inputs[1].Env, "FOO=2")
+	require.Equal(t, 1, s.Status().RestartCount)
+	require.Positive(t, s.childProcessUptime)
+	select {
+	case exitCode := <-s.childProcessExitCh:
+		t.Fatalf("exit code %d of the old process was reported", exitCode)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err := s.bounceCmd(ctx, []string{"FOO=3"})
+	require.ErrorContains(t, err, "error starting child process: start failed")
+	require.True(t, children[1].stopped)
+	require.Equal(t, ChildProcessStateRestarting, s.childProcessState)
+	require.Same(t, children[1], s.childProcess)
+	require.Equal(t, []string{"FOO=2"}, s.lastRenderedEnvVars)
+}
+
+// TestServer_bounceCmd_argv verifies that exec.argv is passed on to the child
+// process as it is, even if it's a single element with spaces, while such a
+// command is run through a shell
+func TestServer_bounceCmd_argv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are only run through a shell on unix")
+	}
+
+	for name, tc := range map[string]struct {
+		execConfig   *config.ExecConfig
+		wantCommand  string
+		wantArgs     []string
+		wantSubshell bool
+	}{
+		"argv": {
+			execConfig:  &config.ExecConfig{Argv: []string{"/opt/my app/bin/app"}},
+			wantCommand: "/opt/my app/bin/app",
+			wantArgs:    []string{},
+		},
+		"argv with arguments": {
+			execConfig:  &config.ExecConfig{Argv: []string{"/opt/my app/bin/app", "--name", "it's here"}},
+			wantCommand: "/opt/my app/bin/app",
+			wantArgs:    []string{"--name", "it's here"},
+		},
+		"command": {
+			execConfig:   &config.ExecConfig{Command: []string{"/opt/my app/bin/app"}},
+			wantArgs:     []string{"-c", "/opt/my app/bin/app"},
+			wantSubshell: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tc.execConfig.RestartStrategy = "stop_start"
+			s := newTestServer(tc.execConfig)
+			var input *child.NewInput
+			s.newChild = func(in *child.NewInput) (childProcess, error) {
+				input = in
+				return newFakeChild(), nil
+			}
+
+			require.NoError(t, s.bounceCmd(context.Background(), nil))
+			if tc.wantCommand != "" {
+				require.Equal(t, tc.wantCommand, input.Command)
+			}
+			require.Equal(t, tc.wantArgs, input.Args)
+			require.Equal(t, tc.wantSubshell, input.Setpgid)
+		})
+	}
+}
+
+// TestServer_bounceOnRender_latencyBudget verifies that the latency of a
+// bounce is measured, and that a warning is only logged when it's over the
+// bounce latency budget
+func TestServer_bounceOnRender_latencyBudget(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	metricsConfig := metrics.DefaultConfig("")
+	metricsConfig.EnableHostname = false
+	metricsConfig.EnableRuntimeMetrics = false
+	_, err := metrics.NewGlobal(metricsConfig, sink)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		metrics.NewGlobal(metrics.DefaultConfig(""), &metrics.BlackholeSink{})
+	})
+
+	var logs bytes.Buffer
+	s := NewServer(&ServerConfig{
+		Logger: hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Warn}),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{
+			Command:                []string{"app"},
+			RestartOnSecretChanges: "always",
+			RestartStrategy:        "stop_start",
+			RestartStopSignal:      syscall.SIGTERM,
+			KillTimeout:            200 * time.Millisecond,
+			BounceLatencyBudget:    100 * time.Millisecond,
+		}},
+	})
+	restartPolicy, err := s.configuredRestartPolicy()
+	require.NoError(t, err)
+	s.restartPolicy = restartPolicy
+	// the children ignore SIGTERM, so they're only stopped once the kill
+	// timeout has passed
+	s.newChild = func(*child.NewInput) (childProcess, error) {
+		return newFakeChild(), nil
+	}
+
+	require.NoError(t, s.bounceOnRender(context.Background(), []string{"FOO=1"}))
+	require.NotContains(t, logs.String(), "bounce latency budget")
+
+	require.NoError(t, s.bounceOnRender(context.Background(), []string{"FOO=2"}))
+	require.Contains(t, logs.String(), "bouncing the process took longer than the bounce latency budget")
+
+	var samples *metrics.SampledValue
+	for _, interval := range sink.Data() {
+		if sample, ok := interval.Samples["agent.exec.bounce_latency"]; ok {
+			samples = &sample
+		}
+	}
+	require.NotNil(t, samples)
+	require.Equal(t, 2, samples.Count)
+	require.GreaterOrEqual(t, samples.Max, float64(200))
+}
+
+// TestServer_bounceOnFileChange verifies that changed watched files restart
+// the running child process with the environment it was started with, if the
+// restart policy agrees, and that they're ignored before it has started
+func TestServer_bounceOnFileChange(t *testing.T) {
+	ctx := context.Background()
+	var events []Event
+	s := NewServer(&ServerConfig{
+		Logger: hclog.NewNullLogger(),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{
+			Command:         []string{"app"},
+			RestartStrategy: "stop_start",
+			KillTimeout:     time.Second,
+		}},
+		EventHandler: func(event Event) {
+			if event.Type == EventBounceTriggered {
+				event.Time = time.Time{}
+				events = append(events, event)
+			}
+		},
+	})
+	policy := &recordingPolicy{}
+	s.restartPolicy = policy
+	var inputs []*child.NewInput
+	s.newChild = func(input *child.NewInput) (childProcess, error) {
+		proc := newFakeChild()
+		proc.exitOnSignal = true
+		inputs = append(inputs, input)
+		return proc, nil
+	}
+
+	require.NoError(t, s.bounceOnFileChange(ctx, []string{"/etc/app.conf"}))
+	require.Zero(t, policy.calls)
+	require.Empty(t, inputs)
+
+	require.NoError(t, s.bounceCmd(ctx, []string{"FOO=1"}))
+	first := s.childProcess
+	require.NoError(t, s.bounceOnFileChange(ctx, []string{"/etc/app.conf"}))
+	require.Equal(t, 1, policy.calls)
+	require.Equal(t, []string{"/etc/app.conf"}, policy.changed)
+	require.Same(t, first, s.childProcess)
+	require.Empty(t, events)
+
+	policy.restart = true
+	require.NoError(t, s.bounceOnFileChange(ctx, []string{"/etc/app.conf"}))
+	require.NotSame(t, first, s.childProcess)
+	require.Len(t, inputs, 2)
+	require.Contains(t, inputs[1].Env, "FOO=1")
+	require.Equal(t, []string{"FOO=1"}, s.lastRenderedEnvVars)
+	require.Equal(t, []Event{{
+		Type:         EventBounceTriggered,
+		PID:          1234,
+		Reason:       "watched files changed",
+		ChangedFiles: []string{"/etc/app.conf"},
+	}}, events)
+}
+
+// TestServer_stopChildProcess_startFailed verifies that stopping the server
+// after its first child process failed to start, so before any child process
+// was watched, doesn't use the child that failed to start
+func TestServer_stopChildProcess_startFailed(t *testing.T) {
+	s := newTestServer(&config.ExecConfig{
+		Command:         []string{"app"},
+		RestartStrategy: "stop_start",
+	})
+	proc := newFakeChild()
+	proc.startErr = errors.New("start failed")
+	s.newChild = func(*child.NewInput) (childProcess, error) {
+		return proc, nil
+	}
+
+	require.ErrorContains(t, s.bounceCmd(context.Background(), []string{"FOO=1"}), "start failed")
+	require.Nil(t, s.childProcess)
+	require.Equal(t, 0, s.Status().PID)
+
+	s.stopChildProcess("shutdown")
+	require.False(t, proc.stopped)
+	require.Equal(t, ChildProcessStateStopped, s.childProcessState)
+}
+
+// TestServer_overlapCmd verifies that with the "overlap" restart strategy the
+// old child process is only stopped once the new one is healthy, and that an
+// exit of the old process during the health check isn't reported once the
+// new one has replaced it
+func TestServer_overlapCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("health check commands require a shell")
+	}
+
+	cases := map[string]struct {
+		healthCheck []string
+		oldExits    bool
+		healthy     bool
+	}{
+		"healthy": {
+			healthCheck: []string{"true"},
+			healthy:     true,
+		},
+		"old process exits during the health check": {
+			healthCheck: []string{"sh", "-c", "sleep 0.2"},
+			oldExits:    true,
+			healthy:     true,
+		},
+		"unhealthy": {
+			healthCheck: []string{"false"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(&config.ExecConfig{
+				RestartStrategy:    "overlap",
+				HealthCheckCommand: tc.healthCheck,
+				HealthCheckTimeout: time.Second,
+				KillTimeout:        time.Second,
+			})
+
+			oldProc := newFakeChild()
+			oldProc.exitOnSignal = true
+			require.NoError(t, oldProc.Start())
+			s.childProcess = oldProc
+			s.childProcessState = ChildProcessStateRunning
+			s.lastRenderedEnvVars = []string{"FOO=1"}
+			s.watchCmd(oldProc)
+			if tc.oldExits {
+				oldProc.exitNow(1)
+			}
+
+			newProc := newFakeChild()
+			newProc.exitOnSignal = true
+			err := s.overlapCmd(context.Background(), newProc, newOutputBuffer(defaultOutputBufferSize), nil, []string{"FOO=2"})
+			require.NoError(t, err)
+			require.Equal(t, ChildProcessStateRunning, s.childProcessState)
+
+			if !tc.healthy {
+				require.Same(t, oldProc, s.childProcess)
+				require.Equal(t, []string{"FOO=1"}, s.lastRenderedEnvVars)
+				require.Empty(t, oldProc.receivedSignals())
+				require.True(t, newProc.stopped)
+				return
+			}
+
+			require.Same(t, newProc, s.childProcess)
+			require.Equal(t, []string{"FOO=2"}, s.lastRenderedEnvVars)
+			require.True(t, oldProc.stopped)
+			require.False(t, newProc.stopped)
+			if !tc.oldExits {
+				require.Equal(t, []os.Signal{syscall.SIGTERM}, oldProc.receivedSignals())
+			}
+
+			select {
+			case exitCode := <-s.childProcessExitCh:
+				t.Fatalf("exit code %d of the old process was reported", exitCode)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// TestProcessExitError_Error verifies that the error tells a process which
+// exited on its first start apart from one which was restarted
+func TestProcessExitError_Error(t *testing.T) {
+	err := &ProcessExitError{ExitCode: 1, TotalUptime: 1500 * time.Microsecond}
+	require.EqualError(t, err, "process exited with 1 after running for 2ms")
+
+	err = &ProcessExitError{ExitCode: 2, RestartCount: 3, TotalUptime: 5 * time.Hour}
+	require.EqualError(t, err, "process exited with 2 after running for 5h0m0s, with 3 restarts")
+}
+
+// TestServer_Status verifies the status snapshot of the child process over
+// its lifecycle, and that it can be read while the child process is stopping
+func TestServer_Status(t *testing.T) {
+	s := newTestServer(&config.ExecConfig{KillTimeout: time.Second})
+	require.Equal(t, Status{State: "not_started"}, s.Status())
+
+	proc := newFakeChild()
+	require.NoError(t, proc.Start())
+	s.childProcess = proc
+	s.watchCmd(proc)
+	s.recordStart()
+	s.childProcessState = ChildProcessStateRunning
+
+	status := s.Status()
+	require.Equal(t, "running", status.State)
+	require.Equal(t, 1234, status.PID)
+	require.False(t, status.LastStartTime.IsZero())
+	require.Zero(t, status.RestartCount)
+	require.Nil(t, status.LastExitCode)
+
+	s.recordStart()
+	require.Equal(t, 1, s.Status().RestartCount)
+
+	// the child process ignores the stop signal, so stopping it takes until
+	// the kill timeout
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.stopChildProcess("shutdown")
+	}()
+
+	statusCh := make(chan Status)
+	go func() {
+		statusCh <- s.Status()
+	}()
+	select {
+	case <-statusCh:
+	case <-stopped:
+		t.Fatal("status was blocked while the child process was stopping")
+	}
+
+	<-stopped
+	status = s.Status()
+	require.Equal(t, "stopped", status.State)
+	require.Zero(t, status.PID)
+}
+
+// TestServer_events verifies that the child process's lifecycle events are
+// passed to the configured EventHandler, with the pid and the reason
+func TestServer_events(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("health check commands require a shell")
+	}
+
+	var events []Event
+	s := NewServer(&ServerConfig{
+		Logger: hclog.NewNullLogger(),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{
+			RestartStrategy:    "overlap",
+			HealthCheckCommand: []string{"true"},
+			KillTimeout:        time.Second,
+		}},
+		EventHandler: func(event Event) {
+			require.False(t, event.Time.IsZero())
+			event.Time = time.Time{}
+			events = append(events, event)
+		},
+	})
+
+	oldProc := newFakeChild()
+	oldProc.exitOnSignal = true
+	oldProc.exitCode = 143
+	require.NoError(t, oldProc.Start())
+	s.childProcess = oldProc
+	s.childProcessState = ChildProcessStateRunning
+	s.watchCmd(oldProc)
+
+	newProc := newFakeChild()
+	newProc.exitOnSignal = true
+	require.NoError(t, s.overlapCmd(context.Background(), newProc, newOutputBuffer(defaultOutputBufferSize), nil, []string{"FOO=2"}))
+	s.stopChildProcess("shutdown")
+
+	require.Equal(t, []Event{
+		{Type: EventChildStarted, PID: 1234},
+		{Type: EventChildStopped, PID: 1234, Reason: "restart", ExitCode: 143},
+		{Type: EventChildStopped, PID: 1234, Reason: "shutdown"},
+	}, events)
+}
+
+// TestServer_bounceCmd_events verifies the events published when the child
+// process is started, and when it's restarted with the stop_start strategy
+func TestServer_bounceCmd_events(t *testing.T) {
+	var events []Event
+	s := NewServer(&ServerConfig{
+		Logger: hclog.NewNullLogger(),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{
+			Command:         []string{"app"},
+			RestartStrategy: "stop_start",
+			KillTimeout:     time.Second,
+		}},
+		EventHandler: func(event Event) {
+			event.Time = time.Time{}
+			events = append(events, event)
+		},
+	})
+	s.newChild = func(*child.NewInput) (childProcess, error) {
+		proc := newFakeChild()
+		proc.exitOnSignal = true
+		proc.exitCode = 143
+		return proc, nil
+	}
+
+	require.NoError(t, s.bounceCmd(context.Background(), []string{"FOO=1"}))
+	require.NoError(t, s.bounceCmd(context.Background(), []string{"FOO=2"}))
+
+	require.Equal(t, []Event{
+		{Type: EventChildStarted, PID: 1234},
+		{Type: EventChildRestarting, PID: 1234},
+		{Type: EventChildStopped, PID: 1234, Reason: "restart", ExitCode: 143},
+		{Type: EventChildStarted, PID: 1234},
+	}, events)
+}
+
+// TestServer_HandleStatus verifies that the status endpoint responds with the
+// status as JSON, and only to GET requests
+func TestServer_HandleStatus(t *testing.T) {
+	s := newTestServer(&config.ExecConfig{})
+	exitCode := 2
+	s.childProcessState = ChildProcessStateStopped
+	s.childProcessLastExitCode = &exitCode
+	s.childProcessRestartCount = 3
+
+	w := httptest.NewRecorder()
+	s.HandleStatus().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/agent/v1/exec-status", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var status Status
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	require.Equal(t, s.Status(), status)
+
+	w = httptest.NewRecorder()
+	s.HandleStatus().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/v1/exec-status", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+// TestServer_stopCmd verifies that the child process is sent the configured
+// stop signal, and that it's only killed, and the kill counted in the status,
+// if it doesn't stop within the kill timeout
+func TestServer_stopCmd(t *testing.T) {
+	cases := map[string]struct {
+		stopSignal   os.Signal
+		exitOnSignal bool
+		expected     []os.Signal
+		killCount    int
+	}{
+		"stops": {
+			exitOnSignal: true,
+			expected:     []os.Signal{syscall.SIGTERM},
+		},
+		"stops with the configured signal": {
+			stopSignal:   syscall.SIGINT,
+			exitOnSignal: true,
+			expected:     []os.Signal{syscall.SIGINT},
+		},
+		"ignores the stop signal": {
+			expected:  []os.Signal{syscall.SIGTERM, os.Kill},
+			killCount: 1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(&config.ExecConfig{
+				RestartStopSignal: tc.stopSignal,
+				KillTimeout:       100 * time.Millisecond,
+			})
+
+			proc := newFakeChild()
+			proc.exitOnSignal = tc.exitOnSignal
+			require.NoError(t, proc.Start())
+
+			s.stopCmd(proc)
+			require.Equal(t, tc.expected, proc.receivedSignals())
+			require.True(t, proc.stopped)
+			require.Equal(t, tc.killCount, s.Status().KillCount)
+		})
+	}
+}
+
+// recordingPolicy is a RestartPolicy which records what it's consulted with
+type recordingPolicy struct {
+	restart  bool
+	changed  []string
+	lastExit int
+	state    ChildProcessState
+	calls    int
+}
+
+func (p *recordingPolicy) ShouldRestart(changed []string, lastExit int, state ChildProcessState) bool {
+	p.calls++
+	p.changed = changed
+	p.lastExit = lastExit
+	p.state = state
+	return p.restart
+}
+
+// TestRestartPolicies verifies the built-in policies, and which of them is
+// chosen for each restart_on_secret_changes value
+func TestRestartPolicies(t *testing.T) {
+	cases := map[string]struct {
+		restartOnSecretChanges string
+		expected               RestartPolicy
+		restart                bool
+		err                    string
+	}{
+		"always": {
+			restartOnSecretChanges: "always",
+			expected:               AlwaysRestart{},
+			restart:                true,
+		},
+		"never": {
+			restartOnSecretChanges: "never",
+			expected:               NeverRestart{},
+		},
+		"invalid": {
+			restartOnSecretChanges: "sometimes",
+			err:                    `invalid value for restart-on-secret-changes: "sometimes"`,
+		},
+		"empty": {
+			err: `invalid value for restart-on-secret-changes: ""`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			policy, err := restartPolicyFromConfig(tc.restartOnSecretChanges)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, policy)
+
+			for _, state := range []ChildProcessState{ChildProcessStateRunning, ChildProcessStateStopped} {
+				require.Equal(t, tc.restart, policy.ShouldRestart([]string{"FOO"}, -1, state))
+				require.Equal(t, tc.restart, policy.ShouldRestart(nil, 1, state))
+			}
+		})
+	}
+}
+
+// TestChangedEnvVars verifies the names reported as changed between renders
+func TestChangedEnvVars(t *testing.T) {
+	cases := map[string]struct {
+		old      []string
+		new      []string
+		expected []string
+	}{
+		"first render": {
+			new:      []string{"FOO=1", "BAR=1"},
+			expected: []string{"BAR", "FOO"},
+		},
+		"unchanged": {
+			old: []string{"BAR=1", "FOO=1"},
+			new: []string{"BAR=1", "FOO=1"},
+		},
+		"changed": {
+			old:      []string{"BAR=1", "FOO=1"},
+			new:      []string{"BAR=1", "FOO=2"},
+			expected: []string{"FOO"},
+		},
+		"added and removed": {
+			old:      []string{"BAR=1", "FOO=1"},
+			new:      []string{"BAZ=1", "FOO=1"},
+			expected: []string{"BAR", "BAZ"},
+		},
+		"values with =": {
+			old:      []string{"FOO=a=b"},
+			new:      []string{"FOO=a=c"},
+			expected: []string{"FOO"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, changedEnvVars(tc.old, tc.new))
+		})
+	}
+}
+
+// TestServer_restartPolicy verifies that ServerConfig.RestartPolicy takes
+// precedence over restart_on_secret_changes, that Run rejects an invalid
+// policy, and that the policy is consulted with the changes of a render
+func TestServer_restartPolicy(t *testing.T) {
+	custom := &recordingPolicy{}
+
+	cases := map[string]struct {
+		restartOnSecretChanges string
+		restartPolicy          RestartPolicy
+		expected               RestartPolicy
+		err                    bool
+	}{
+		"from config": {
+			restartOnSecretChanges: "never",
+			expected:               NeverRestart{},
+		},
+		"custom": {
+			restartOnSecretChanges: "never",
+			restartPolicy:          custom,
+			expected:               custom,
+		},
+		"custom with invalid config": {
+			restartOnSecretChanges: "sometimes",
+			restartPolicy:          custom,
+			expected:               custom,
+		},
+		"invalid config": {
+			restartOnSecretChanges: "sometimes",
+			err:                    true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := NewServer(&ServerConfig{
+				Logger: hclog.NewNullLogger(),
+				AgentConfig: &config.Config{
+					EnvTemplates: []*ctconfig.TemplateConfig{{MapToEnvironmentVariable: pointerutil.StringPtr("FOO")}},
+					Exec:         &config.ExecConfig{RestartOnSecretChanges: tc.restartOnSecretChanges},
+				},
+				RestartPolicy: tc.restartPolicy,
+			})
+
+			policy, err := s.configuredRestartPolicy()
+			if tc.err {
+				require.Error(t, err)
+
+				var configErr *ConfigError
+				require.True(t, errors.As(s.Run(context.Background(), nil), &configErr))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, policy)
+		})
+	}
+
+	t.Run("consulted on change", func(t *testing.T) {
+		s := newTestServer(&config.ExecConfig{})
+		s.restartPolicy = custom
+
+		proc := newFakeChild()
+		require.NoError(t, proc.Start())
+		s.childProcess = proc
+		s.childProcessState = ChildProcessStateRunning
+		s.lastRenderedEnvVars = []string{"BAR=1", "FOO=1"}
+		exitCode := 2
+		s.childProcessLastExitCode = &exitCode
+
+		// an identical render doesn't consult the policy
+		require.False(t, s.shouldBounce([]string{"BAR=1", "FOO=1"}))
+		require.Zero(t, custom.calls)
+
+		require.False(t, s.shouldBounce([]string{"BAR=1", "FOO=2"}))
+		require.Equal(t, 1, custom.calls)
+		require.Equal(t, []string{"FOO"}, custom.changed)
+		require.Equal(t, 2, custom.lastExit)
+		require.Equal(t, ChildProcessStateRunning, custom.state)
+
+		custom.restart = true
+		require.True(t, s.shouldBounce([]string{"BAR=1", "FOO=2"}))
+		require.Equal(t, 2, custom.calls)
+	})
+}
+
+// TestUnrenderedTemplates verifies that the environment variable names of the
+// templates which haven't rendered are reported sorted, including every name
+// of a template shared by several env_template entries
+func TestUnrenderedTemplates(t *testing.T) {
+	mapping := map[string][]*ctconfig.TemplateConfig{
+		"a": {{MapToEnvironmentVariable: pointerutil.StringPtr("FOO")}},
+		"b": {
+			{MapToEnvironmentVariable: pointerutil.StringPtr("QUX")},
+			{MapToEnvironmentVariable: pointerutil.StringPtr("BAR")},
+		},
+		"c": {{MapToEnvironmentVariable: pointerutil.StringPtr("BAZ")}},
+	}
+
+	require.Equal(t, []string{"BAR", "BAZ", "FOO", "QUX"}, unrenderedTemplates(mapping, map[string]struct{}{}))
+	require.Equal(t, []string{"BAR", "QUX"}, unrenderedTemplates(mapping, map[string]struct{}{"a": {}, "c": {}}))
+	require.Empty(t, unrenderedTemplates(mapping, map[string]struct{}{"a": {}, "b": {}, "c": {}}))
+}
+
+// TestNewServer_name verifies that the exec server's logs are tagged with
+// exec.name when it's set
+func TestNewServer_name(t *testing.T) {
+	var b strings.Builder
+	s := NewServer(&ServerConfig{
+		Logger:      hclog.New(&hclog.LoggerOptions{Output: &b}),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{Name: "app"}},
+	})
+	s.logger.Info("starting")
+	require.Contains(t, b.String(), "exec_name=app")
+
+	b.Reset()
+	s = NewServer(&ServerConfig{
+		Logger:      hclog.New(&hclog.LoggerOptions{Output: &b}),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{}},
+	})
+	s.logger.Info("starting")
+	require.NotContains(t, b.String(), "exec_name")
+}
+
+// TestServer_templateNamespace verifies that exec.namespace overrides the
+// Agent's templating namespace
+func TestServer_templateNamespace(t *testing.T) {
+	s := NewServer(&ServerConfig{
+		Logger:      hclog.NewNullLogger(),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{}},
+		Namespace:   "agent/",
+	})
+	require.Equal(t, "agent/", s.templateNamespace())
+
+	s.config.AgentConfig.Exec.Namespace = "team-a/"
+	require.Equal(t, "team-a/", s.templateNamespace())
+}
+
+// TestServer_instanceEnv verifies that the instance id and restart count are
+// only passed to the child process when exec.instance_env is set, with the
+// configured or default names, and that the restart count is the number of
+// restarts before the next child process
+func TestServer_instanceEnv(t *testing.T) {
+	require.Nil(t, newTestServer(&config.ExecConfig{}).instanceEnv())
+
+	s := newTestServer(&config.ExecConfig{InstanceEnv: true})
+	s.instanceID = "id"
+	require.Equal(t, []string{"VAULT_EXEC_INSTANCE_ID=id", "VAULT_EXEC_RESTART_COUNT=0"}, s.instanceEnv())
+
+	s = newTestServer(&config.ExecConfig{
+		InstanceEnv:        true,
+		InstanceIDEnvVar:   "APP_ID",
+		RestartCountEnvVar: "APP_RESTARTS",
+	})
+	s.instanceID = "id"
+	s.childProcess = newFakeChild()
+	s.recordStart()
+	require.Equal(t, []string{"APP_ID=id", "APP_RESTARTS=1"}, s.instanceEnv())
+	s.recordStart()
+	require.Equal(t, []string{"APP_ID=id", "APP_RESTARTS=2"}, s.instanceEnv())
+}
+
+// TestServer_tokenEnv verifies that the latest Vault token is only passed to
+// the child process when exec.inject_token is set, in the configured
+// variable, that it overrides an inherited value, and that it isn't logged
+func TestServer_tokenEnv(t *testing.T) {
+	s := newTestServer(&config.ExecConfig{})
+	s.vaultToken = "hvs.token"
+	require.Nil(t, s.tokenEnv())
+
+	s = newTestServer(&config.ExecConfig{InjectToken: true})
+	require.Nil(t, s.tokenEnv())
+	s.vaultToken = "hvs.token"
+	require.Equal(t, []string{"VAULT_TOKEN=hvs.token"}, s.tokenEnv())
+
+	t.Setenv("APP_VAULT_TOKEN", "inherited")
+	var logs bytes.Buffer
+	s = NewServer(&ServerConfig{
+		Logger: hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Trace}),
+		AgentConfig: &config.Config{Exec: &config.ExecConfig{
+			Command:         []string{"app"},
+			RestartStrategy: "stop_start",
+			InjectToken:     true,
+			TokenEnvVar:     "APP_VAULT_TOKEN",
+		}},
+	})
+	var inputs []*child.NewInput
+	s.newChild = func(input *child.NewInput) (childProcess, error) {
+		proc := newFakeChild()
+		proc.exitOnSignal = true
+		inputs = append(inputs, input)
+		return proc, nil
+	}
+	s.vaultToken = "hvs.token"
+	require.NoError(t, s.bounceCmd(context.Background(), []string{"FOO=1"}))
+	s.vaultToken = "hvs.rotated"
+	require.NoError(t, s.bounceCmd(context.Background(), []string{"FOO=2"}))
+
+	require.Equal(t, "APP_VAULT_TOKEN=hvs.token", inputs[0].Env[len(inputs[0].Env)-1])
+	require.Equal(t, "APP_VAULT_TOKEN=hvs.rotated", inputs[1].Env[len(inputs[1].Env)-1])
+	require.NotContains(t, logs.String(), "hvs.")
+}
+
+// TestServer_withStaticEnv verifies how exec.static_env is merged with the
+// rendered environment variables for each exec.static_env_precedence
+func TestServer_withStaticEnv(t *testing.T) {
+	rendered := []string{"FOO=rendered", "URL=a=b"}
+	staticEnv := map[string]string{"FOO": "static", "MODE": "production"}
+
+	cases := map[string]struct {
+		staticEnv  map[string]string
+		precedence string
+		expected   []string
+	}{
+		"no static env": {
+			precedence: "template",
+			expected:   rendered,
+		},
+		"template precedence": {
+			staticEnv:  staticEnv,
+			precedence: "template",
+			expected:   []string{"FOO=rendered", "MODE=production", "URL=a=b"},
+		},
+		"static precedence": {
+			staticEnv:  staticEnv,
+			precedence: "static",
+			expected:   []string{"FOO=static", "MODE=production", "URL=a=b"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(&config.ExecConfig{
+				StaticEnv:           tc.staticEnv,
+				StaticEnvPrecedence: tc.precedence,
+			})
+			require.Equal(t, tc.expected, s.withStaticEnv(rendered))
+		})
+	}
+
+	// the rendered environment variables are kept as they are, to compare
+	// them with the next render
+	require.Equal(t, []string{"FOO=rendered", "URL=a=b"}, rendered)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import "sync"
+
+// defaultOutputBufferSize is the number of bytes of the child's output kept
+// for diagnostics when exec.output_buffer_size isn't set
+const defaultOutputBufferSize = 4096
+
+// outputBuffer is an io.Writer which keeps only the last size bytes written
+// to it. It's safe for concurrent use, as the child's stdout and stderr are
+// both written to the same buffer.
+type outputBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func newOutputBuffer(size int) *outputBuffer {
+	return &outputBuffer{
+		size: size,
+		buf:  make([]byte, 0, size),
+	}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if n >= b.size {
+		b.buf = append(b.buf[:0], p[n-b.size:]...)
+		return n, nil
+	}
+
+	if overflow := len(b.buf) + n - b.size; overflow > 0 {
+		b.buf = append(b.buf[:0], b.buf[overflow:]...)
+	}
+	b.buf = append(b.buf, p...)
+
+	return n, nil
+}
+
+// String returns the buffered output
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return string(b.buf)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestOutputBuffer verifies that only the last size bytes written are kept,
+// whether the buffer wraps around over several writes or a single write is
+// larger than the buffer
+func TestOutputBuffer(t *testing.T) {
+	cases := map[string]struct {
+		writes   []string
+		expected string
+	}{
+		"empty": {
+			expected: "",
+		},
+		"fits": {
+			writes:   []string{"ab", "cd"},
+			expected: "abcd",
+		},
+		"exactly full": {
+			writes:   []string{"abc", "de"},
+			expected: "abcde",
+		},
+		"wraps around": {
+			writes:   []string{"abc", "def", "gh"},
+			expected: "defgh",
+		},
+		"single write larger than the buffer": {
+			writes:   []string{"ab", "cdefghij"},
+			expected: "fghij",
+		},
+		"single write of the buffer size": {
+			writes:   []string{"ab", "cdefg"},
+			expected: "cdefg",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := newOutputBuffer(5)
+			for _, w := range tc.writes {
+				n, err := b.Write([]byte(w))
+				require.NoError(t, err)
+				require.Equal(t, len(w), n)
+			}
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build freebsd
+
+package exec
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func openPTYMaster() (*os.File, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_POSIX_OPENPT, uintptr(unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC), 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("posix_openpt: %w", errno)
+	}
+
+	return os.NewFile(fd, "/dev/ptmx"), nil
+}
+
+// ptsName returns the path of the slave side of the pty, which doesn't need
+// to be unlocked on FreeBSD
+func ptsName(master *os.File) (string, error) {
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		return "", fmt.Errorf("unable to get pty number: %w", err)
+	}
+
+	return fmt.Sprintf("/dev/pts/%d", n), nil
+}
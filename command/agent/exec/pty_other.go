@@ -0,0 +1,20 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux && !darwin && !freebsd
+
+package exec
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// newPTYChild isn't supported on this platform, exec.allocate_pty is rejected
+// when the config is validated
+func newPTYChild(args []string, env []string, subshell bool, output io.Writer, logger hclog.Logger) (childProcess, error) {
+	return nil, fmt.Errorf("allocating a pty is not supported on %s", runtime.GOOS)
+}
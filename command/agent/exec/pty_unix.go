@@ -0,0 +1,211 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build linux || darwin || freebsd
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// ptyDrainTimeout is how long the output of an exited child process is still
+// copied from its pty, e.g. when a process it started keeps the pty open
+const ptyDrainTimeout = time.Second
+
+// openPTY allocates a pseudo-terminal, and returns its master side, which
+// the child's output is read from, and its slave side, which the child is
+// attached to
+func openPTY() (*os.File, *os.File, error) {
+	master, err := openPTYMaster()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name, err := ptsName(master)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+// copyPTYOutput copies the child process's output from the master side of its
+// pty to w, until reading fails because the slave side has been closed
+func copyPTYOutput(master *os.File, w io.Writer, logger hclog.Logger) {
+	// reading fails with EIO once the slave side is closed, which is expected,
+	// and with ErrClosed if the pty is closed while the output is copied
+	if _, err := io.Copy(w, master); err != nil && !errors.Is(err, syscall.EIO) && !errors.Is(err, os.ErrClosed) {
+		logger.Error("failed to copy process output from pty", "error", err)
+	}
+}
+
+// ptyChild is a child process attached to a pty, which is its controlling
+// terminal. consul-template's child can't set a controlling terminal, so the
+// process is started directly, in its own session.
+type ptyChild struct {
+	args     []string
+	env      []string
+	subshell bool
+	output   io.Writer
+	logger   hclog.Logger
+
+	// lock guards cmd, exited and stopped
+	lock    sync.RWMutex
+	cmd     *osexec.Cmd
+	exitCh  chan int
+	exited  bool
+	stopped bool
+}
+
+func newPTYChild(args []string, env []string, subshell bool, output io.Writer, logger hclog.Logger) (childProcess, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing command")
+	}
+
+	return &ptyChild{
+		args:     args,
+		env:      env,
+		subshell: subshell,
+		output:   output,
+		logger:   logger,
+		exitCh:   make(chan int, 1),
+	}, nil
+}
+
+// Start allocates the pty and starts the child process attached to it. The
+// pty is closed once the child process has exited and its output is copied
+func (c *ptyChild) Start() error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return fmt.Errorf("unable to allocate a pty: %w", err)
+	}
+	// the child process has its own copy of the slave once started
+	defer slave.Close()
+
+	cmd := osexec.Command(c.args[0], c.args[1:]...)
+	cmd.Env = c.env
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    0, // stdin, in the child
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return err
+	}
+	c.cmd = cmd
+
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		copyPTYOutput(master, c.output, c.logger)
+	}()
+
+	go func() {
+		code := 0
+		if err := cmd.Wait(); err != nil {
+			code = 1
+			var exitErr *osexec.ExitError
+			if errors.As(err, &exitErr) {
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+					code = status.ExitStatus()
+				}
+			}
+		}
+
+		select {
+		case <-copied:
+		case <-time.After(ptyDrainTimeout):
+		}
+		master.Close()
+
+		c.lock.Lock()
+		c.exited = true
+		stopped := c.stopped
+		c.lock.Unlock()
+
+		// like consul-template's child, a stopped process doesn't report its exit
+		if !stopped {
+			c.exitCh <- code
+		}
+		close(c.exitCh)
+	}()
+
+	return nil
+}
+
+// Stop kills the child process if it's still running, and stops it from
+// reporting its exit
+func (c *ptyChild) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stopped = true
+	if c.cmd != nil && !c.exited {
+		c.signal(os.Kill)
+	}
+}
+
+// Pid returns the pid of the child process, or 0 if it isn't running
+func (c *ptyChild) Pid() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.cmd == nil || c.exited {
+		return 0
+	}
+	return c.cmd.Process.Pid
+}
+
+// Signal sends the signal to the child process, or to its process group if
+// it was started through a shell
+func (c *ptyChild) Signal(sig os.Signal) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.cmd == nil || c.exited {
+		return nil
+	}
+	return c.signal(sig)
+}
+
+func (c *ptyChild) signal(sig os.Signal) error {
+	if !c.subshell {
+		return c.cmd.Process.Signal(sig)
+	}
+
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("bad signal: %s", sig)
+	}
+	// the child is the leader of its own session, and so of its process group
+	return syscall.Kill(-c.cmd.Process.Pid, s)
+}
+
+func (c *ptyChild) ExitCh() <-chan int {
+	return c.exitCh
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build linux || darwin || freebsd
+
+package exec
+
+import (
+	osexec "os/exec"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenPTY verifies that a process using the slave side of the pty sees a
+// terminal, and that copyPTYOutput copies its output and returns once the
+// process has exited
+func TestOpenPTY(t *testing.T) {
+	master, slave, err := openPTY()
+	require.NoError(t, err)
+	defer master.Close()
+
+	cmd := osexec.Command("sh", "-c", "test -t 0 && test -t 1 && echo is a tty")
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	require.NoError(t, cmd.Start())
+	require.NoError(t, slave.Close())
+
+	output := newOutputBuffer(defaultOutputBufferSize)
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		copyPTYOutput(master, output, hclog.NewNullLogger())
+	}()
+
+	require.NoError(t, cmd.Wait())
+	select {
+	case <-copied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("copyPTYOutput did not return after the process exited")
+	}
+	require.Contains(t, output.String(), "is a tty")
+}
+
+// TestPTYChild verifies that the pty is the child's controlling terminal,
+// that its exit code is reported, and that a stopped child doesn't report
+// its exit
+func TestPTYChild(t *testing.T) {
+	output := newOutputBuffer(defaultOutputBufferSize)
+	proc, err := newPTYChild([]string{"sh", "-c", "exec </dev/tty && echo has a controlling terminal; exit 3"}, nil, false, output, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.Equal(t, 0, proc.Pid())
+	require.NoError(t, proc.Start())
+
+	select {
+	case exitCode := <-proc.ExitCh():
+		require.Equal(t, 3, exitCode)
+	case <-time.After(5 * time.Second):
+		t.Fatal("child did not exit")
+	}
+	require.Contains(t, output.String(), "has a controlling terminal")
+	require.Equal(t, 0, proc.Pid())
+
+	proc, err = newPTYChild([]string{"sleep", "30"}, nil, false, output, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.NoError(t, proc.Start())
+	require.NotZero(t, proc.Pid())
+	proc.Stop()
+
+	select {
+	case _, ok := <-proc.ExitCh():
+		require.False(t, ok, "a stopped child must not report its exit")
+	case <-time.After(5 * time.Second):
+		t.Fatal("child did not stop")
+	}
+}
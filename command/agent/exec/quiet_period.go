@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import "time"
+
+// renderQuietPeriod holds back complete renders until no further render has
+// arrived for its duration, so that secrets which rotate in quick succession
+// bounce the child process once, with the environment of the final render.
+// It's only used by the Run go-routine.
+type renderQuietPeriod struct {
+	duration time.Duration
+	timer    *time.Timer
+	envVars  []string
+}
+
+// add makes the render's environment variables the pending ones, and restarts
+// the quiet period
+func (q *renderQuietPeriod) add(renderedEnvVars []string) {
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+	q.timer = time.NewTimer(q.duration)
+	q.envVars = renderedEnvVars
+}
+
+// C receives once the quiet period after the latest render has passed. It's
+// nil, and so never receives, while no render is pending.
+func (q *renderQuietPeriod) C() <-chan time.Time {
+	if q.timer == nil {
+		return nil
+	}
+	return q.timer.C
+}
+
+// take returns the pending render's environment variables, and ends the
+// quiet period
+func (q *renderQuietPeriod) take() []string {
+	envVars := q.envVars
+	q.stop()
+	return envVars
+}
+
+// stop drops the pending render, if there is one
+func (q *renderQuietPeriod) stop() {
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+	q.timer = nil
+	q.envVars = nil
+}
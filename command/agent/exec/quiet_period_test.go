@@ -0,0 +1,39 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderQuietPeriod verifies that renders in quick succession restart the
+// quiet period, and that only the final render is taken once it has passed
+func TestRenderQuietPeriod(t *testing.T) {
+	q := &renderQuietPeriod{duration: 50 * time.Millisecond}
+	require.Nil(t, q.C())
+
+	start := time.Now()
+	q.add([]string{"FOO=1"})
+	time.Sleep(30 * time.Millisecond)
+	q.add([]string{"FOO=2"})
+	time.Sleep(30 * time.Millisecond)
+	q.add([]string{"FOO=3"})
+
+	select {
+	case <-q.C():
+	case <-time.After(5 * time.Second):
+		t.Fatal("quiet period did not pass")
+	}
+	require.GreaterOrEqual(t, time.Since(start), 110*time.Millisecond)
+	require.Equal(t, []string{"FOO=3"}, q.take())
+	require.Nil(t, q.C())
+
+	q.add([]string{"FOO=4"})
+	q.stop()
+	require.Nil(t, q.C())
+	require.Nil(t, q.take())
+}
@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RestartPolicy decides whether the running child process is restarted after
+// the env templates render new contents, or exec.watch_files change. changed
+// holds the names of the environment variables whose values changed, or the
+// paths of the watched files which changed, lastExit is the exit code of the
+// previous child process, or -1 if no child process has exited, and state is
+// the current state of the child process.
+//
+// Policies are consulted from the Run go-routine only, so implementations
+// don't need to be safe for concurrent use.
+type RestartPolicy interface {
+	ShouldRestart(changed []string, lastExit int, state ChildProcessState) bool
+}
+
+// AlwaysRestart restarts the child process on every change, it's the policy
+// for restart_on_secret_changes = "always"
+type AlwaysRestart struct{}
+
+func (AlwaysRestart) ShouldRestart([]string, int, ChildProcessState) bool {
+	return true
+}
+
+// NeverRestart keeps the child process running with its original environment,
+// it's the policy for restart_on_secret_changes = "never"
+type NeverRestart struct{}
+
+func (NeverRestart) ShouldRestart([]string, int, ChildProcessState) bool {
+	return false
+}
+
+// restartPolicyFromConfig returns the policy for a restart_on_secret_changes
+// value
+func restartPolicyFromConfig(restartOnSecretChanges string) (RestartPolicy, error) {
+	switch restartOnSecretChanges {
+	case "always":
+		return AlwaysRestart{}, nil
+	case "never":
+		return NeverRestart{}, nil
+	default:
+		return nil, fmt.Errorf("invalid value for restart-on-secret-changes: %q", restartOnSecretChanges)
+	}
+}
+
+// changedEnvVars returns the sorted names of the environment variables which
+// were added, removed, or given a different value between two renders
+func changedEnvVars(oldEnvVars []string, newEnvVars []string) []string {
+	oldValues := make(map[string]string, len(oldEnvVars))
+	for _, kv := range oldEnvVars {
+		name, value, _ := strings.Cut(kv, "=")
+		oldValues[name] = value
+	}
+
+	var changed []string
+	for _, kv := range newEnvVars {
+		name, value, _ := strings.Cut(kv, "=")
+		if oldValue, ok := oldValues[name]; !ok || oldValue != value {
+			changed = append(changed, name)
+		}
+		delete(oldValues, name)
+	}
+	for name := range oldValues {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+
+	return changed
+}
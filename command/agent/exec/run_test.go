@@ -0,0 +1,458 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	ctconfig "github.com/hashicorp/consul-template/config"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/sdk/helper/pointerutil"
+)
+
+const (
+	// testChildEnv makes the test binary act as the child process, see
+	// TestExecHelperProcess
+	testChildEnv = "VAULT_EXEC_TEST_CHILD"
+
+	// testChildOutputEnv is the file the test child process appends its pid
+	// and the rendered secret to when it starts, and its pid and "stopped"
+	// to when it's stopped
+	testChildOutputEnv = "VAULT_EXEC_TEST_CHILD_OUTPUT"
+
+	// testChildExitCodeEnv makes the test child process exit on its own with
+	// the given code once it has started
+	testChildExitCodeEnv = "VAULT_EXEC_TEST_CHILD_EXIT_CODE"
+
+	// testChildSignalsEnv makes the test child process report the signals
+	// with the given comma separated numbers, as "signal" and the number,
+	// instead of taking their default action
+	testChildSignalsEnv = "VAULT_EXEC_TEST_CHILD_SIGNALS"
+)
+
+// TestExecHelperProcess isn't a real test, it's the child process started by
+// the exec server in the tests of Run, when the test binary is run with
+// testChildEnv set. It reports the SECRET environment variable, and then runs
+// until it's sent SIGTERM, or exits with testChildExitCodeEnv if it's set.
+// The signals of testChildSignalsEnv are reported as they're received.
+func TestExecHelperProcess(t *testing.T) {
+	if os.Getenv(testChildEnv) == "" {
+		t.Skip("only run as the exec server's child process")
+	}
+
+	stopCh := make(chan os.Signal, 1)
+	signal.Notify(stopCh, syscall.SIGTERM)
+
+	report := func(line string) {
+		f, err := os.OpenFile(os.Getenv(testChildOutputEnv), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			os.Exit(100)
+		}
+		defer f.Close()
+		fmt.Fprintf(f, "%d %s\n", os.Getpid(), line)
+	}
+
+	// the signals are caught before the secret is reported, so that they can
+	// be sent as soon as the child process has reported it
+	signalCh := make(chan os.Signal, 1)
+	for _, number := range strings.Split(os.Getenv(testChildSignalsEnv), ",") {
+		if n, err := strconv.Atoi(number); err == nil {
+			signal.Notify(signalCh, syscall.Signal(n))
+		}
+	}
+	go func() {
+		for sig := range signalCh {
+			report(fmt.Sprintf("signal %d", sig.(syscall.Signal)))
+		}
+	}()
+
+	report(os.Getenv("SECRET"))
+
+	if exitCode := os.Getenv(testChildExitCodeEnv); exitCode != "" {
+		fmt.Println("exiting on my own")
+		code, _ := strconv.Atoi(exitCode)
+		os.Exit(code)
+	}
+
+	<-stopCh
+	report("stopped")
+	os.Exit(0)
+}
+
+// testVault is a fake Vault server, which serves the secret at kv/app with the
+// current value, and counts how often it's read
+type testVault struct {
+	*httptest.Server
+
+	lock   sync.Mutex
+	secret string
+	reads  int
+}
+
+func newTestVault(t *testing.T, secret string) *testVault {
+	t.Helper()
+
+	v := &testVault{secret: secret}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/kv/app", func(w http.ResponseWriter, r *http.Request) {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+
+		v.reads++
+		fmt.Fprintf(w, `{"data": {"secret": %q}}`, v.secret)
+	})
+	v.Server = httptest.NewServer(mux)
+	t.Cleanup(v.Close)
+
+	return v
+}
+
+func (v *testVault) setSecret(secret string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.secret = secret
+}
+
+func (v *testVault) secretReads() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.reads
+}
+
+// runTestServer runs an exec server, whose child process is the test binary
+// acting as TestExecHelperProcess, with the SECRET env template rendered from
+// the fake Vault server. configure, if set, changes the exec config. It
+// returns the file the child process reports to, the channel the server's
+// tokens are sent on, and the channel Run's error is received from.
+func runTestServer(t *testing.T, ctx context.Context, vault *testVault, childEnv map[string]string, configure func(*config.ExecConfig)) (*Server, string, chan string, chan error) {
+	t.Helper()
+
+	output := filepath.Join(t.TempDir(), "output")
+	staticEnv := map[string]string{
+		testChildEnv:       "1",
+		testChildOutputEnv: output,
+	}
+	for name, value := range childEnv {
+		staticEnv[name] = value
+	}
+
+	execConfig := &config.ExecConfig{
+		Command:                []string{os.Args[0], "-test.run=^TestExecHelperProcess$"},
+		RestartOnSecretChanges: "always",
+		RestartStrategy:        "stop_start",
+		RestartStopSignal:      syscall.SIGTERM,
+		KillTimeout:            5 * time.Second,
+		StaticEnv:              staticEnv,
+	}
+	if configure != nil {
+		configure(execConfig)
+	}
+
+	s := NewServer(&ServerConfig{
+		Logger: hclog.NewNullLogger(),
+		AgentConfig: &config.Config{
+			Vault: &config.Vault{Address: vault.URL},
+			EnvTemplates: []*ctconfig.TemplateConfig{{
+				Contents:                 pointerutil.StringPtr(`{{ with secret "kv/app" }}{{ .Data.secret }}{{ end }}`),
+				MapToEnvironmentVariable: pointerutil.StringPtr("SECRET"),
+			}},
+			Exec: execConfig,
+		},
+		LogLevel:  hclog.Off,
+		LogWriter: io.Discard,
+	})
+
+	tokenCh := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Run(ctx, tokenCh)
+	}()
+
+	return s, output, tokenCh, errCh
+}
+
+// waitForChildOutput waits until the test child processes have reported the
+// given number of lines, and returns them
+func waitForChildOutput(t *testing.T, output string, lines int) []string {
+	t.Helper()
+
+	var reported []string
+	require.Eventually(t, func() bool {
+		contents, err := os.ReadFile(output)
+		if err != nil {
+			return false
+		}
+		reported = strings.Split(strings.TrimSpace(string(contents)), "\n")
+		return len(reported) >= lines
+	}, 20*time.Second, 50*time.Millisecond)
+
+	return reported
+}
+
+// TestServer_Run verifies the exec server end to end, with a real child
+// process: the rendered secret is passed to the child process, a changed
+// secret restarts it once a new token re-renders the templates, and the child
+// process is stopped when the context is cancelled
+func TestServer_Run(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the child process is stopped with SIGTERM")
+	}
+
+	vault := newTestVault(t, "s3cr3t")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, output, tokenCh, errCh := runTestServer(t, ctx, vault, nil, nil)
+
+	tokenCh <- "token"
+	reported := waitForChildOutput(t, output, 1)
+	pid, secret, _ := strings.Cut(reported[0], " ")
+	require.Equal(t, "s3cr3t", secret)
+
+	vault.setSecret("n3w-s3cr3t")
+	tokenCh <- "token-2"
+	reported = waitForChildOutput(t, output, 3)
+	require.Equal(t, []string{pid + " stopped"}, reported[1:2])
+	newPID, secret, _ := strings.Cut(reported[2], " ")
+	require.NotEqual(t, pid, newPID)
+	require.Equal(t, "n3w-s3cr3t", secret)
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(20 * time.Second):
+		t.Fatal("Run didn't return once the context was cancelled")
+	}
+	require.Equal(t, []string{newPID + " stopped"}, waitForChildOutput(t, output, 4)[3:])
+}
+
+// TestServer_Run_tokenRotation verifies that a new token, which re-renders the
+// templates with the same contents, doesn't restart the child process, while
+// the next change of the secret does
+func TestServer_Run_tokenRotation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the child process is stopped with SIGTERM")
+	}
+
+	vault := newTestVault(t, "s3cr3t")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, output, tokenCh, _ := runTestServer(t, ctx, vault, nil, nil)
+
+	tokenCh <- "token"
+	pid, _, _ := strings.Cut(waitForChildOutput(t, output, 1)[0], " ")
+
+	// the new runner reads the unchanged secret again
+	reads := vault.secretReads()
+	tokenCh <- "token-2"
+	require.Eventually(t, func() bool {
+		return vault.secretReads() > reads
+	}, 20*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	vault.setSecret("n3w-s3cr3t")
+	tokenCh <- "token-3"
+	reported := waitForChildOutput(t, output, 3)
+	require.Equal(t, pid+" stopped", reported[1])
+	_, secret, _ := strings.Cut(reported[2], " ")
+	require.Equal(t, "n3w-s3cr3t", secret)
+}
+
+// TestServer_Run_watchFiles verifies that changing a watched file restarts the
+// child process with the same secret
+func TestServer_Run_watchFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the child process is stopped with SIGTERM")
+	}
+
+	watched := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(watched, []byte("v1"), 0o600))
+	vault := newTestVault(t, "s3cr3t")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, output, tokenCh, _ := runTestServer(t, ctx, vault, nil, func(execConfig *config.ExecConfig) {
+		execConfig.WatchFiles = []string{watched}
+		execConfig.WatchFilesDebounce = 100 * time.Millisecond
+	})
+
+	tokenCh <- "token"
+	pid, _, _ := strings.Cut(waitForChildOutput(t, output, 1)[0], " ")
+
+	require.NoError(t, os.WriteFile(watched, []byte("v2"), 0o600))
+	reported := waitForChildOutput(t, output, 3)
+	require.Equal(t, pid+" stopped", reported[1])
+	newPID, secret, _ := strings.Cut(reported[2], " ")
+	require.NotEqual(t, pid, newPID)
+	require.Equal(t, "s3cr3t", secret)
+}
+
+// TestServer_Run_noGoroutineLeak verifies that when Run returns early, because
+// the child process exited on its own rather than for a shutdown, none of the
+// go-routines it started is left running
+func TestServer_Run_noGoroutineLeak(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	watched := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(watched, []byte("v1"), 0o600))
+	vault := newTestVault(t, "s3cr3t")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, tokenCh, errCh := runTestServer(t, ctx, vault, map[string]string{testChildExitCodeEnv: "3"}, func(execConfig *config.ExecConfig) {
+		execConfig.WatchFiles = []string{watched}
+		execConfig.CommandTimeout = time.Hour
+	})
+
+	tokenCh <- "token"
+	select {
+	case err := <-errCh:
+		var exitErr *ProcessExitError
+		require.ErrorAs(t, err, &exitErr)
+	case <-time.After(20 * time.Second):
+		t.Fatal("Run didn't return once the child process exited")
+	}
+
+	// the server's connections to Vault are closed along with it
+	vault.Close()
+	goleak.VerifyNone(t, ignore)
+}
+
+// TestServer_Run_renderOnce verifies that with exec.render_once, the child
+// process isn't restarted when a new token would render a changed secret
+func TestServer_Run_renderOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the child process is stopped with SIGTERM")
+	}
+
+	vault := newTestVault(t, "s3cr3t")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, output, tokenCh, errCh := runTestServer(t, ctx, vault, nil, func(execConfig *config.ExecConfig) {
+		execConfig.RenderOnce = true
+	})
+
+	tokenCh <- "token"
+	waitForChildOutput(t, output, 1)
+	reads := vault.secretReads()
+
+	vault.setSecret("n3w-s3cr3t")
+	tokenCh <- "token-2"
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, reads, vault.secretReads())
+	require.Len(t, waitForChildOutput(t, output, 1), 1)
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(20 * time.Second):
+		t.Fatal("Run didn't return once the context was cancelled")
+	}
+}
+
+// TestServer_Run_crash verifies that when the child process exits on its own,
+// Run returns its exit code and output
+func TestServer_Run_crash(t *testing.T) {
+	vault := newTestVault(t, "s3cr3t")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, output, tokenCh, errCh := runTestServer(t, ctx, vault, map[string]string{testChildExitCodeEnv: "3"}, nil)
+
+	tokenCh <- "token"
+	var err error
+	select {
+	case err = <-errCh:
+	case <-time.After(20 * time.Second):
+		t.Fatal("Run didn't return once the child process exited")
+	}
+
+	var exitErr *ProcessExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, 3, exitErr.ExitCode)
+	require.Contains(t, exitErr.Output, "exiting on my own")
+	require.Zero(t, exitErr.RestartCount)
+	require.Positive(t, exitErr.TotalUptime)
+	require.ErrorContains(t, err, "process exited with 3 after running for ")
+	_, secret, _ := strings.Cut(waitForChildOutput(t, output, 1)[0], " ")
+	require.Equal(t, "s3cr3t", secret)
+}
+
+// TestServer_Run_shutdownDuringRenders stresses shutting the exec server down
+// while new tokens keep re-rendering a changing secret, and the child process
+// is restarted for them. Status is read throughout, as the status endpoint
+// would. Run must return without an error each time, having stopped every
+// child process it started.
+func TestServer_Run_shutdownDuringRenders(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the child process is stopped with SIGTERM")
+	}
+
+	for i := 0; i < 10; i++ {
+		vault := newTestVault(t, "s3cr3t-0")
+		ctx, cancel := context.WithCancel(context.Background())
+		s, output, tokenCh, errCh := runTestServer(t, ctx, vault, nil, nil)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for j := 1; ; j++ {
+				vault.setSecret(fmt.Sprintf("s3cr3t-%d", j))
+				select {
+				case tokenCh <- fmt.Sprintf("token-%d", j):
+				case <-ctx.Done():
+					return
+				}
+				s.Status()
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+
+		// cancel at a different point of the renders and restarts each time
+		time.Sleep(time.Duration(50+i*30) * time.Millisecond)
+		cancel()
+		select {
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-time.After(20 * time.Second):
+			t.Fatal("Run didn't return once the context was cancelled")
+		}
+		<-done
+		require.Equal(t, ChildProcessStateStopped.String(), s.Status().State)
+
+		// every child process that reported starting was stopped
+		contents, err := os.ReadFile(output)
+		if err != nil {
+			require.ErrorIs(t, err, os.ErrNotExist)
+			continue
+		}
+		started, stopped := make(map[string]struct{}), make(map[string]struct{})
+		for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+			pid, reported, _ := strings.Cut(line, " ")
+			if reported == "stopped" {
+				stopped[pid] = struct{}{}
+			} else {
+				started[pid] = struct{}{}
+			}
+		}
+		require.Equal(t, started, stopped)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+// TestServer_Run_forwardSignals verifies that the signals of
+// exec.forward_signals which the Agent receives are relayed to the child
+// process, and that other signals aren't
+func TestServer_Run_forwardSignals(t *testing.T) {
+	// SIGUSR2 isn't forwarded, so the test catches it itself rather than
+	// being terminated by it
+	notForwardedCh := make(chan os.Signal, 1)
+	signal.Notify(notForwardedCh, syscall.SIGUSR2)
+	defer signal.Stop(notForwardedCh)
+
+	vault := newTestVault(t, "s3cr3t")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	childSignals := fmt.Sprintf("%d,%d", syscall.SIGUSR1, syscall.SIGUSR2)
+	_, output, tokenCh, errCh := runTestServer(t, ctx, vault, map[string]string{testChildSignalsEnv: childSignals}, func(execConfig *config.ExecConfig) {
+		execConfig.ForwardSignals = []os.Signal{syscall.SIGUSR1}
+	})
+
+	tokenCh <- "token"
+	pid, _, _ := strings.Cut(waitForChildOutput(t, output, 1)[0], " ")
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	select {
+	case <-notForwardedCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the test didn't receive SIGUSR2")
+	}
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	reported := waitForChildOutput(t, output, 2)
+	require.Equal(t, fmt.Sprintf("%s signal %d", pid, syscall.SIGUSR1), reported[1])
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(20 * time.Second):
+		t.Fatal("Run didn't return once the context was cancelled")
+	}
+	require.Equal(t, pid+" stopped", waitForChildOutput(t, output, 3)[2])
+}
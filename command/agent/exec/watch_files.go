@@ -0,0 +1,138 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hashicorp/go-hclog"
+)
+
+// defaultWatchFilesDebounce is how long the exec.watch_files must go without
+// changing before their changes bounce the child process, if
+// exec.watch_files_debounce isn't set
+const defaultWatchFilesDebounce = time.Second
+
+// watchedFiles watches the files of exec.watch_files, and reports their
+// changes once they have settled for the debounce, so that a file which is
+// written in several steps bounces the child process once. The files'
+// directories are watched, rather than the files, so that a file which is
+// replaced, e.g. by an editor or by renaming a new version into place, is
+// still watched afterwards.
+type watchedFiles struct {
+	watcher  *fsnotify.Watcher
+	paths    map[string]struct{}
+	debounce time.Duration
+	logger   hclog.Logger
+
+	// changedCh receives the sorted paths of the files which changed
+	changedCh chan []string
+}
+
+// newWatchedFiles starts watching the directories of the given files. Their
+// changes are only reported once run is called.
+func newWatchedFiles(paths []string, debounce time.Duration, logger hclog.Logger) (*watchedFiles, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch exec.watch_files: %w", err)
+	}
+
+	w := &watchedFiles{
+		watcher:   watcher,
+		paths:     make(map[string]struct{}, len(paths)),
+		debounce:  debounce,
+		logger:    logger,
+		changedCh: make(chan []string),
+	}
+	dirs := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("unable to watch %s: %w", path, err)
+		}
+		w.paths[abs] = struct{}{}
+
+		dir := filepath.Dir(abs)
+		if _, ok := dirs[dir]; ok {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("unable to watch %s: %w", path, err)
+		}
+		dirs[dir] = struct{}{}
+	}
+
+	return w, nil
+}
+
+// run reports the files changed since the previous report on changedCh, once
+// none of them has changed for the debounce, until ctx is done. It closes the
+// watcher when it returns.
+func (w *watchedFiles) run(ctx context.Context) {
+	defer w.watcher.Close()
+
+	// a nil channel never receives, so nothing is reported while no change
+	// is pending
+	var timer *time.Timer
+	var debounceCh <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	changed := make(map[string]struct{})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			// a change of the file's mode doesn't change its contents
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			path := filepath.Clean(event.Name)
+			if _, ok := w.paths[path]; !ok {
+				continue
+			}
+			w.logger.Debug("watched file changed", "path", path, "op", event.Op.String())
+			changed[path] = struct{}{}
+
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(w.debounce)
+			debounceCh = timer.C
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("error watching exec.watch_files", "error", err)
+		case <-debounceCh:
+			debounceCh = nil
+			paths := make([]string, 0, len(changed))
+			for path := range changed {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			changed = make(map[string]struct{})
+
+			select {
+			case w.changedCh <- paths:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
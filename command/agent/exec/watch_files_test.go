@@ -0,0 +1,90 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWatchedFiles verifies that changes of the watched files are reported
+// once they have settled for the debounce, that other files in the same
+// directory are ignored, and that a file which is replaced by a rename is
+// still watched afterwards
+func TestWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "app.conf")
+	other := filepath.Join(dir, "other.conf")
+	require.NoError(t, os.WriteFile(watched, []byte("v1"), 0o600))
+
+	w, err := newWatchedFiles([]string{watched, filepath.Join(dir, "missing.conf")}, 200*time.Millisecond, hclog.NewNullLogger())
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(done)
+	}()
+
+	receive := func() []string {
+		t.Helper()
+		select {
+		case changed := <-w.changedCh:
+			return changed
+		case <-time.After(10 * time.Second):
+			t.Fatal("no change of the watched files was reported")
+			return nil
+		}
+	}
+	requireNoChange := func() {
+		t.Helper()
+		select {
+		case changed := <-w.changedCh:
+			t.Fatalf("unexpected change reported: %v", changed)
+		case <-time.After(400 * time.Millisecond):
+		}
+	}
+
+	// writes in quick succession are reported once
+	for i := 0; i < 5; i++ {
+		require.NoError(t, os.WriteFile(watched, []byte("v2"), 0o600))
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.Equal(t, []string{watched}, receive())
+	requireNoChange()
+
+	require.NoError(t, os.WriteFile(other, []byte("v1"), 0o600))
+	requireNoChange()
+
+	replacement := filepath.Join(dir, "app.conf.new")
+	require.NoError(t, os.WriteFile(replacement, []byte("v3"), 0o600))
+	require.NoError(t, os.Rename(replacement, watched))
+	require.Equal(t, []string{watched}, receive())
+
+	require.NoError(t, os.WriteFile(watched, []byte("v4"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "missing.conf"), []byte("v1"), 0o600))
+	require.Equal(t, []string{watched, filepath.Join(dir, "missing.conf")}, receive())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("run didn't return once the context was cancelled")
+	}
+}
+
+// TestNewWatchedFiles_missingDirectory verifies that a watched file whose
+// directory doesn't exist is reported when the watch is set up
+func TestNewWatchedFiles_missingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "app.conf")
+	_, err := newWatchedFiles([]string{path}, time.Second, hclog.NewNullLogger())
+	require.ErrorContains(t, err, "unable to watch "+path)
+}
@@ -12,6 +12,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	osexec "os/exec"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -19,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	ctconfig "github.com/hashicorp/consul-template/config"
 	"github.com/hashicorp/go-hclog"
 	vaultjwt "github.com/hashicorp/vault-plugin-auth-jwt"
 	logicalKv "github.com/hashicorp/vault-plugin-secrets-kv"
@@ -3113,6 +3115,242 @@ vault {
 	wg.Wait()
 }
 
+// TestAgent_TemplateTokenChEnabled tests that the auth handler sends its tokens
+// on the template token channel when there are templates, or env templates
+// rendered by the exec server
+func TestAgent_TemplateTokenChEnabled(t *testing.T) {
+	tests := map[string]struct {
+		config   *agentConfig.Config
+		expected bool
+	}{
+		"no templates": {
+			config: &agentConfig.Config{},
+		},
+		"templates": {
+			config: &agentConfig.Config{
+				Templates: []*ctconfig.TemplateConfig{{}},
+			},
+			expected: true,
+		},
+		"exec and env templates": {
+			config: &agentConfig.Config{
+				Exec:         &agentConfig.ExecConfig{Command: []string{"/bin/true"}},
+				EnvTemplates: []*ctconfig.TemplateConfig{{}},
+			},
+			expected: true,
+		},
+		"env templates without exec": {
+			config: &agentConfig.Config{
+				EnvTemplates: []*ctconfig.TemplateConfig{{}},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, templateTokenChEnabled(tc.config))
+		})
+	}
+}
+
+// TestAgent_Exec_EnvTemplates tests that the agent starts the exec server's
+// child process with the env templates rendered from the auto-auth token, and
+// that its status is reported on the listener's exec-status endpoint
+func TestAgent_Exec_EnvTemplates(t *testing.T) {
+	if _, err := osexec.LookPath("sh"); err != nil {
+		t.Skip("sh is needed to run the child process")
+	}
+
+	//----------------------------------------------------
+	// Start the server and agent
+	//----------------------------------------------------
+	logger := logging.NewVaultLogger(hclog.Trace)
+	cluster := vault.NewTestCluster(t,
+		&vault.CoreConfig{
+			Logger: logger,
+			CredentialBackends: map[string]logical.Factory{
+				"approle": credAppRole.Factory,
+			},
+			LogicalBackends: map[string]logical.Factory{
+				"kv": logicalKv.Factory,
+			},
+		},
+		&vault.TestClusterOptions{
+			NumCores:    1,
+			HandlerFunc: vaulthttp.Handler,
+		})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+	serverClient := cluster.Cores[0].Client
+
+	// Unset the environment variable so that agent picks up the right test
+	// cluster address
+	defer os.Setenv(api.EnvVaultAddress, os.Getenv(api.EnvVaultAddress))
+	os.Setenv(api.EnvVaultAddress, serverClient.Address())
+
+	// Enable the approle auth method
+	req := serverClient.NewRequest("POST", "/v1/sys/auth/approle")
+	req.BodyBytes = []byte(`{
+		"type": "approle"
+	}`)
+	request(t, serverClient, req, 204)
+
+	// give test-role permissions to read the kv secret
+	req = serverClient.NewRequest("PUT", "/v1/sys/policy/myapp-read")
+	req.BodyBytes = []byte(`{
+	  "policy": "path \"secret/*\" { capabilities = [\"read\", \"list\"] }"
+	}`)
+	request(t, serverClient, req, 204)
+
+	// Create a named role
+	req = serverClient.NewRequest("PUT", "/v1/auth/approle/role/test-role")
+	req.BodyBytes = []byte(`{
+	  "token_ttl": "5m",
+		"token_policies":"default,myapp-read",
+		"policies":"default,myapp-read"
+	}`)
+	request(t, serverClient, req, 204)
+
+	// Fetch the RoleID of the named role
+	req = serverClient.NewRequest("GET", "/v1/auth/approle/role/test-role/role-id")
+	body := request(t, serverClient, req, 200)
+	data := body["data"].(map[string]interface{})
+	roleID := data["role_id"].(string)
+
+	// Get a SecretID issued against the named role
+	req = serverClient.NewRequest("PUT", "/v1/auth/approle/role/test-role/secret-id")
+	body = request(t, serverClient, req, 200)
+	data = body["data"].(map[string]interface{})
+	secretID := data["secret_id"].(string)
+
+	// Write the RoleID and SecretID to temp files
+	roleIDPath := makeTempFile(t, "role_id.txt", roleID+"\n")
+	secretIDPath := makeTempFile(t, "secret_id.txt", secretID+"\n")
+	defer os.Remove(roleIDPath)
+	defer os.Remove(secretIDPath)
+
+	// setup the kv secrets
+	req = serverClient.NewRequest("POST", "/v1/sys/mounts/secret/tune")
+	req.BodyBytes = []byte(`{
+	"options": {"version": "2"}
+	}`)
+	request(t, serverClient, req, 200)
+
+	// populate a secret
+	req = serverClient.NewRequest("POST", "/v1/secret/data/myapp")
+	req.BodyBytes = []byte(`{
+	  "data": {
+      "username": "bar",
+      "password": "zap"
+    }
+	}`)
+	request(t, serverClient, req, 200)
+
+	// The child process writes the rendered environment variable to a file,
+	// and keeps running until the agent stops it
+	outputPath := filepath.Join(t.TempDir(), "password.txt")
+
+	listenAddr := generateListenerAddress(t)
+	config := fmt.Sprintf(`
+vault {
+  address = "%s"
+  tls_skip_verify = true
+}
+
+auto_auth {
+    method "approle" {
+        mount_path = "auth/approle"
+        config = {
+            role_id_file_path = "%s"
+            secret_id_file_path = "%s"
+            remove_secret_id_file_after_reading = false
+        }
+    }
+}
+
+listener "tcp" {
+    address = "%s"
+    tls_disable = true
+}
+
+env_template "MY_PASSWORD" {
+    contents = "{{ with secret \"secret/data/myapp\" }}{{ .Data.data.password }}{{ end }}"
+}
+
+exec {
+    command = ["sh", "-c", "echo \"$MY_PASSWORD\" > %s.tmp && mv %s.tmp %s && exec sleep 1000"]
+    restart_on_secret_changes = "never"
+}
+`, serverClient.Address(), roleIDPath, secretIDPath, listenAddr, outputPath, outputPath, outputPath)
+
+	configPath := makeTempFile(t, "config.hcl", config)
+	defer os.Remove(configPath)
+
+	// Start the agent
+	ui, cmd := testAgentCommand(t, logger)
+	cmd.client = serverClient
+	cmd.startedCh = make(chan struct{})
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		code := cmd.Run([]string{"-config", configPath})
+		if code != 0 {
+			t.Errorf("non-zero return code when running agent: %d", code)
+			t.Logf("STDOUT from agent:\n%s", ui.OutputWriter.String())
+			t.Logf("STDERR from agent:\n%s", ui.ErrorWriter.String())
+		}
+		wg.Done()
+	}()
+
+	select {
+	case <-cmd.startedCh:
+	case <-time.After(5 * time.Second):
+		t.Errorf("timeout")
+	}
+
+	// We need to shut down the Agent command
+	defer func() {
+		cmd.ShutdownCh <- struct{}{}
+		wg.Wait()
+	}()
+
+	// The child process can only have been started with the rendered secret
+	// if the auth handler sent its token to the exec server
+	var contents []byte
+	require.Eventually(t, func() bool {
+		var err error
+		contents, err = os.ReadFile(outputPath)
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond, "the child process wasn't started")
+	require.Equal(t, "zap\n", string(contents))
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetMaxRetries(0)
+	if err := client.SetAddress("http://" + listenAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.RawRequest(client.NewRequest(http.MethodGet, consts.AgentPathExecStatus))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		State string `json:"state"`
+		PID   int    `json:"pid"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	require.Equal(t, "running", status.State)
+	require.NotZero(t, status.PID)
+}
+
 // Get a randomly assigned port and then free it again before returning it.
 // There is still a race when trying to use it, but should work better
 // than a static port.
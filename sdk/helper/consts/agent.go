@@ -13,3 +13,7 @@ const AgentPathMetrics = "/agent/v1/metrics"
 
 // AgentPathQuit is the path that the agent will use to trigger stopping it.
 const AgentPathQuit = "/agent/v1/quit"
+
+// AgentPathExecStatus is the path the agent will use to expose the status of
+// the process supervised through the exec stanza.
+const AgentPathExecStatus = "/agent/v1/exec-status"
@@ -81,13 +81,120 @@ func (WriteOptions) EnumDescriptor() ([]byte, []int) {
 	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{0}
 }
 
+// SegmentDistribution is the order in which the clients of a month are put in
+// its segments. SEGMENT_DISTRIBUTION_FILL fills each segment before moving on
+// to the next, so that the first clients are in the first segment.
+// SEGMENT_DISTRIBUTION_ROUND_ROBIN puts each client in the next segment, so
+// that client 0 is in segment 0, client 1 in segment 1, and so on
+type SegmentDistribution int32
+
+const (
+	SegmentDistribution_SEGMENT_DISTRIBUTION_FILL        SegmentDistribution = 0
+	SegmentDistribution_SEGMENT_DISTRIBUTION_ROUND_ROBIN SegmentDistribution = 1
+)
+
+// Enum value maps for SegmentDistribution.
+var (
+	SegmentDistribution_name = map[int32]string{
+		0: "SEGMENT_DISTRIBUTION_FILL",
+		1: "SEGMENT_DISTRIBUTION_ROUND_ROBIN",
+	}
+	SegmentDistribution_value = map[string]int32{
+		"SEGMENT_DISTRIBUTION_FILL":        0,
+		"SEGMENT_DISTRIBUTION_ROUND_ROBIN": 1,
+	}
+)
+
+func (x SegmentDistribution) Enum() *SegmentDistribution {
+	p := new(SegmentDistribution)
+	*p = x
+	return p
+}
+
+func (x SegmentDistribution) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SegmentDistribution) Descriptor() protoreflect.EnumDescriptor {
+	return file_vault_activity_generation_generate_data_proto_enumTypes[1].Descriptor()
+}
+
+func (SegmentDistribution) Type() protoreflect.EnumType {
+	return &file_vault_activity_generation_generate_data_proto_enumTypes[1]
+}
+
+func (x SegmentDistribution) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SegmentDistribution.Descriptor instead.
+func (SegmentDistribution) EnumDescriptor() ([]byte, []int) {
+	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{1}
+}
+
+type NamespaceDistribution int32
+
+const (
+	NamespaceDistribution_NAMESPACE_DISTRIBUTION_ROUND_ROBIN NamespaceDistribution = 0
+	NamespaceDistribution_NAMESPACE_DISTRIBUTION_RANDOM      NamespaceDistribution = 1
+)
+
+// Enum value maps for NamespaceDistribution.
+var (
+	NamespaceDistribution_name = map[int32]string{
+		0: "NAMESPACE_DISTRIBUTION_ROUND_ROBIN",
+		1: "NAMESPACE_DISTRIBUTION_RANDOM",
+	}
+	NamespaceDistribution_value = map[string]int32{
+		"NAMESPACE_DISTRIBUTION_ROUND_ROBIN": 0,
+		"NAMESPACE_DISTRIBUTION_RANDOM":      1,
+	}
+)
+
+func (x NamespaceDistribution) Enum() *NamespaceDistribution {
+	p := new(NamespaceDistribution)
+	*p = x
+	return p
+}
+
+func (x NamespaceDistribution) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (NamespaceDistribution) Descriptor() protoreflect.EnumDescriptor {
+	return file_vault_activity_generation_generate_data_proto_enumTypes[2].Descriptor()
+}
+
+func (NamespaceDistribution) Type() protoreflect.EnumType {
+	return &file_vault_activity_generation_generate_data_proto_enumTypes[2]
+}
+
+func (x NamespaceDistribution) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use NamespaceDistribution.Descriptor instead.
+func (NamespaceDistribution) EnumDescriptor() ([]byte, []int) {
+	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{2}
+}
+
 type ActivityLogMockInput struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Write []WriteOptions `protobuf:"varint,1,rep,packed,name=write,proto3,enum=generation.WriteOptions" json:"write,omitempty"`
-	Data  []*Data        `protobuf:"bytes,2,rep,name=data,proto3" json:"data,omitempty"`
+	Write          []WriteOptions `protobuf:"varint,1,rep,packed,name=write,proto3,enum=generation.WriteOptions" json:"write,omitempty"`
+	Data           []*Data        `protobuf:"bytes,2,rep,name=data,proto3" json:"data,omitempty"`
+	Seed           *int64         `protobuf:"varint,3,opt,name=seed,proto3,oneof" json:"seed,omitempty"`                                     // when set, generated client IDs are the same each time
+	Workers        int32          `protobuf:"varint,4,opt,name=workers,proto3" json:"workers,omitempty"`                                     // segments populated or written at once, defaults to the number of CPUs
+	StoragePrefix  string         `protobuf:"bytes,5,opt,name=storage_prefix,json=storagePrefix,proto3" json:"storage_prefix,omitempty"`     // write to a separate dataset under this prefix, instead of to the activity log
+	CheckpointSize int32          `protobuf:"varint,6,opt,name=checkpoint_size,json=checkpointSize,proto3" json:"checkpoint_size,omitempty"` // segments written between waits for every write to finish, defaults to the number of workers
+	Output         string         `protobuf:"bytes,7,opt,name=output,proto3" json:"output,omitempty"`                                        // "write" (the default) writes the segments to storage, "return" returns them serialized instead
+	Overwrite      bool           `protobuf:"varint,8,opt,name=overwrite,proto3" json:"overwrite,omitempty"`                                 // remove the months' existing entity segments before writing, instead of adding to them
+	// reference_time is an RFC3339 or unix timestamp that months are relative
+	// to, instead of the current time. The segments are written to the months
+	// counted back from the reference time's month, so that tests are stable
+	ReferenceTime string `protobuf:"bytes,9,opt,name=reference_time,json=referenceTime,proto3" json:"reference_time,omitempty"`
 }
 
 func (x *ActivityLogMockInput) Reset() {
@@ -136,6 +243,55 @@ func (x *ActivityLogMockInput) GetData() []*Data {
 	return nil
 }
 
+func (x *ActivityLogMockInput) GetSeed() int64 {
+	if x != nil && x.Seed != nil {
+		return *x.Seed
+	}
+	return 0
+}
+
+func (x *ActivityLogMockInput) GetWorkers() int32 {
+	if x != nil {
+		return x.Workers
+	}
+	return 0
+}
+
+func (x *ActivityLogMockInput) GetStoragePrefix() string {
+	if x != nil {
+		return x.StoragePrefix
+	}
+	return ""
+}
+
+func (x *ActivityLogMockInput) GetCheckpointSize() int32 {
+	if x != nil {
+		return x.CheckpointSize
+	}
+	return 0
+}
+
+func (x *ActivityLogMockInput) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+func (x *ActivityLogMockInput) GetOverwrite() bool {
+	if x != nil {
+		return x.Overwrite
+	}
+	return false
+}
+
+func (x *ActivityLogMockInput) GetReferenceTime() string {
+	if x != nil {
+		return x.ReferenceTime
+	}
+	return ""
+}
+
 type Data struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -150,10 +306,30 @@ type Data struct {
 	//
 	//	*Data_All
 	//	*Data_Segments
-	Clients             isData_Clients `protobuf_oneof:"clients"`
-	EmptySegmentIndexes []int32        `protobuf:"varint,5,rep,packed,name=empty_segment_indexes,json=emptySegmentIndexes,proto3" json:"empty_segment_indexes,omitempty"`
-	SkipSegmentIndexes  []int32        `protobuf:"varint,6,rep,packed,name=skip_segment_indexes,json=skipSegmentIndexes,proto3" json:"skip_segment_indexes,omitempty"`
-	NumSegments         int32          `protobuf:"varint,7,opt,name=num_segments,json=numSegments,proto3" json:"num_segments,omitempty"`
+	Clients             isData_Clients  `protobuf_oneof:"clients"`
+	EmptySegmentIndexes []int32         `protobuf:"varint,5,rep,packed,name=empty_segment_indexes,json=emptySegmentIndexes,proto3" json:"empty_segment_indexes,omitempty"`
+	SkipSegmentIndexes  []int32         `protobuf:"varint,6,rep,packed,name=skip_segment_indexes,json=skipSegmentIndexes,proto3" json:"skip_segment_indexes,omitempty"`
+	NumSegments         int32           `protobuf:"varint,7,opt,name=num_segments,json=numSegments,proto3" json:"num_segments,omitempty"`
+	SegmentWeights      []float64       `protobuf:"fixed64,8,rep,packed,name=segment_weights,json=segmentWeights,proto3" json:"segment_weights,omitempty"`                                                                                            // relative number of clients in each segment index
+	StrictSegments      bool            `protobuf:"varint,9,opt,name=strict_segments,json=strictSegments,proto3" json:"strict_segments,omitempty"`                                                                                                    // error instead of warning when there are more usable segments than clients
+	DefaultMount        string          `protobuf:"bytes,10,opt,name=default_mount,json=defaultMount,proto3" json:"default_mount,omitempty"`                                                                                                          // mount path for clients that don't have a mount, in the client's namespace
+	SegmentByteSize     int32           `protobuf:"varint,11,opt,name=segment_byte_size,json=segmentByteSize,proto3" json:"segment_byte_size,omitempty"`                                                                                              // split the clients into segments of at most this many serialized bytes, instead of by num_segments
+	SegmentCapacities   map[int32]int32 `protobuf:"bytes,12,rep,name=segment_capacities,json=segmentCapacities,proto3" json:"segment_capacities,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"` // maximum number of clients in each segment index, filled in index order, instead of by num_segments
+	// shared_client_ids allows new clients of the month to have the same id when
+	// their client types differ, to test how records with the same client ID
+	// are deduplicated. Without it, each id can only be used by one client
+	SharedClientIds bool `protobuf:"varint,13,opt,name=shared_client_ids,json=sharedClientIds,proto3" json:"shared_client_ids,omitempty"`
+	// matrices are expanded into clients for every combination of their
+	// namespaces and mounts, which are added to all of the month's clients
+	Matrices []*ClientMatrix `protobuf:"bytes,14,rep,name=matrices,proto3" json:"matrices,omitempty"`
+	// segment_distribution is how the clients are split between num_segments
+	// segments. It can't be used with the other ways of splitting the clients
+	SegmentDistribution SegmentDistribution `protobuf:"varint,15,opt,name=segment_distribution,json=segmentDistribution,proto3,enum=generation.SegmentDistribution" json:"segment_distribution,omitempty"`
+	// match_production_splitting splits the clients into as many segments as
+	// the activity log would write for them, each filled to the activity log's
+	// segment capacity in order. It can't be used with the other ways of
+	// splitting the clients, or with skipped and empty segment indexes
+	MatchProductionSplitting bool `protobuf:"varint,16,opt,name=match_production_splitting,json=matchProductionSplitting,proto3" json:"match_production_splitting,omitempty"`
 }
 
 func (x *Data) Reset() {
@@ -251,6 +427,69 @@ func (x *Data) GetNumSegments() int32 {
 	return 0
 }
 
+func (x *Data) GetSegmentWeights() []float64 {
+	if x != nil {
+		return x.SegmentWeights
+	}
+	return nil
+}
+
+func (x *Data) GetStrictSegments() bool {
+	if x != nil {
+		return x.StrictSegments
+	}
+	return false
+}
+
+func (x *Data) GetDefaultMount() string {
+	if x != nil {
+		return x.DefaultMount
+	}
+	return ""
+}
+
+func (x *Data) GetSegmentByteSize() int32 {
+	if x != nil {
+		return x.SegmentByteSize
+	}
+	return 0
+}
+
+func (x *Data) GetSegmentCapacities() map[int32]int32 {
+	if x != nil {
+		return x.SegmentCapacities
+	}
+	return nil
+}
+
+func (x *Data) GetSharedClientIds() bool {
+	if x != nil {
+		return x.SharedClientIds
+	}
+	return false
+}
+
+func (x *Data) GetMatrices() []*ClientMatrix {
+	if x != nil {
+		return x.Matrices
+	}
+	return nil
+}
+
+func (x *Data) GetSegmentDistribution() SegmentDistribution {
+	if x != nil {
+		return x.SegmentDistribution
+	}
+	return SegmentDistribution_SEGMENT_DISTRIBUTION_FILL
+}
+
+func (x *Data) GetMatchProductionSplitting() bool {
+	if x != nil {
+		return x.MatchProductionSplitting
+	}
+	return false
+}
+
 type isData_Month interface {
 	isData_Month()
 }
@@ -283,6 +522,88 @@ func (*Data_All) isData_Clients() {}
 
 func (*Data_Segments) isData_Clients() {}
 
+// ClientMatrix is a compact spec for clients in many namespaces and mounts.
+// The combinations are expanded in order, each namespace with each of the
+// mounts, and count is spread across them like the namespaces of Clients
+type ClientMatrix struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Namespaces   []string              `protobuf:"bytes,1,rep,name=namespaces,proto3" json:"namespaces,omitempty"` // IDs or paths, the root namespace when empty
+	Mounts       []string              `protobuf:"bytes,2,rep,name=mounts,proto3" json:"mounts,omitempty"`         // paths relative to each namespace, the month's default mount when empty
+	Count        int32                 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`          // the number of clients across all of the combinations
+	Distribution NamespaceDistribution `protobuf:"varint,4,opt,name=distribution,proto3,enum=generation.NamespaceDistribution" json:"distribution,omitempty"`
+	Client       *Client               `protobuf:"bytes,5,opt,name=client,proto3" json:"client,omitempty"` // the generated clients' other fields, without a namespace, mount or count
+}
+
+func (x *ClientMatrix) Reset() {
+	*x = ClientMatrix{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ClientMatrix) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientMatrix) ProtoMessage() {}
+
+func (x *ClientMatrix) ProtoReflect() protoreflect.Message {
+	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientMatrix.ProtoReflect.Descriptor instead.
+func (*ClientMatrix) Descriptor() ([]byte, []int) {
+	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ClientMatrix) GetNamespaces() []string {
+	if x != nil {
+		return x.Namespaces
+	}
+	return nil
+}
+
+func (x *ClientMatrix) GetMounts() []string {
+	if x != nil {
+		return x.Mounts
+	}
+	return nil
+}
+
+func (x *ClientMatrix) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *ClientMatrix) GetDistribution() NamespaceDistribution {
+	if x != nil {
+		return x.Distribution
+	}
+	return NamespaceDistribution_NAMESPACE_DISTRIBUTION_ROUND_ROBIN
+}
+
+func (x *ClientMatrix) GetClient() *Client {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
 type Segments struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -294,7 +615,7 @@ type Segments struct {
 func (x *Segments) Reset() {
 	*x = Segments{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[2]
+		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -307,7 +628,7 @@ func (x *Segments) String() string {
 func (*Segments) ProtoMessage() {}
 
 func (x *Segments) ProtoReflect() protoreflect.Message {
-	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[2]
+	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -320,7 +641,7 @@ func (x *Segments) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Segments.ProtoReflect.Descriptor instead.
 func (*Segments) Descriptor() ([]byte, []int) {
-	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{2}
+	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *Segments) GetSegments() []*Segment {
@@ -342,7 +663,7 @@ type Segment struct {
 func (x *Segment) Reset() {
 	*x = Segment{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[3]
+		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -355,7 +676,7 @@ func (x *Segment) String() string {
 func (*Segment) ProtoMessage() {}
 
 func (x *Segment) ProtoReflect() protoreflect.Message {
-	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[3]
+	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -368,7 +689,7 @@ func (x *Segment) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Segment.ProtoReflect.Descriptor instead.
 func (*Segment) Descriptor() ([]byte, []int) {
-	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{3}
+	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *Segment) GetSegmentIndex() int32 {
@@ -391,12 +712,16 @@ type Clients struct {
 	unknownFields protoimpl.UnknownFields
 
 	Clients []*Client `protobuf:"bytes,1,rep,name=clients,proto3" json:"clients,omitempty"`
+	// namespaces spreads the clients that don't have a namespace across these
+	// namespaces, given by ID or path. Only supported for all of a month's clients
+	Namespaces            []string              `protobuf:"bytes,2,rep,name=namespaces,proto3" json:"namespaces,omitempty"`
+	NamespaceDistribution NamespaceDistribution `protobuf:"varint,3,opt,name=namespace_distribution,json=namespaceDistribution,proto3,enum=generation.NamespaceDistribution" json:"namespace_distribution,omitempty"`
 }
 
 func (x *Clients) Reset() {
 	*x = Clients{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[4]
+		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -409,7 +734,7 @@ func (x *Clients) String() string {
 func (*Clients) ProtoMessage() {}
 
 func (x *Clients) ProtoReflect() protoreflect.Message {
-	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[4]
+	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -422,7 +747,7 @@ func (x *Clients) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Clients.ProtoReflect.Descriptor instead.
 func (*Clients) Descriptor() ([]byte, []int) {
-	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{4}
+	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Clients) GetClients() []*Client {
@@ -432,24 +757,68 @@ func (x *Clients) GetClients() []*Client {
 	return nil
 }
 
+func (x *Clients) GetNamespaces() []string {
+	if x != nil {
+		return x.Namespaces
+	}
+	return nil
+}
+
+func (x *Clients) GetNamespaceDistribution() NamespaceDistribution {
+	if x != nil {
+		return x.NamespaceDistribution
+	}
+	return NamespaceDistribution_NAMESPACE_DISTRIBUTION_ROUND_ROBIN
+}
+
 type Client struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	Id                string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Count             int32  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	Count             *int32 `protobuf:"varint,2,opt,name=count,proto3,oneof" json:"count,omitempty"` // the number of clients, one when it's left out. It must be positive when it's set
 	Repeated          bool   `protobuf:"varint,3,opt,name=repeated,proto3" json:"repeated,omitempty"`
 	RepeatedFromMonth int32  `protobuf:"varint,4,opt,name=repeated_from_month,json=repeatedFromMonth,proto3" json:"repeated_from_month,omitempty"`
-	Namespace         string `protobuf:"bytes,5,opt,name=namespace,proto3" json:"namespace,omitempty"`
-	Mount             string `protobuf:"bytes,6,opt,name=mount,proto3" json:"mount,omitempty"`
+	Namespace         string `protobuf:"bytes,5,opt,name=namespace,proto3" json:"namespace,omitempty"` // the namespace's ID or path. If a namespace's ID is another's path, the ID is used
+	Mount             string `protobuf:"bytes,6,opt,name=mount,proto3" json:"mount,omitempty"`         // relative to the namespace, a mount in a descendant namespace is given by its relative path, e.g. "child/kv/"
 	NonEntity         bool   `protobuf:"varint,7,opt,name=non_entity,json=nonEntity,proto3" json:"non_entity,omitempty"`
+	ClientType        string `protobuf:"bytes,8,opt,name=client_type,json=clientType,proto3" json:"client_type,omitempty"`
+	// repeated_percent repeats the given percentage of the matching clients in
+	// the month that the client is repeated from, instead of count clients
+	RepeatedPercent float64 `protobuf:"fixed64,9,opt,name=repeated_percent,json=repeatedPercent,proto3" json:"repeated_percent,omitempty"`
+	UsageTime       string  `protobuf:"bytes,10,opt,name=usage_time,json=usageTime,proto3" json:"usage_time,omitempty"` // RFC3339 or unix timestamp, within the client's month
+	// local is not supported yet. Every segment the activity log stores is in
+	// the replicated log/entity/ path, and it has no local segments that local
+	// clients could be written to and counted from, so they're rejected
+	Local           bool              `protobuf:"varint,11,opt,name=local,proto3" json:"local,omitempty"`
+	Metadata        map[string]string `protobuf:"bytes,12,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"` // kept with the generated clients, it isn't written to storage
+	RepeatedFromAll bool              `protobuf:"varint,13,opt,name=repeated_from_all,json=repeatedFromAll,proto3" json:"repeated_from_all,omitempty"`                                                 // repeat clients that are in every earlier month with data
+	TokenTtl        string            `protobuf:"bytes,14,opt,name=token_ttl,json=tokenTtl,proto3" json:"token_ttl,omitempty"`                                                                         // not supported yet, as entity records don't store token TTLs
+	// entity_ratio is the fraction of count that are entity clients, between
+	// 0 and 1. The rest are non-entity token clients
+	EntityRatio *float64 `protobuf:"fixed64,15,opt,name=entity_ratio,json=entityRatio,proto3,oneof" json:"entity_ratio,omitempty"`
+	MountType   string   `protobuf:"bytes,16,opt,name=mount_type,json=mountType,proto3" json:"mount_type,omitempty"`  // use the first auth or secrets mount of this type in the client's namespace, instead of a mount path
+	NumMounts   int32    `protobuf:"varint,17,opt,name=num_mounts,json=numMounts,proto3" json:"num_mounts,omitempty"` // spread the clients across the first num_mounts auth and secrets mounts in the client's namespace
+	// returning_ratio is the fraction of count that are returning clients,
+	// between 0 and 1. They're repeated from repeated_from_month, or from the
+	// previous month, and the rest are new clients
+	ReturningRatio *float64 `protobuf:"fixed64,18,opt,name=returning_ratio,json=returningRatio,proto3,oneof" json:"returning_ratio,omitempty"`
+	// ids creates a new client with each of these IDs, instead of count
+	// clients, e.g. to reproduce a month with known client IDs. They must be
+	// unique, and can't be set on repeated clients
+	Ids []string `protobuf:"bytes,19,rep,name=ids,proto3" json:"ids,omitempty"`
+	// tokens_per_entity also generates this many non-entity token clients for
+	// each new entity client, in the entity's namespace and mount, to test an
+	// entity's fan-out to tokens. When the entity is repeated in a later month,
+	// its tokens are repeated with it, so it can't be set on repeated clients
+	TokensPerEntity int32 `protobuf:"varint,20,opt,name=tokens_per_entity,json=tokensPerEntity,proto3" json:"tokens_per_entity,omitempty"`
 }
 
 func (x *Client) Reset() {
 	*x = Client{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[5]
+		mi := &file_vault_activity_generation_generate_data_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -462,7 +831,7 @@ func (x *Client) String() string {
 func (*Client) ProtoMessage() {}
 
 func (x *Client) ProtoReflect() protoreflect.Message {
-	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[5]
+	mi := &file_vault_activity_generation_generate_data_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -475,7 +844,7 @@ func (x *Client) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Client.ProtoReflect.Descriptor instead.
 func (*Client) Descriptor() ([]byte, []int) {
-	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{5}
+	return file_vault_activity_generation_generate_data_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Client) GetId() string {
@@ -486,8 +855,8 @@ func (x *Client) GetId() string {
 }
 
 func (x *Client) GetCount() int32 {
-	if x != nil {
-		return x.Count
+	if x != nil && x.Count != nil {
+		return *x.Count
 	}
 	return 0
 }
@@ -527,83 +896,293 @@ func (x *Client) GetNonEntity() bool {
 	return false
 }
 
+func (x *Client) GetClientType() string {
+	if x != nil {
+		return x.ClientType
+	}
+	return ""
+}
+
+func (x *Client) GetRepeatedPercent() float64 {
+	if x != nil {
+		return x.RepeatedPercent
+	}
+	return 0
+}
+
+func (x *Client) GetUsageTime() string {
+	if x != nil {
+		return x.UsageTime
+	}
+	return ""
+}
+
+func (x *Client) GetLocal() bool {
+	if x != nil {
+		return x.Local
+	}
+	return false
+}
+
+func (x *Client) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Client) GetRepeatedFromAll() bool {
+	if x != nil {
+		return x.RepeatedFromAll
+	}
+	return false
+}
+
+func (x *Client) GetTokenTtl() string {
+	if x != nil {
+		return x.TokenTtl
+	}
+	return ""
+}
+
+func (x *Client) GetEntityRatio() float64 {
+	if x != nil && x.EntityRatio != nil {
+		return *x.EntityRatio
+	}
+	return 0
+}
+
+func (x *Client) GetMountType() string {
+	if x != nil {
+		return x.MountType
+	}
+	return ""
+}
+
+func (x *Client) GetNumMounts() int32 {
+	if x != nil {
+		return x.NumMounts
+	}
+	return 0
+}
+
+func (x *Client) GetReturningRatio() float64 {
+	if x != nil && x.ReturningRatio != nil {
+		return *x.ReturningRatio
+	}
+	return 0
+}
+
+func (x *Client) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+func (x *Client) GetTokensPerEntity() int32 {
+	if x != nil {
+		return x.TokensPerEntity
+	}
+	return 0
+}
+
 var File_vault_activity_generation_generate_data_proto protoreflect.FileDescriptor
 
 var file_vault_activity_generation_generate_data_proto_rawDesc = []byte{
 	0x0a, 0x2d, 0x76, 0x61, 0x75, 0x6c, 0x74, 0x2f, 0x61, 0x63, 0x74, 0x69, 0x76, 0x69, 0x74, 0x79,
 	0x2f, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2f, 0x67, 0x65, 0x6e, 0x65,
 	0x72, 0x61, 0x74, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
-	0x0a, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x6c, 0x0a, 0x14, 0x41,
-	0x63, 0x74, 0x69, 0x76, 0x69, 0x74, 0x79, 0x4c, 0x6f, 0x67, 0x4d, 0x6f, 0x63, 0x6b, 0x49, 0x6e,
-	0x70, 0x75, 0x74, 0x12, 0x2e, 0x0a, 0x05, 0x77, 0x72, 0x69, 0x74, 0x65, 0x18, 0x01, 0x20, 0x03,
-	0x28, 0x0e, 0x32, 0x18, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e,
-	0x57, 0x72, 0x69, 0x74, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x05, 0x77, 0x72,
-	0x69, 0x74, 0x65, 0x12, 0x24, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x03, 0x28,
-	0x0b, 0x32, 0x10, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x44,
-	0x61, 0x74, 0x61, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0xc8, 0x02, 0x0a, 0x04, 0x44, 0x61,
-	0x74, 0x61, 0x12, 0x25, 0x0a, 0x0d, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x5f, 0x6d, 0x6f,
-	0x6e, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x0c, 0x63, 0x75, 0x72,
-	0x72, 0x65, 0x6e, 0x74, 0x4d, 0x6f, 0x6e, 0x74, 0x68, 0x12, 0x1f, 0x0a, 0x0a, 0x6d, 0x6f, 0x6e,
-	0x74, 0x68, 0x73, 0x5f, 0x61, 0x67, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52,
-	0x09, 0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x73, 0x41, 0x67, 0x6f, 0x12, 0x27, 0x0a, 0x03, 0x61, 0x6c,
-	0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61,
-	0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x48, 0x01, 0x52, 0x03,
-	0x61, 0x6c, 0x6c, 0x12, 0x32, 0x0a, 0x08, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18,
-	0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69,
-	0x6f, 0x6e, 0x2e, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x48, 0x01, 0x52, 0x08, 0x73,
-	0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x32, 0x0a, 0x15, 0x65, 0x6d, 0x70, 0x74, 0x79,
-	0x5f, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x65, 0x73,
-	0x18, 0x05, 0x20, 0x03, 0x28, 0x05, 0x52, 0x13, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x53, 0x65, 0x67,
-	0x6d, 0x65, 0x6e, 0x74, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x65, 0x73, 0x12, 0x30, 0x0a, 0x14, 0x73,
-	0x6b, 0x69, 0x70, 0x5f, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65,
-	0x78, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x05, 0x52, 0x12, 0x73, 0x6b, 0x69, 0x70, 0x53,
-	0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x65, 0x73, 0x12, 0x21, 0x0a,
-	0x0c, 0x6e, 0x75, 0x6d, 0x5f, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x07, 0x20,
-	0x01, 0x28, 0x05, 0x52, 0x0b, 0x6e, 0x75, 0x6d, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73,
-	0x42, 0x07, 0x0a, 0x05, 0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x42, 0x09, 0x0a, 0x07, 0x63, 0x6c, 0x69,
-	0x65, 0x6e, 0x74, 0x73, 0x22, 0x3b, 0x0a, 0x08, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73,
-	0x12, 0x2f, 0x0a, 0x08, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03,
-	0x28, 0x0b, 0x32, 0x13, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e,
-	0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x52, 0x08, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74,
-	0x73, 0x22, 0x74, 0x0a, 0x07, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x28, 0x0a, 0x0d,
-	0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x0c, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x49, 0x6e,
-	0x64, 0x65, 0x78, 0x88, 0x01, 0x01, 0x12, 0x2d, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
-	0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61,
-	0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x07, 0x63, 0x6c,
-	0x69, 0x65, 0x6e, 0x74, 0x73, 0x42, 0x10, 0x0a, 0x0e, 0x5f, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e,
-	0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x22, 0x37, 0x0a, 0x07, 0x43, 0x6c, 0x69, 0x65, 0x6e,
-	0x74, 0x73, 0x12, 0x2c, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20,
-	0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
-	0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x52, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73,
-	0x22, 0xcd, 0x01, 0x0a, 0x06, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69,
-	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x63,
-	0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e,
-	0x74, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x18, 0x03, 0x20,
-	0x01, 0x28, 0x08, 0x52, 0x08, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x12, 0x2e, 0x0a,
-	0x13, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x66, 0x72, 0x6f, 0x6d, 0x5f, 0x6d,
-	0x6f, 0x6e, 0x74, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x11, 0x72, 0x65, 0x70, 0x65,
-	0x61, 0x74, 0x65, 0x64, 0x46, 0x72, 0x6f, 0x6d, 0x4d, 0x6f, 0x6e, 0x74, 0x68, 0x12, 0x1c, 0x0a,
-	0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x6d,
-	0x6f, 0x75, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6d, 0x6f, 0x75, 0x6e,
-	0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x6e, 0x6f, 0x6e, 0x5f, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18,
-	0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x6e, 0x6f, 0x6e, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x79,
-	0x2a, 0xa0, 0x01, 0x0a, 0x0c, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
-	0x73, 0x12, 0x11, 0x0a, 0x0d, 0x57, 0x52, 0x49, 0x54, 0x45, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f,
-	0x57, 0x4e, 0x10, 0x00, 0x12, 0x1d, 0x0a, 0x19, 0x57, 0x52, 0x49, 0x54, 0x45, 0x5f, 0x50, 0x52,
-	0x45, 0x43, 0x4f, 0x4d, 0x50, 0x55, 0x54, 0x45, 0x44, 0x5f, 0x51, 0x55, 0x45, 0x52, 0x49, 0x45,
-	0x53, 0x10, 0x01, 0x12, 0x1a, 0x0a, 0x16, 0x57, 0x52, 0x49, 0x54, 0x45, 0x5f, 0x44, 0x49, 0x53,
-	0x54, 0x49, 0x4e, 0x43, 0x54, 0x5f, 0x43, 0x4c, 0x49, 0x45, 0x4e, 0x54, 0x53, 0x10, 0x02, 0x12,
-	0x12, 0x0a, 0x0e, 0x57, 0x52, 0x49, 0x54, 0x45, 0x5f, 0x45, 0x4e, 0x54, 0x49, 0x54, 0x49, 0x45,
-	0x53, 0x10, 0x03, 0x12, 0x17, 0x0a, 0x13, 0x57, 0x52, 0x49, 0x54, 0x45, 0x5f, 0x44, 0x49, 0x52,
-	0x45, 0x43, 0x54, 0x5f, 0x54, 0x4f, 0x4b, 0x45, 0x4e, 0x53, 0x10, 0x04, 0x12, 0x15, 0x0a, 0x11,
-	0x57, 0x52, 0x49, 0x54, 0x45, 0x5f, 0x49, 0x4e, 0x54, 0x45, 0x4e, 0x54, 0x5f, 0x4c, 0x4f, 0x47,
-	0x53, 0x10, 0x05, 0x42, 0x36, 0x5a, 0x34, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
-	0x6d, 0x2f, 0x68, 0x61, 0x73, 0x68, 0x69, 0x63, 0x6f, 0x72, 0x70, 0x2f, 0x76, 0x61, 0x75, 0x6c,
-	0x74, 0x2f, 0x76, 0x61, 0x75, 0x6c, 0x74, 0x2f, 0x61, 0x63, 0x74, 0x69, 0x76, 0x69, 0x74, 0x79,
-	0x2f, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x33,
+	0x0a, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xd5, 0x02, 0x0a, 0x14,
+	0x41, 0x63, 0x74, 0x69, 0x76, 0x69, 0x74, 0x79, 0x4c, 0x6f, 0x67, 0x4d, 0x6f, 0x63, 0x6b, 0x49,
+	0x6e, 0x70, 0x75, 0x74, 0x12, 0x2e, 0x0a, 0x05, 0x77, 0x72, 0x69, 0x74, 0x65, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x0e, 0x32, 0x18, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x05, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x12, 0x24, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x10, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e,
+	0x44, 0x61, 0x74, 0x61, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x17, 0x0a, 0x04, 0x73, 0x65,
+	0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x48, 0x00, 0x52, 0x04, 0x73, 0x65, 0x65, 0x64,
+	0x88, 0x01, 0x01, 0x12, 0x18, 0x0a, 0x07, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x73, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x73, 0x12, 0x25, 0x0a,
+	0x0e, 0x73, 0x74, 0x6f, 0x72, 0x61, 0x67, 0x65, 0x5f, 0x70, 0x72, 0x65, 0x66, 0x69, 0x78, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x73, 0x74, 0x6f, 0x72, 0x61, 0x67, 0x65, 0x50, 0x72,
+	0x65, 0x66, 0x69, 0x78, 0x12, 0x27, 0x0a, 0x0f, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x70, 0x6f, 0x69,
+	0x6e, 0x74, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x63,
+	0x68, 0x65, 0x63, 0x6b, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x16, 0x0a,
+	0x06, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6f,
+	0x75, 0x74, 0x70, 0x75, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x6f, 0x76, 0x65, 0x72, 0x77, 0x72, 0x69,
+	0x74, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x6f, 0x76, 0x65, 0x72, 0x77, 0x72,
+	0x69, 0x74, 0x65, 0x12, 0x25, 0x0a, 0x0e, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65,
+	0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x72, 0x65, 0x66,
+	0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x42, 0x07, 0x0a, 0x05, 0x5f, 0x73,
+	0x65, 0x65, 0x64, 0x22, 0xfd, 0x06, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x25, 0x0a, 0x0d,
+	0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x5f, 0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x0c, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x4d, 0x6f,
+	0x6e, 0x74, 0x68, 0x12, 0x1f, 0x0a, 0x0a, 0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x73, 0x5f, 0x61, 0x67,
+	0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x09, 0x6d, 0x6f, 0x6e, 0x74, 0x68,
+	0x73, 0x41, 0x67, 0x6f, 0x12, 0x27, 0x0a, 0x03, 0x61, 0x6c, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x13, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43,
+	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x48, 0x01, 0x52, 0x03, 0x61, 0x6c, 0x6c, 0x12, 0x32, 0x0a,
+	0x08, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x14, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x53, 0x65, 0x67,
+	0x6d, 0x65, 0x6e, 0x74, 0x73, 0x48, 0x01, 0x52, 0x08, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74,
+	0x73, 0x12, 0x32, 0x0a, 0x15, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x5f, 0x73, 0x65, 0x67, 0x6d, 0x65,
+	0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x05,
+	0x52, 0x13, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x49, 0x6e,
+	0x64, 0x65, 0x78, 0x65, 0x73, 0x12, 0x30, 0x0a, 0x14, 0x73, 0x6b, 0x69, 0x70, 0x5f, 0x73, 0x65,
+	0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x65, 0x73, 0x18, 0x06, 0x20,
+	0x03, 0x28, 0x05, 0x52, 0x12, 0x73, 0x6b, 0x69, 0x70, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74,
+	0x49, 0x6e, 0x64, 0x65, 0x78, 0x65, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x6e, 0x75, 0x6d, 0x5f, 0x73,
+	0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b, 0x6e,
+	0x75, 0x6d, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65,
+	0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x73, 0x18, 0x08, 0x20,
+	0x03, 0x28, 0x01, 0x52, 0x0e, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x57, 0x65, 0x69, 0x67,
+	0x68, 0x74, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x74, 0x72, 0x69, 0x63, 0x74, 0x5f, 0x73, 0x65,
+	0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x73, 0x74,
+	0x72, 0x69, 0x63, 0x74, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x23, 0x0a, 0x0d,
+	0x64, 0x65, 0x66, 0x61, 0x75, 0x6c, 0x74, 0x5f, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x0a, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0c, 0x64, 0x65, 0x66, 0x61, 0x75, 0x6c, 0x74, 0x4d, 0x6f, 0x75, 0x6e,
+	0x74, 0x12, 0x2a, 0x0a, 0x11, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x62, 0x79, 0x74,
+	0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0f, 0x73, 0x65,
+	0x67, 0x6d, 0x65, 0x6e, 0x74, 0x42, 0x79, 0x74, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x56, 0x0a,
+	0x12, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74,
+	0x69, 0x65, 0x73, 0x18, 0x0c, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x67, 0x65, 0x6e, 0x65,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x2e, 0x53, 0x65, 0x67, 0x6d,
+	0x65, 0x6e, 0x74, 0x43, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x69, 0x65, 0x73, 0x45, 0x6e, 0x74,
+	0x72, 0x79, 0x52, 0x11, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x43, 0x61, 0x70, 0x61, 0x63,
+	0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x2a, 0x0a, 0x11, 0x73, 0x68, 0x61, 0x72, 0x65, 0x64, 0x5f,
+	0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x64, 0x73, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x0f, 0x73, 0x68, 0x61, 0x72, 0x65, 0x64, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x64,
+	0x73, 0x12, 0x34, 0x0a, 0x08, 0x6d, 0x61, 0x74, 0x72, 0x69, 0x63, 0x65, 0x73, 0x18, 0x0e, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x4d, 0x61, 0x74, 0x72, 0x69, 0x78, 0x52, 0x08, 0x6d,
+	0x61, 0x74, 0x72, 0x69, 0x63, 0x65, 0x73, 0x12, 0x52, 0x0a, 0x14, 0x73, 0x65, 0x67, 0x6d, 0x65,
+	0x6e, 0x74, 0x5f, 0x64, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x18,
+	0x0f, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1f, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x2e, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x44, 0x69, 0x73, 0x74, 0x72, 0x69,
+	0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x13, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x44,
+	0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x3c, 0x0a, 0x1a, 0x6d,
+	0x61, 0x74, 0x63, 0x68, 0x5f, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f,
+	0x73, 0x70, 0x6c, 0x69, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x18, 0x10, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x18, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x53, 0x70, 0x6c, 0x69, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x1a, 0x44, 0x0a, 0x16, 0x53, 0x65, 0x67,
+	0x6d, 0x65, 0x6e, 0x74, 0x43, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x69, 0x65, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x42,
+	0x07, 0x0a, 0x05, 0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x42, 0x09, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65,
+	0x6e, 0x74, 0x73, 0x22, 0xcf, 0x01, 0x0a, 0x0c, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x4d, 0x61,
+	0x74, 0x72, 0x69, 0x78, 0x12, 0x1e, 0x0a, 0x0a, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63,
+	0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70,
+	0x61, 0x63, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x12, 0x14, 0x0a, 0x05,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x12, 0x45, 0x0a, 0x0c, 0x64, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x21, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x44,
+	0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0c, 0x64, 0x69, 0x73,
+	0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x2a, 0x0a, 0x06, 0x63, 0x6c, 0x69,
+	0x65, 0x6e, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x65, 0x6e, 0x65,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x52, 0x06, 0x63,
+	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x22, 0x3b, 0x0a, 0x08, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74,
+	0x73, 0x12, 0x2f, 0x0a, 0x08, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x2e, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x52, 0x08, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e,
+	0x74, 0x73, 0x22, 0x74, 0x0a, 0x07, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x28, 0x0a,
+	0x0d, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x0c, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x49,
+	0x6e, 0x64, 0x65, 0x78, 0x88, 0x01, 0x01, 0x12, 0x2d, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x07, 0x63,
+	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x42, 0x10, 0x0a, 0x0e, 0x5f, 0x73, 0x65, 0x67, 0x6d, 0x65,
+	0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x22, 0xb1, 0x01, 0x0a, 0x07, 0x43, 0x6c, 0x69,
+	0x65, 0x6e, 0x74, 0x73, 0x12, 0x2c, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x18,
+	0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x52, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x73,
+	0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63,
+	0x65, 0x73, 0x12, 0x58, 0x0a, 0x16, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x5f,
+	0x64, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x21, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e,
+	0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x44, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62,
+	0x75, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x15, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65,
+	0x44, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x98, 0x06, 0x0a,
+	0x06, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x19, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x88,
+	0x01, 0x01, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x12, 0x2e,
+	0x0a, 0x13, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x66, 0x72, 0x6f, 0x6d, 0x5f,
+	0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x11, 0x72, 0x65, 0x70,
+	0x65, 0x61, 0x74, 0x65, 0x64, 0x46, 0x72, 0x6f, 0x6d, 0x4d, 0x6f, 0x6e, 0x74, 0x68, 0x12, 0x1c,
+	0x0a, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6d, 0x6f, 0x75,
+	0x6e, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x6e, 0x6f, 0x6e, 0x5f, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79,
+	0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x6e, 0x6f, 0x6e, 0x45, 0x6e, 0x74, 0x69, 0x74,
+	0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65,
+	0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x54, 0x79,
+	0x70, 0x65, 0x12, 0x29, 0x0a, 0x10, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x70,
+	0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0f, 0x72, 0x65,
+	0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x50, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x12, 0x1d, 0x0a,
+	0x0a, 0x75, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x75, 0x73, 0x61, 0x67, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x6c, 0x6f, 0x63,
+	0x61, 0x6c, 0x12, 0x3c, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x0c,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74,
+	0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x12, 0x2a, 0x0a, 0x11, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x66, 0x72, 0x6f,
+	0x6d, 0x5f, 0x61, 0x6c, 0x6c, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x72, 0x65, 0x70,
+	0x65, 0x61, 0x74, 0x65, 0x64, 0x46, 0x72, 0x6f, 0x6d, 0x41, 0x6c, 0x6c, 0x12, 0x1b, 0x0a, 0x09,
+	0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x5f, 0x74, 0x74, 0x6c, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x54, 0x74, 0x6c, 0x12, 0x26, 0x0a, 0x0c, 0x65, 0x6e, 0x74,
+	0x69, 0x74, 0x79, 0x5f, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x01, 0x48,
+	0x01, 0x52, 0x0b, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x52, 0x61, 0x74, 0x69, 0x6f, 0x88, 0x01,
+	0x01, 0x12, 0x1d, 0x0a, 0x0a, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18,
+	0x10, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65,
+	0x12, 0x1d, 0x0a, 0x0a, 0x6e, 0x75, 0x6d, 0x5f, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x18, 0x11,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x6e, 0x75, 0x6d, 0x4d, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x12,
+	0x2c, 0x0a, 0x0f, 0x72, 0x65, 0x74, 0x75, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x5f, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x18, 0x12, 0x20, 0x01, 0x28, 0x01, 0x48, 0x02, 0x52, 0x0e, 0x72, 0x65, 0x74, 0x75,
+	0x72, 0x6e, 0x69, 0x6e, 0x67, 0x52, 0x61, 0x74, 0x69, 0x6f, 0x88, 0x01, 0x01, 0x12, 0x10, 0x0a,
+	0x03, 0x69, 0x64, 0x73, 0x18, 0x13, 0x20, 0x03, 0x28, 0x09, 0x52, 0x03, 0x69, 0x64, 0x73, 0x12,
+	0x2a, 0x0a, 0x11, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x5f, 0x70, 0x65, 0x72, 0x5f, 0x65, 0x6e,
+	0x74, 0x69, 0x74, 0x79, 0x18, 0x14, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0f, 0x74, 0x6f, 0x6b, 0x65,
+	0x6e, 0x73, 0x50, 0x65, 0x72, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x1a, 0x3b, 0x0a, 0x0d, 0x4d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03,
+	0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14,
+	0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x42, 0x08, 0x0a, 0x06, 0x5f, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x42, 0x0f, 0x0a, 0x0d, 0x5f, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x5f, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x42, 0x12, 0x0a, 0x10, 0x5f, 0x72, 0x65, 0x74, 0x75, 0x72, 0x6e, 0x69, 0x6e,
+	0x67, 0x5f, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x2a, 0xa0, 0x01, 0x0a, 0x0c, 0x57, 0x72, 0x69, 0x74,
+	0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x11, 0x0a, 0x0d, 0x57, 0x52, 0x49, 0x54,
+	0x45, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x1d, 0x0a, 0x19, 0x57,
+	0x52, 0x49, 0x54, 0x45, 0x5f, 0x50, 0x52, 0x45, 0x43, 0x4f, 0x4d, 0x50, 0x55, 0x54, 0x45, 0x44,
+	0x5f, 0x51, 0x55, 0x45, 0x52, 0x49, 0x45, 0x53, 0x10, 0x01, 0x12, 0x1a, 0x0a, 0x16, 0x57, 0x52,
+	0x49, 0x54, 0x45, 0x5f, 0x44, 0x49, 0x53, 0x54, 0x49, 0x4e, 0x43, 0x54, 0x5f, 0x43, 0x4c, 0x49,
+	0x45, 0x4e, 0x54, 0x53, 0x10, 0x02, 0x12, 0x12, 0x0a, 0x0e, 0x57, 0x52, 0x49, 0x54, 0x45, 0x5f,
+	0x45, 0x4e, 0x54, 0x49, 0x54, 0x49, 0x45, 0x53, 0x10, 0x03, 0x12, 0x17, 0x0a, 0x13, 0x57, 0x52,
+	0x49, 0x54, 0x45, 0x5f, 0x44, 0x49, 0x52, 0x45, 0x43, 0x54, 0x5f, 0x54, 0x4f, 0x4b, 0x45, 0x4e,
+	0x53, 0x10, 0x04, 0x12, 0x15, 0x0a, 0x11, 0x57, 0x52, 0x49, 0x54, 0x45, 0x5f, 0x49, 0x4e, 0x54,
+	0x45, 0x4e, 0x54, 0x5f, 0x4c, 0x4f, 0x47, 0x53, 0x10, 0x05, 0x2a, 0x5a, 0x0a, 0x13, 0x53, 0x65,
+	0x67, 0x6d, 0x65, 0x6e, 0x74, 0x44, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x1d, 0x0a, 0x19, 0x53, 0x45, 0x47, 0x4d, 0x45, 0x4e, 0x54, 0x5f, 0x44, 0x49, 0x53,
+	0x54, 0x52, 0x49, 0x42, 0x55, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x46, 0x49, 0x4c, 0x4c, 0x10, 0x00,
+	0x12, 0x24, 0x0a, 0x20, 0x53, 0x45, 0x47, 0x4d, 0x45, 0x4e, 0x54, 0x5f, 0x44, 0x49, 0x53, 0x54,
+	0x52, 0x49, 0x42, 0x55, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x52, 0x4f, 0x55, 0x4e, 0x44, 0x5f, 0x52,
+	0x4f, 0x42, 0x49, 0x4e, 0x10, 0x01, 0x2a, 0x62, 0x0a, 0x15, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70,
+	0x61, 0x63, 0x65, 0x44, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x26, 0x0a, 0x22, 0x4e, 0x41, 0x4d, 0x45, 0x53, 0x50, 0x41, 0x43, 0x45, 0x5f, 0x44, 0x49, 0x53,
+	0x54, 0x52, 0x49, 0x42, 0x55, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x52, 0x4f, 0x55, 0x4e, 0x44, 0x5f,
+	0x52, 0x4f, 0x42, 0x49, 0x4e, 0x10, 0x00, 0x12, 0x21, 0x0a, 0x1d, 0x4e, 0x41, 0x4d, 0x45, 0x53,
+	0x50, 0x41, 0x43, 0x45, 0x5f, 0x44, 0x49, 0x53, 0x54, 0x52, 0x49, 0x42, 0x55, 0x54, 0x49, 0x4f,
+	0x4e, 0x5f, 0x52, 0x41, 0x4e, 0x44, 0x4f, 0x4d, 0x10, 0x01, 0x42, 0x36, 0x5a, 0x34, 0x67, 0x69,
+	0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x68, 0x61, 0x73, 0x68, 0x69, 0x63, 0x6f,
+	0x72, 0x70, 0x2f, 0x76, 0x61, 0x75, 0x6c, 0x74, 0x2f, 0x76, 0x61, 0x75, 0x6c, 0x74, 0x2f, 0x61,
+	0x63, 0x74, 0x69, 0x76, 0x69, 0x74, 0x79, 0x2f, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -618,30 +1197,42 @@ func file_vault_activity_generation_generate_data_proto_rawDescGZIP() []byte {
 	return file_vault_activity_generation_generate_data_proto_rawDescData
 }
 
-var file_vault_activity_generation_generate_data_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_vault_activity_generation_generate_data_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_vault_activity_generation_generate_data_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_vault_activity_generation_generate_data_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_vault_activity_generation_generate_data_proto_goTypes = []interface{}{
 	(WriteOptions)(0),            // 0: generation.WriteOptions
-	(*ActivityLogMockInput)(nil), // 1: generation.ActivityLogMockInput
-	(*Data)(nil),                 // 2: generation.Data
-	(*Segments)(nil),             // 3: generation.Segments
-	(*Segment)(nil),              // 4: generation.Segment
-	(*Clients)(nil),              // 5: generation.Clients
-	(*Client)(nil),               // 6: generation.Client
+	(SegmentDistribution)(0),     // 1: generation.SegmentDistribution
+	(NamespaceDistribution)(0),   // 2: generation.NamespaceDistribution
+	(*ActivityLogMockInput)(nil), // 3: generation.ActivityLogMockInput
+	(*Data)(nil),                 // 4: generation.Data
+	(*ClientMatrix)(nil),         // 5: generation.ClientMatrix
+	(*Segments)(nil),             // 6: generation.Segments
+	(*Segment)(nil),              // 7: generation.Segment
+	(*Clients)(nil),              // 8: generation.Clients
+	(*Client)(nil),               // 9: generation.Client
+	nil,                          // 10: generation.Data.SegmentCapacitiesEntry
+	nil,                          // 11: generation.Client.MetadataEntry
 }
 var file_vault_activity_generation_generate_data_proto_depIdxs = []int32{
-	0, // 0: generation.ActivityLogMockInput.write:type_name -> generation.WriteOptions
-	2, // 1: generation.ActivityLogMockInput.data:type_name -> generation.Data
-	5, // 2: generation.Data.all:type_name -> generation.Clients
-	3, // 3: generation.Data.segments:type_name -> generation.Segments
-	4, // 4: generation.Segments.segments:type_name -> generation.Segment
-	5, // 5: generation.Segment.clients:type_name -> generation.Clients
-	6, // 6: generation.Clients.clients:type_name -> generation.Client
-	7, // [7:7] is the sub-list for method output_type
-	7, // [7:7] is the sub-list for method input_type
-	7, // [7:7] is the sub-list for extension type_name
-	7, // [7:7] is the sub-list for extension extendee
-	0, // [0:7] is the sub-list for field type_name
+	0,  // 0: generation.ActivityLogMockInput.write:type_name -> generation.WriteOptions
+	4,  // 1: generation.ActivityLogMockInput.data:type_name -> generation.Data
+	8,  // 2: generation.Data.all:type_name -> generation.Clients
+	6,  // 3: generation.Data.segments:type_name -> generation.Segments
+	10, // 4: generation.Data.segment_capacities:type_name -> generation.Data.SegmentCapacitiesEntry
+	5,  // 5: generation.Data.matrices:type_name -> generation.ClientMatrix
+	1,  // 6: generation.Data.segment_distribution:type_name -> generation.SegmentDistribution
+	2,  // 7: generation.ClientMatrix.distribution:type_name -> generation.NamespaceDistribution
+	9,  // 8: generation.ClientMatrix.client:type_name -> generation.Client
+	7,  // 9: generation.Segments.segments:type_name -> generation.Segment
+	8,  // 10: generation.Segment.clients:type_name -> generation.Clients
+	9,  // 11: generation.Clients.clients:type_name -> generation.Client
+	2,  // 12: generation.Clients.namespace_distribution:type_name -> generation.NamespaceDistribution
+	11, // 13: generation.Client.metadata:type_name -> generation.Client.MetadataEntry
+	14, // [14:14] is the sub-list for method output_type
+	14, // [14:14] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
 }
 
 func init() { file_vault_activity_generation_generate_data_proto_init() }
@@ -675,7 +1266,7 @@ func file_vault_activity_generation_generate_data_proto_init() {
 			}
 		}
 		file_vault_activity_generation_generate_data_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Segments); i {
+			switch v := v.(*ClientMatrix); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -687,7 +1278,7 @@ func file_vault_activity_generation_generate_data_proto_init() {
 			}
 		}
 		file_vault_activity_generation_generate_data_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Segment); i {
+			switch v := v.(*Segments); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -699,7 +1290,7 @@ func file_vault_activity_generation_generate_data_proto_init() {
 			}
 		}
 		file_vault_activity_generation_generate_data_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Clients); i {
+			switch v := v.(*Segment); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -711,6 +1302,18 @@ func file_vault_activity_generation_generate_data_proto_init() {
 			}
 		}
 		file_vault_activity_generation_generate_data_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Clients); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_vault_activity_generation_generate_data_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Client); i {
 			case 0:
 				return &v.state
@@ -723,20 +1326,22 @@ func file_vault_activity_generation_generate_data_proto_init() {
 			}
 		}
 	}
+	file_vault_activity_generation_generate_data_proto_msgTypes[0].OneofWrappers = []interface{}{}
 	file_vault_activity_generation_generate_data_proto_msgTypes[1].OneofWrappers = []interface{}{
 		(*Data_CurrentMonth)(nil),
 		(*Data_MonthsAgo)(nil),
 		(*Data_All)(nil),
 		(*Data_Segments)(nil),
 	}
-	file_vault_activity_generation_generate_data_proto_msgTypes[3].OneofWrappers = []interface{}{}
+	file_vault_activity_generation_generate_data_proto_msgTypes[4].OneofWrappers = []interface{}{}
+	file_vault_activity_generation_generate_data_proto_msgTypes[6].OneofWrappers = []interface{}{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_vault_activity_generation_generate_data_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   6,
+			NumEnums:      3,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,117 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package generation
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/hashicorp/go-multierror"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExpandMatrices adds a client to all of the month's clients for each
+// combination of a matrix's namespaces and mounts that gets some of its count.
+// Round robin distribution gives every combination the same count, give or
+// take one. Random distribution uses r, when it's set, so that the expansion
+// is repeatable with a seed. The namespaces and mounts aren't checked here,
+// they're validated with the rest of the month's clients
+func (d *Data) ExpandMatrices(r *rand.Rand) error {
+	if len(d.GetMatrices()) == 0 {
+		return nil
+	}
+	if d.GetSegments() != nil {
+		return fmt.Errorf("month %d: matrices can only be used for all of a month's clients, not for segments", d.GetMonthsAgo())
+	}
+	var errs *multierror.Error
+	for _, matrix := range d.GetMatrices() {
+		if err := matrix.validate(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: %w", d.GetMonthsAgo(), err))
+		}
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return err
+	}
+
+	if d.GetAll() == nil {
+		d.Clients = &Data_All{All: &Clients{}}
+	}
+	for _, matrix := range d.GetMatrices() {
+		clients, err := matrix.expand(r)
+		if err != nil {
+			return fmt.Errorf("month %d: %w", d.GetMonthsAgo(), err)
+		}
+		d.GetAll().Clients = append(d.GetAll().Clients, clients...)
+	}
+	d.Matrices = nil
+	return nil
+}
+
+// validate checks the matrix's count and its client template
+func (m *ClientMatrix) validate() error {
+	var errs *multierror.Error
+	if m.GetCount() < 1 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid matrix count %d: must be positive", m.GetCount()))
+	}
+	c := m.GetClient()
+	if c.GetNamespace() != "" || c.GetMount() != "" || c.GetCount() != 0 {
+		errs = multierror.Append(errs, errors.New("a matrix client can't have a namespace, mount or count, they're given by the matrix"))
+	}
+	if c.GetId() != "" || len(c.GetIds()) > 0 || c.GetMountType() != "" || c.GetNumMounts() != 0 {
+		errs = multierror.Append(errs, errors.New("a matrix client can't have an id, ids, mount type or num mounts"))
+	}
+	return errs.ErrorOrNil()
+}
+
+// expand returns the matrix's clients, in the order of its namespaces and then
+// its mounts
+func (m *ClientMatrix) expand(r *rand.Rand) ([]*Client, error) {
+	namespaces := m.GetNamespaces()
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	mounts := m.GetMounts()
+	if len(mounts) == 0 {
+		mounts = []string{""}
+	}
+	numCombinations := len(namespaces) * len(mounts)
+
+	counts := make([]int32, numCombinations)
+	switch m.GetDistribution() {
+	case NamespaceDistribution_NAMESPACE_DISTRIBUTION_ROUND_ROBIN:
+		for i := 0; i < int(m.GetCount()); i++ {
+			counts[i%numCombinations]++
+		}
+	case NamespaceDistribution_NAMESPACE_DISTRIBUTION_RANDOM:
+		intn := rand.Intn
+		if r != nil {
+			intn = r.Intn
+		}
+		for i := 0; i < int(m.GetCount()); i++ {
+			counts[intn(numCombinations)]++
+		}
+	default:
+		return nil, fmt.Errorf("unknown matrix distribution %s", m.GetDistribution())
+	}
+
+	clients := make([]*Client, 0, numCombinations)
+	for i, ns := range namespaces {
+		for j, mount := range mounts {
+			count := counts[i*len(mounts)+j]
+			if count == 0 {
+				continue
+			}
+			c := &Client{}
+			if m.GetClient() != nil {
+				c = proto.Clone(m.GetClient()).(*Client)
+			}
+			c.Namespace = ns
+			c.Mount = mount
+			c.Count = proto.Int32(count)
+			clients = append(clients, c)
+		}
+	}
+	return clients, nil
+}
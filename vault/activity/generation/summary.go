@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package generation
+
+import "time"
+
+// WriteSummary describes the data generated by the activity write endpoint.
+// It's returned as "summary" when the request sets "structured_summary", and
+// its JSON field names are stable, so that test tooling can unmarshal the
+// response into it
+type WriteSummary struct {
+	// Months has a summary of each month with data, the most recent first
+	Months []MonthSummary `json:"months"`
+
+	// Paths are the storage paths of every segment written, which is empty
+	// for dry runs and returned segments
+	Paths []string `json:"paths"`
+
+	// StoragePrefix is the directory under the system view that the data was
+	// written to, when it was written
+	StoragePrefix string `json:"storage_prefix,omitempty"`
+
+	// ClearedEntries is the number of existing storage entries removed
+	// because of "overwrite"
+	ClearedEntries int `json:"cleared_entries"`
+}
+
+// MonthSummary describes the data generated for one month
+type MonthSummary struct {
+	MonthsAgo int       `json:"months_ago"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+
+	// NumClients is the number of clients in the month, including repeated
+	// clients, and ClientsByType is that number by client type
+	NumClients    int            `json:"num_clients"`
+	ClientsByType map[string]int `json:"clients_by_type"`
+
+	// GeneratedClientIDs are the IDs generated for the month's new clients
+	// that didn't have an id
+	GeneratedClientIDs []string `json:"generated_client_ids"`
+
+	// RepeatedClients is the number of clients repeated from each earlier
+	// month, keyed by months ago
+	RepeatedClients map[int]int `json:"repeated_clients"`
+
+	// ReturningSplit is the number of new and returning clients that the
+	// clients with a returning ratio were split into
+	ReturningSplit ReturningSplit `json:"returning_split"`
+
+	// EntityTokens is the number of the month's non-entity token clients that
+	// belong to an entity client by "tokens_per_entity", whether they were
+	// generated with it or repeated with it
+	EntityTokens int `json:"entity_tokens"`
+
+	// Segments are the month's segments in index order, without the skipped
+	// segment indexes, and EmptySegments is the number of usable segments
+	// that didn't get any clients
+	Segments      []SegmentSummary `json:"segments"`
+	EmptySegments int              `json:"empty_segments"`
+
+	// Paths are the storage paths of the month's written segments
+	Paths []string `json:"paths"`
+}
+
+// SegmentSummary describes one segment of a month
+type SegmentSummary struct {
+	Index      int `json:"index"`
+	NumClients int `json:"num_clients"`
+}
+
+// ReturningSplit is the number of new and returning clients of a month's
+// clients with a returning ratio
+type ReturningSplit struct {
+	New       int `json:"new"`
+	Returning int `json:"returning"`
+}
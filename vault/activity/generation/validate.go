@@ -0,0 +1,132 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package generation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Validate checks the fields of the input that can be checked without a
+// running Vault, and returns all of the problems it finds as one error
+func (a *ActivityLogMockInput) Validate() error {
+	var errs *multierror.Error
+	if len(a.GetWrite()) == 0 {
+		errs = multierror.Append(errs, errors.New("missing required \"write\" values"))
+	}
+	for _, opt := range a.GetWrite() {
+		switch opt {
+		case WriteOptions_WRITE_PRECOMPUTED_QUERIES,
+			WriteOptions_WRITE_DISTINCT_CLIENTS,
+			WriteOptions_WRITE_ENTITIES,
+			WriteOptions_WRITE_INTENT_LOGS:
+		default:
+			errs = multierror.Append(errs, fmt.Errorf("unsupported write option %s", opt))
+		}
+	}
+	switch a.GetOutput() {
+	case "", "write", "return":
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unsupported output %q: must be \"write\" or \"return\"", a.GetOutput()))
+	}
+	if a.GetOverwrite() && a.GetOutput() == "return" {
+		errs = multierror.Append(errs, errors.New("\"overwrite\" can't be used with output \"return\""))
+	}
+	if len(a.GetData()) == 0 {
+		errs = multierror.Append(errs, errors.New("missing required \"data\" values"))
+	}
+	if a.GetWorkers() < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid \"workers\" value %d: must not be negative", a.GetWorkers()))
+	}
+	if a.GetCheckpointSize() < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid \"checkpoint_size\" value %d: must not be negative", a.GetCheckpointSize()))
+	}
+	for _, month := range a.GetData() {
+		errs = multierror.Append(errs, month.validate())
+	}
+	return errs.ErrorOrNil()
+}
+
+// validate checks the month's segment options and the clients in it
+func (d *Data) validate() error {
+	var errs *multierror.Error
+	if d.GetMonthsAgo() < 0 {
+		return fmt.Errorf("invalid \"months_ago\" value %d: must not be negative", d.GetMonthsAgo())
+	}
+	if d.GetNumSegments() < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("month %d: invalid \"num_segments\" value %d: must not be negative", d.GetMonthsAgo(), d.GetNumSegments()))
+	}
+	if d.GetSegmentByteSize() < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("month %d: invalid \"segment_byte_size\" value %d: must not be negative", d.GetMonthsAgo(), d.GetSegmentByteSize()))
+	}
+	for index, capacity := range d.GetSegmentCapacities() {
+		if index < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: invalid \"segment_capacities\" index %d: must not be negative", d.GetMonthsAgo(), index))
+		}
+		if capacity < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: invalid \"segment_capacities\" value %d for segment %d: must not be negative", d.GetMonthsAgo(), capacity, index))
+		}
+	}
+	clients := d.GetAll().GetClients()
+	for _, segment := range d.GetSegments().GetSegments() {
+		clients = append(clients, segment.GetClients().GetClients()...)
+	}
+	for _, c := range clients {
+		switch {
+		case c.GetCount() < 0:
+			errs = multierror.Append(errs, fmt.Errorf("month %d: invalid client count %d: must not be negative", d.GetMonthsAgo(), c.GetCount()))
+		case c.Count != nil && c.GetCount() == 0:
+			errs = multierror.Append(errs, fmt.Errorf("month %d: invalid client count 0: must be positive, leave count out for one client", d.GetMonthsAgo()))
+		}
+		if c.GetRepeatedFromMonth() < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: invalid \"repeated_from_month\" value %d: must not be negative", d.GetMonthsAgo(), c.GetRepeatedFromMonth()))
+		}
+		if c.GetNumMounts() < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: invalid \"num_mounts\" value %d: must not be negative", d.GetMonthsAgo(), c.GetNumMounts()))
+		}
+		if ratio := c.GetEntityRatio(); ratio < 0 || ratio > 1 {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: entity ratio %v must be between 0 and 1", d.GetMonthsAgo(), ratio))
+		}
+		if len(c.GetIds()) > 0 {
+			errs = multierror.Append(errs, c.validateIDs(d.GetMonthsAgo()))
+		}
+		if c.GetLocal() {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: local clients are not supported, as the activity log doesn't store local segments", d.GetMonthsAgo()))
+		}
+		if c.GetTokensPerEntity() < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: invalid \"tokens_per_entity\" value %d: must not be negative", d.GetMonthsAgo(), c.GetTokensPerEntity()))
+		}
+		if c.GetTokensPerEntity() > 0 && (c.GetRepeated() || c.GetRepeatedFromMonth() > 0 || c.GetRepeatedPercent() != 0 || c.GetRepeatedFromAll()) {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: \"tokens_per_entity\" can't be set on repeated clients, whose tokens are repeated with them", d.GetMonthsAgo()))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// validateIDs checks the ids of a client in month monthsAgo, which must be
+// non-empty and unique. They're the IDs of new clients, so they can't be used
+// with an id, or for clients that are repeated from earlier months
+func (c *Client) validateIDs(monthsAgo int32) error {
+	var errs *multierror.Error
+	if c.GetId() != "" {
+		errs = multierror.Append(errs, fmt.Errorf("month %d: id %s and ids can't both be set", monthsAgo, c.GetId()))
+	}
+	if c.GetRepeated() || c.GetRepeatedFromMonth() > 0 || c.GetRepeatedPercent() != 0 || c.GetRepeatedFromAll() || c.ReturningRatio != nil {
+		errs = multierror.Append(errs, fmt.Errorf("month %d: ids can't be set on repeated clients", monthsAgo))
+	}
+	seen := make(map[string]struct{}, len(c.GetIds()))
+	for i, id := range c.GetIds() {
+		if id == "" {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: ids[%d] is empty", monthsAgo, i))
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			errs = multierror.Append(errs, fmt.Errorf("month %d: ids has id %s more than once", monthsAgo, id))
+		}
+		seen[id] = struct{}{}
+	}
+	return errs.ErrorOrNil()
+}
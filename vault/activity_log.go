@@ -84,6 +84,8 @@ const (
 	// to support additional buckets for e.g., ACME requests.
 	nonEntityTokenActivityType = "non-entity-token"
 	entityActivityType         = "entity"
+	acmeActivityType           = "acme"
+	secretSyncActivityType     = "secret-sync"
 )
 
 type segmentInfo struct {
@@ -409,22 +411,31 @@ func (a *ActivityLog) saveCurrentSegmentToStorageLocked(ctx context.Context, for
 
 // :force: forces a save of tokens/entities even if the in-memory log is empty
 func (a *ActivityLog) saveCurrentSegmentInternal(ctx context.Context, force bool) error {
-	entityPath := fmt.Sprintf("%s%d/%d", activityEntityBasePath, a.currentSegment.startTimestamp, a.currentSegment.clientSequenceNumber)
-	// RFC (VLT-120) defines this as 1-indexed, but it should be 0-indexed
-	tokenPath := fmt.Sprintf("%s%d/0", activityTokenBasePath, a.currentSegment.startTimestamp)
+	_, err := a.saveSegmentEntitiesInternal(ctx, a.currentSegment, force)
+	if err != nil {
+		return err
+	}
+	_, err = a.saveSegmentTokensInternal(ctx, a.currentSegment, force)
+	return err
+}
+
+// saveSegmentEntitiesInternal writes the entity clients of the given segment
+// to storage, and returns the path that was written
+func (a *ActivityLog) saveSegmentEntitiesInternal(ctx context.Context, currentSegment segmentInfo, force bool) (string, error) {
+	entityPath := fmt.Sprintf("%s%d/%d", activityEntityBasePath, currentSegment.startTimestamp, currentSegment.clientSequenceNumber)
 
-	for _, client := range a.currentSegment.currentClients.Clients {
+	for _, client := range currentSegment.currentClients.Clients {
 		// Explicitly catch and throw clear error message if client ID creation and storage
 		// results in a []byte that doesn't assert into a valid string.
 		if !utf8.ValidString(client.ClientID) {
-			return fmt.Errorf("client ID %q is not a valid string:", client.ClientID)
+			return "", fmt.Errorf("client ID %q is not a valid string:", client.ClientID)
 		}
 	}
 
-	if len(a.currentSegment.currentClients.Clients) > 0 || force {
-		clients, err := proto.Marshal(a.currentSegment.currentClients)
+	if len(currentSegment.currentClients.Clients) > 0 || force {
+		clients, err := proto.Marshal(currentSegment.currentClients)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		a.logger.Trace("writing segment", "path", entityPath)
@@ -433,31 +444,39 @@ func (a *ActivityLog) saveCurrentSegmentInternal(ctx context.Context, force bool
 			Value: clients,
 		})
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
+	return entityPath, nil
+}
+
+// saveSegmentTokensInternal writes the token count of the given segment to
+// storage, and returns the path that was written
+func (a *ActivityLog) saveSegmentTokensInternal(ctx context.Context, currentSegment segmentInfo, force bool) (string, error) {
+	// RFC (VLT-120) defines this as 1-indexed, but it should be 0-indexed
+	tokenPath := fmt.Sprintf("%s%d/0", activityTokenBasePath, currentSegment.startTimestamp)
 
 	// We must still allow for the tokenCount of the current segment to
 	// be written to storage, since if we remove this code we will incur
 	// data loss for one segment's worth of TWEs.
-	if len(a.currentSegment.tokenCount.CountByNamespaceID) > 0 || force {
+	if len(currentSegment.tokenCount.CountByNamespaceID) > 0 || force {
 		// We can get away with simply using the oldest version stored because
 		// the storing of versions was introduced at the same time as this code.
 		oldestVersion, oldestUpgradeTime, err := a.core.FindOldestVersionTimestamp()
 		switch {
 		case err != nil:
 			a.logger.Error(fmt.Sprintf("unable to retrieve oldest version timestamp: %s", err.Error()))
-		case len(a.currentSegment.tokenCount.CountByNamespaceID) > 0 &&
+		case len(currentSegment.tokenCount.CountByNamespaceID) > 0 &&
 			(oldestUpgradeTime.Add(time.Duration(trackedTWESegmentPeriod * time.Hour)).Before(a.clock.Now())):
 			a.logger.Error(fmt.Sprintf("storing nonzero token count over a month after vault was upgraded to %s", oldestVersion))
 		default:
-			if len(a.currentSegment.tokenCount.CountByNamespaceID) > 0 {
+			if len(currentSegment.tokenCount.CountByNamespaceID) > 0 {
 				a.logger.Info("storing nonzero token count")
 			}
 		}
-		tokenCount, err := proto.Marshal(a.currentSegment.tokenCount)
+		tokenCount, err := proto.Marshal(currentSegment.tokenCount)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		a.logger.Trace("writing segment", "path", tokenPath)
@@ -466,10 +485,10 @@ func (a *ActivityLog) saveCurrentSegmentInternal(ctx context.Context, force bool
 			Value: tokenCount,
 		})
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
-	return nil
+	return tokenPath, nil
 }
 
 // parseSegmentNumberFromPath returns the segment number from a path
@@ -1378,15 +1397,7 @@ func (a *ActivityLog) HandleEndOfMonth(ctx context.Context, currentTime time.Tim
 	nextSegmentTimestamp := timeutil.StartOfMonth(currentTime.UTC()).Unix()
 
 	// Write out an intent log for the rotation with the current and new segment times.
-	intentLog := &ActivityIntentLog{
-		PreviousMonth: prevSegmentTimestamp,
-		NextMonth:     nextSegmentTimestamp,
-	}
-	entry, err := logical.StorageEntryJSON(activityIntentLogKey, intentLog)
-	if err != nil {
-		return err
-	}
-	err = a.view.Put(ctx, entry)
+	err := a.writeIntentLog(ctx, prevSegmentTimestamp, nextSegmentTimestamp)
 	if err != nil {
 		return err
 	}
@@ -1417,6 +1428,20 @@ func (a *ActivityLog) HandleEndOfMonth(ctx context.Context, currentTime time.Tim
 	return nil
 }
 
+// writeIntentLog writes out an intent log for the month rotation, so that the
+// precomputed query worker can process the previous month
+func (a *ActivityLog) writeIntentLog(ctx context.Context, prevSegmentTimestamp int64, nextSegmentTimestamp int64) error {
+	intentLog := &ActivityIntentLog{
+		PreviousMonth: prevSegmentTimestamp,
+		NextMonth:     nextSegmentTimestamp,
+	}
+	entry, err := logical.StorageEntryJSON(activityIntentLogKey, intentLog)
+	if err != nil {
+		return err
+	}
+	return a.view.Put(ctx, entry)
+}
+
 // ResetActivityLog is used to extract the current fragment(s) during
 // integration testing, so that it can be checked in a race-free way.
 func (c *Core) ResetActivityLog() []*activity.LogFragment {
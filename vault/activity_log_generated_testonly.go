@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build testonly
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/helper/timeutil"
+	"github.com/hashicorp/vault/vault/activity"
+	"google.golang.org/protobuf/proto"
+)
+
+// GeneratedClientKey identifies the clients of one namespace, mount and client
+// type in a GeneratedMonth
+type GeneratedClientKey struct {
+	NamespaceID   string
+	MountAccessor string
+	ClientType    string
+}
+
+// GeneratedMonth is a normalized view of a month's entity segments, such as
+// the ones written by the activity write endpoint. It doesn't depend on how
+// the clients were split into segments, so tests can compare it to the
+// expected counts directly
+type GeneratedMonth struct {
+	Start time.Time
+
+	// Counts are the number of clients in the month's segments
+	Counts map[GeneratedClientKey]int
+}
+
+// NumClients returns the number of clients in the month's segments
+func (m *GeneratedMonth) NumClients() int {
+	total := 0
+	for _, count := range m.Counts {
+		total += count
+	}
+	return total
+}
+
+// Diff returns a sorted line for each namespace, mount and client type whose
+// count in the month differs from want's, and nothing when they're the same
+func (m *GeneratedMonth) Diff(want *GeneratedMonth) []string {
+	keys := make(map[GeneratedClientKey]struct{}, len(m.Counts)+len(want.Counts))
+	for key := range m.Counts {
+		keys[key] = struct{}{}
+	}
+	for key := range want.Counts {
+		keys[key] = struct{}{}
+	}
+	var diffs []string
+	for key := range keys {
+		if m.Counts[key] != want.Counts[key] {
+			diffs = append(diffs, fmt.Sprintf("clients of type %s in namespace %s, mount %s: got %d, want %d", key.ClientType, key.NamespaceID, key.MountAccessor, m.Counts[key], want.Counts[key]))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// ReadGeneratedMonths reads the entity segments of the months from start's
+// month to end's month, including both, and returns a GeneratedMonth for each
+// month that has segments, the most recent first. Records without a client
+// type are counted as entity or non-entity token clients
+func (a *ActivityLog) ReadGeneratedMonths(ctx context.Context, start time.Time, end time.Time) ([]*GeneratedMonth, error) {
+	start = timeutil.StartOfMonth(start.UTC())
+	end = timeutil.StartOfMonth(end.UTC())
+	if end.Before(start) {
+		return nil, fmt.Errorf("end %s is before start %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+
+	timestamps, err := a.view.List(ctx, activityEntityBasePath)
+	if err != nil {
+		return nil, err
+	}
+	var months []*GeneratedMonth
+	for _, timestamp := range timestamps {
+		monthStart, err := timeutil.ParseTimeFromPath(timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if monthStart.Before(start) || monthStart.After(end) {
+			continue
+		}
+		month := &GeneratedMonth{
+			Start:  monthStart,
+			Counts: make(map[GeneratedClientKey]int),
+		}
+		if err := a.countSegmentClients(ctx, activityEntityBasePath+timestamp, month.Counts); err != nil {
+			return nil, err
+		}
+		months = append(months, month)
+	}
+
+	sort.Slice(months, func(i, j int) bool {
+		return months[i].Start.After(months[j].Start)
+	})
+	return months, nil
+}
+
+// countSegmentClients adds the clients of each segment in the directory to
+// counts
+func (a *ActivityLog) countSegmentClients(ctx context.Context, dir string, counts map[GeneratedClientKey]int) error {
+	segments, err := a.view.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		raw, err := a.view.Get(ctx, dir+segment)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			continue
+		}
+		out := &activity.EntityActivityLog{}
+		if err := proto.Unmarshal(raw.Value, out); err != nil {
+			return fmt.Errorf("unable to parse segment %s%s: %w", dir, segment, err)
+		}
+		for _, client := range out.Clients {
+			clientType := client.ClientType
+			if clientType == "" {
+				clientType = entityActivityType
+				if client.NonEntity {
+					clientType = nonEntityTokenActivityType
+				}
+			}
+			counts[GeneratedClientKey{
+				NamespaceID:   client.NamespaceID,
+				MountAccessor: client.MountAccessor,
+				ClientType:    clientType,
+			}]++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build testonly
+
+package vault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/helper/timeutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// TestActivityLog_ReadGeneratedMonths verifies that the months written by the
+// activity write endpoint are read back as client counts by namespace, mount
+// and client type, and that only the months in the range are returned
+func TestActivityLog_ReadGeneratedMonths(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":3,"all":{"clients":[{"count":1,"mount":"secret/"}]}},
+		{"months_ago":2,"num_segments":3,"all":{"clients":[{"count":4,"mount":"secret/"},{"count":2,"mount":"secret/","non_entity":true}]}},
+		{"months_ago":1,"all":{"clients":[{"count":2,"mount":"cubbyhole/","client_type":"acme"},{"count":1,"mount":"secret/","repeated":true}]}}
+	]}`}
+	_, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+
+	nctx := namespace.ContextWithNamespace(ctx, namespace.RootNamespace)
+	secret := core.router.MatchingMountEntry(nctx, "secret/").Accessor
+	cubbyhole := core.router.MatchingMountEntry(nctx, "cubbyhole/").Accessor
+	now := timeutil.StartOfMonth(a.clock.Now().UTC())
+
+	months, err := a.ReadGeneratedMonths(context.Background(), monthTimestamp(2, now), monthTimestamp(1, now).AddDate(0, 0, 10))
+	require.NoError(t, err)
+	require.Len(t, months, 2)
+
+	require.Equal(t, monthTimestamp(1, now), months[0].Start)
+	require.Equal(t, map[GeneratedClientKey]int{
+		{NamespaceID: namespace.RootNamespaceID, MountAccessor: cubbyhole, ClientType: acmeActivityType}: 2,
+		{NamespaceID: namespace.RootNamespaceID, MountAccessor: secret, ClientType: entityActivityType}:  1,
+	}, months[0].Counts)
+	require.Equal(t, 3, months[0].NumClients())
+
+	require.Equal(t, monthTimestamp(2, now), months[1].Start)
+	require.Equal(t, map[GeneratedClientKey]int{
+		{NamespaceID: namespace.RootNamespaceID, MountAccessor: secret, ClientType: entityActivityType}:         4,
+		{NamespaceID: namespace.RootNamespaceID, MountAccessor: secret, ClientType: nonEntityTokenActivityType}: 2,
+	}, months[1].Counts)
+	require.Equal(t, 6, months[1].NumClients())
+
+	months, err = a.ReadGeneratedMonths(context.Background(), now, now)
+	require.NoError(t, err)
+	require.Empty(t, months)
+
+	_, err = a.ReadGeneratedMonths(context.Background(), now, monthTimestamp(1, now))
+	require.ErrorContains(t, err, "is before start")
+}
+
+// TestGeneratedMonth_Diff verifies that a month's differences from the
+// expected counts are returned in a stable order
+func TestGeneratedMonth_Diff(t *testing.T) {
+	key := func(mount string, clientType string) GeneratedClientKey {
+		return GeneratedClientKey{NamespaceID: namespace.RootNamespaceID, MountAccessor: mount, ClientType: clientType}
+	}
+	got := &GeneratedMonth{
+		Counts: map[GeneratedClientKey]int{
+			key("kv", entityActivityType):     2,
+			key("pki", acmeActivityType):      1,
+			key("kv", secretSyncActivityType): 3,
+		},
+	}
+	require.Empty(t, got.Diff(got))
+
+	want := &GeneratedMonth{
+		Counts: map[GeneratedClientKey]int{
+			key("kv", entityActivityType):     2,
+			key("kv", secretSyncActivityType): 4,
+			key("ldap", entityActivityType):   1,
+		},
+	}
+	require.Equal(t, []string{
+		"clients of type acme in namespace root, mount pki: got 1, want 0",
+		"clients of type entity in namespace root, mount ldap: got 0, want 1",
+		"clients of type secret-sync in namespace root, mount kv: got 3, want 4",
+	}, got.Diff(want))
+}
@@ -7,19 +7,59 @@ package vault
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/helper/timeutil"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault/activity"
 	"github.com/hashicorp/vault/vault/activity/generation"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 const helpText = "Create activity log data for testing purposes"
 
+const (
+	// activityTestDataSubPath is the directory under the system view where
+	// datasets with a storage prefix are written. Each dataset has the same
+	// layout as the activity log's own directory
+	activityTestDataSubPath = "counters/activity-testdata/"
+
+	// maxMetadataKeyLength and maxMetadataValueLength limit the size of each
+	// label in a generated client's metadata
+	maxMetadataKeyLength   = 128
+	maxMetadataValueLength = 512
+)
+
+// maxGeneratedClients and maxGeneratedMonthClients limit the number of clients
+// that are generated in total and in each month. They're high enough for any
+// realistic test, while stopping a bad input from exhausting memory. Tests of
+// the limits lower them
+var (
+	maxGeneratedClients      = 5_000_000
+	maxGeneratedMonthClients = 1_000_000
+)
+
 func (b *SystemBackend) activityWritePath() *framework.Path {
 	return &framework.Path{
 		Pattern:         "internal/counters/activity/write$",
@@ -30,6 +70,22 @@ func (b *SystemBackend) activityWritePath() *framework.Path {
 				Type:        framework.TypeString,
 				Description: "JSON input for generating mock data",
 			},
+			"input_csv": {
+				Type:        framework.TypeString,
+				Description: "CSV client definitions for generating mock data, with the columns namespace, mount, client_type, count, months_ago, and repeated. The clients are added to the data in input",
+			},
+			"dry_run": {
+				Type:        framework.TypeBool,
+				Description: "Describe the data that would be generated, without writing it",
+			},
+			"validate_only": {
+				Type:        framework.TypeBool,
+				Description: "Only check that the namespaces and mounts referenced by the clients exist, and return the ones that don't as \"unresolved_references\", without generating any data",
+			},
+			"structured_summary": {
+				Type:        framework.TypeBool,
+				Description: "Also return a summary of the generated data as \"summary\", with the stable layout of generation.WriteSummary",
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.CreateOperation: &framework.PathOperation{
@@ -47,33 +103,538 @@ func (b *SystemBackend) handleActivityWriteData(ctx context.Context, request *lo
 	if err != nil {
 		return logical.ErrorResponse("Invalid input data: %s", err), logical.ErrInvalidRequest
 	}
-	if len(input.Write) == 0 {
-		return logical.ErrorResponse("Missing required \"write\" values"), logical.ErrInvalidRequest
+	if inputCSV := data.Get("input_csv").(string); inputCSV != "" {
+		csvData, err := parseActivityCSV(inputCSV)
+		if err != nil {
+			return logical.ErrorResponse("Invalid input CSV: %s", err), logical.ErrInvalidRequest
+		}
+		for _, month := range input.Data {
+			for _, csvMonth := range csvData {
+				if month.GetMonthsAgo() == csvMonth.GetMonthsAgo() {
+					return logical.ErrorResponse("Month %d is in both \"input\" and \"input_csv\"", month.GetMonthsAgo()), logical.ErrInvalidRequest
+				}
+			}
+		}
+		input.Data = append(input.Data, csvData...)
+	}
+	// the matrices are expanded first, so that their clients are validated
+	// like any other. A random expansion has its own source with the seed,
+	// so that it doesn't change the client IDs generated from the seed
+	var matrixRand *rand.Rand
+	if input.Seed != nil {
+		matrixRand = rand.New(rand.NewSource(input.GetSeed()))
+	}
+	for _, month := range input.Data {
+		if err := month.ExpandMatrices(matrixRand); err != nil {
+			return logical.ErrorResponse("Invalid input data: %s", err), logical.ErrInvalidRequest
+		}
+	}
+	resolveNamespaces(ctx, b.Core, input.Data)
+	if data.Get("validate_only").(bool) {
+		if data.Get("dry_run").(bool) {
+			return logical.ErrorResponse("\"validate_only\" can't be used with \"dry_run\""), logical.ErrInvalidRequest
+		}
+		unresolved, err := unresolvedReferences(ctx, b.Core, input.Data)
+		if err != nil {
+			return logical.ErrorResponse("failed to validate references"), err
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"valid":                 len(unresolved) == 0,
+				"unresolved_references": unresolved,
+			},
+		}, nil
+	}
+	if err := validateInput(ctx, b.Core, input, maxGeneratedClients, maxGeneratedMonthClients); err != nil {
+		return logical.ErrorResponse("Invalid input data: %s", err), logical.ErrInvalidRequest
+	}
+
+	opts := make(map[generation.WriteOptions]struct{}, len(input.Write))
+	for _, opt := range input.Write {
+		opts[opt] = struct{}{}
+	}
+	numMonths := 0
+	for _, month := range input.Data {
+		if int(month.GetMonthsAgo()) > numMonths {
+			numMonths = int(month.GetMonthsAgo())
+		}
+	}
+
+	// process the oldest months first, so that repeated clients can be
+	// taken from the months that they're repeated from
+	sort.SliceStable(input.Data, func(i, j int) bool {
+		return input.Data[i].GetMonthsAgo() > input.Data[j].GetMonthsAgo()
+	})
+	generated := newMultipleMonthsActivityClients(numMonths + 1)
+	// months are relative to the activity log's clock, which tests can set,
+	// or to the reference time. Its validity was checked with the input
+	generated.now = timeutil.StartOfMonth(b.Core.activityLog.clock.Now().UTC())
+	if input.ReferenceTime != "" {
+		referenceTime, _ := parseTimestamp(input.ReferenceTime)
+		generated.now = timeutil.StartOfMonth(referenceTime)
+	}
+	if input.Seed != nil {
+		generated.setSeed(input.GetSeed())
+	}
+	generated.checkpointSize = int(input.CheckpointSize)
+	generated.overwrite = input.Overwrite
+	if input.Workers > 0 {
+		generated.setWorkers(int(input.Workers))
+	} else {
+		generated.setWorkers(runtime.NumCPU())
+	}
+	for _, month := range input.Data {
+		err := generated.processMonth(ctx, b.Core, month)
+		if err != nil {
+			return logical.ErrorResponse("failed to process data for month %d", month.GetMonthsAgo()), err
+		}
+	}
+
+	if input.Output == "return" {
+		if data.Get("dry_run").(bool) {
+			return logical.ErrorResponse("\"dry_run\" can't be used with output \"return\""), logical.ErrInvalidRequest
+		}
+		err := generated.populateSegments()
+		if err != nil {
+			return logical.ErrorResponse("failed to segment data: %s", err), logical.ErrInvalidRequest
+		}
+		segments, err := generated.serializedSegments()
+		if err != nil {
+			return logical.ErrorResponse("failed to serialize segments"), err
+		}
+		resp := &logical.Response{
+			Data: map[string]interface{}{
+				"months":   generated.summary(),
+				"segments": segments,
+			},
+			Warnings: generated.warnings(),
+		}
+		if data.Get("structured_summary").(bool) {
+			resp.Data["summary"] = generated.writeSummary(nil, "")
+		}
+		return resp, nil
+	}
+
+	if data.Get("dry_run").(bool) {
+		err := generated.populateSegments()
+		if err != nil {
+			return logical.ErrorResponse("failed to segment data: %s", err), logical.ErrInvalidRequest
+		}
+		resp := &logical.Response{
+			Data: map[string]interface{}{
+				"dry_run": true,
+				"months":  generated.summary(),
+			},
+			Warnings: generated.warnings(),
+		}
+		if data.Get("structured_summary").(bool) {
+			resp.Data["summary"] = generated.writeSummary(nil, "")
+		}
+		return resp, nil
+	}
+
+	activityLog := b.Core.activityLog
+	storagePrefix := activitySubPath
+	if input.StoragePrefix != "" {
+		activityLog, storagePrefix, err = activityLogForPrefix(b.Core, input.StoragePrefix)
+		if err != nil {
+			return logical.ErrorResponse("failed to create activity log for storage prefix"), err
+		}
+	}
+	paths, err := generated.write(ctx, opts, activityLog)
+	if err != nil {
+		return logical.ErrorResponse("failed to write data"), err
+	}
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"paths":           paths,
+			"months":          generated.summary(),
+			"storage_prefix":  storagePrefix,
+			"cleared":         generated.clearedEntries > 0,
+			"cleared_entries": generated.clearedEntries,
+		},
+		Warnings: generated.warnings(),
+	}
+	if data.Get("structured_summary").(bool) {
+		resp.Data["summary"] = generated.writeSummary(paths, storagePrefix)
+	}
+	return resp, nil
+}
+
+// checkStoragePrefix verifies that a storage prefix is a relative path, without
+// any empty, "." or ".." elements
+func checkStoragePrefix(prefix string) error {
+	if strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("%q must not start with a /", prefix)
+	}
+	for _, element := range strings.Split(strings.TrimSuffix(prefix, "/"), "/") {
+		if element == "" || element == "." || element == ".." {
+			return fmt.Errorf("%q must not have empty, \".\" or \"..\" elements", prefix)
+		}
+	}
+	return nil
+}
+
+// activityLogForPrefix creates an activity log that stores its data under the
+// storage prefix, rather than with the core's activity log, and returns it with
+// the directory under the system view that it uses. The activity log isn't
+// started, so it's only used to write the generated data.
+//
+// Tests read the data back the same way, by creating an activity log with
+// NewActivityLog and a view of the directory, for example
+// core.systemBarrierView.SubView(activityTestDataSubPath + "my-dataset/")
+func activityLogForPrefix(core *Core, prefix string) (*ActivityLog, string, error) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	subPath := activityTestDataSubPath + prefix
+	logger := core.baseLogger.Named("activity-testdata")
+	a, err := NewActivityLog(core, logger, core.systemBarrierView.SubView(subPath), core.metricSink)
+	if err != nil {
+		return nil, "", err
+	}
+	return a, subPath, nil
+}
+
+// activityCSVColumns are the columns of the write endpoint's input CSV
+var activityCSVColumns = []string{"namespace", "mount", "client_type", "count", "months_ago", "repeated"}
+
+// parseActivityCSV parses CSV client definitions into months of clients. The
+// first row is the header, which must have each of activityCSVColumns in any
+// order. Each row after that is a client, which is added to the month given by
+// its months_ago column. Empty count, months_ago, and repeated columns default
+// to 1 client, the current month, and not repeated. The months are returned in
+// the order they first appear in, and all of the rows that fail to parse are
+// returned together
+func parseActivityCSV(contents string) ([]*generation.Data, error) {
+	reader := csv.NewReader(strings.NewReader(contents))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if !strutil.StrListContains(activityCSVColumns, column) {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+		if _, ok := columns[column]; ok {
+			return nil, fmt.Errorf("duplicate column %q", column)
+		}
+		columns[column] = i
+	}
+	for _, column := range activityCSVColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+
+	var errs *multierror.Error
+	months := make([]*generation.Data, 0)
+	monthsByAge := make(map[int32]*generation.Clients)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("row %d: %w", row, err))
+			continue
+		}
+		field := func(column string) string {
+			return strings.TrimSpace(record[columns[column]])
+		}
+		client := &generation.Client{
+			Namespace:  field("namespace"),
+			Mount:      field("mount"),
+			ClientType: field("client_type"),
+		}
+		var monthsAgo int32
+		if count := field("count"); count != "" {
+			n, err := strconv.ParseInt(count, 10, 32)
+			if err != nil || n < 1 {
+				errs = multierror.Append(errs, fmt.Errorf("row %d: invalid count %q", row, count))
+				continue
+			}
+			client.Count = proto.Int32(int32(n))
+		}
+		if ago := field("months_ago"); ago != "" {
+			n, err := strconv.ParseInt(ago, 10, 32)
+			if err != nil || n < 0 {
+				errs = multierror.Append(errs, fmt.Errorf("row %d: invalid months_ago %q", row, ago))
+				continue
+			}
+			monthsAgo = int32(n)
+		}
+		if repeated := field("repeated"); repeated != "" {
+			client.Repeated, err = strconv.ParseBool(repeated)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("row %d: invalid repeated %q", row, repeated))
+				continue
+			}
+		}
+
+		clients, ok := monthsByAge[monthsAgo]
+		if !ok {
+			clients = &generation.Clients{}
+			monthsByAge[monthsAgo] = clients
+			months = append(months, &generation.Data{
+				Month:   &generation.Data_MonthsAgo{MonthsAgo: monthsAgo},
+				Clients: &generation.Data_All{All: clients},
+			})
+		}
+		clients.Clients = append(clients.Clients, client)
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	return months, nil
+}
+
+// resolveNamespaces replaces the namespace paths referenced by the months with
+// the namespaces' IDs, so that the input can use either. A value that's the ID
+// of a namespace is kept, even if it's also the path of another namespace.
+// Values that don't resolve are kept as well, and are reported by
+// validateReferences
+func resolveNamespaces(ctx context.Context, core *Core, months []*generation.Data) {
+	resolve := func(value string) string {
+		if value == "" {
+			return value
+		}
+		if _, err := core.NamespaceByID(ctx, value); err == nil {
+			return value
+		}
+		path := strings.Trim(value, "/")
+		for _, ns := range core.ListNamespaces(true) {
+			if strings.Trim(ns.Path, "/") == path {
+				return ns.ID
+			}
+		}
+		return value
+	}
+
+	for _, month := range months {
+		namespaces := month.GetAll().GetNamespaces()
+		for i, ns := range namespaces {
+			namespaces[i] = resolve(ns)
+		}
+		for _, c := range monthClients(month) {
+			c.Namespace = resolve(c.Namespace)
+		}
+	}
+}
+
+// validateReferences checks that every namespace and mount referenced by the
+// clients exists, before any data is generated. All of the invalid references
+// are returned together
+func validateReferences(ctx context.Context, core *Core, months []*generation.Data) error {
+	unresolved, err := unresolvedReferences(ctx, core, months)
+	if err != nil {
+		return err
+	}
+	var errs *multierror.Error
+	for _, reference := range unresolved {
+		errs = multierror.Append(errs, errors.New(reference))
+	}
+	return errs.ErrorOrNil()
+}
+
+// unresolvedReferences returns a description of each namespace and mount
+// referenced by the clients that doesn't exist or can't be used, in the order
+// of the months and their clients
+func unresolvedReferences(ctx context.Context, core *Core, months []*generation.Data) ([]string, error) {
+	auths, err := listMountsWithRetry(ctx, "auth mounts", core.ListAuths)
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := listMountsWithRetry(ctx, "mounts", core.ListMounts)
+	if err != nil {
+		return nil, err
+	}
+	entries := append(append(make([]*MountEntry, 0, len(auths)+len(mounts)), auths...), mounts...)
+	unresolved := []string{}
+	for _, month := range months {
+		for _, nsID := range month.GetAll().GetNamespaces() {
+			if _, err := core.NamespaceByID(ctx, nsID); err != nil {
+				unresolved = append(unresolved, fmt.Sprintf("month %d: namespace %s does not exist as an ID or a path", month.GetMonthsAgo(), nsID))
+			}
+		}
+		for _, c := range monthClients(month) {
+			nsID := c.Namespace
+			if nsID == "" {
+				nsID = namespace.RootNamespaceID
+			}
+			ns, err := core.NamespaceByID(ctx, nsID)
+			if err != nil {
+				unresolved = append(unresolved, fmt.Sprintf("month %d: namespace %s does not exist as an ID or a path", month.GetMonthsAgo(), nsID))
+				continue
+			}
+			if c.NumMounts > 0 {
+				if _, err := firstMounts(entries, nsID, c); err != nil {
+					unresolved = append(unresolved, fmt.Sprintf("month %d: %s", month.GetMonthsAgo(), err))
+				}
+				continue
+			}
+			if c.MountType != "" {
+				if _, err := mountOfType(entries, nsID, c); err != nil {
+					unresolved = append(unresolved, fmt.Sprintf("month %d: %s", month.GetMonthsAgo(), err))
+				}
+				continue
+			}
+			if mountPath := clientMount(month, c); mountPath != "" {
+				nctx := namespace.ContextWithNamespace(ctx, ns)
+				mountEntry := core.router.MatchingMountEntry(nctx, mountPath)
+				if mountEntry == nil {
+					unresolved = append(unresolved, fmt.Sprintf("month %d: mount %s does not exist in namespace %s", month.GetMonthsAgo(), mountPath, nsID))
+				} else if err := checkMountVisible(ns, mountEntry); err != nil {
+					unresolved = append(unresolved, fmt.Sprintf("month %d: %s", month.GetMonthsAgo(), err))
+				}
+				continue
+			}
+			if nsID == namespace.RootNamespaceID {
+				continue
+			}
+			found := false
+			for _, mount := range mounts {
+				if mount.NamespaceID == nsID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				unresolved = append(unresolved, fmt.Sprintf("month %d: namespace %s has no mounts", month.GetMonthsAgo(), nsID))
+			}
+		}
+	}
+	return unresolved, nil
+}
+
+// checkClientLimits verifies that the months don't request more clients than
+// the limits, before any clients are generated. Clients that are repeated by
+// percentage aren't counted, as they can't be more than the clients of the
+// month they're repeated from
+func checkClientLimits(months []*generation.Data, maxClients int, maxMonthClients int) error {
+	total := 0
+	perMonth := make(map[int32]int)
+	for _, month := range months {
+		for _, c := range monthClients(month) {
+			if c.RepeatedPercent != 0 {
+				continue
+			}
+			// the tokens of new entity clients are generated with them
+			count := clientCount(c) * (1 + int(c.TokensPerEntity))
+			total += count
+			perMonth[month.GetMonthsAgo()] += count
+		}
+		if perMonth[month.GetMonthsAgo()] > maxMonthClients {
+			return fmt.Errorf("month %d has %d clients, which is more than the limit of %d clients per month", month.GetMonthsAgo(), perMonth[month.GetMonthsAgo()], maxMonthClients)
+		}
+	}
+	if total > maxClients {
+		return fmt.Errorf("%d clients requested, which is more than the limit of %d clients", total, maxClients)
+	}
+	return nil
+}
+
+// monthClients returns all of the clients in the month, whether they're in
+// predefined segments or not
+func monthClients(month *generation.Data) []*generation.Client {
+	if month.GetAll() != nil {
+		return month.GetAll().GetClients()
 	}
-	if len(input.Data) == 0 {
-		return logical.ErrorResponse("Missing required \"data\" values"), logical.ErrInvalidRequest
+	var clients []*generation.Client
+	for _, segment := range month.GetSegments().GetSegments() {
+		clients = append(clients, segment.GetClients().GetClients()...)
 	}
-	return nil, nil
+	return clients
+}
+
+// generatedClient is a generated client's entity record, along with the
+// parameters of the client that the activity log doesn't store. Repeated
+// clients share the generatedClient of the month they were generated in, so
+// they keep its parameters
+type generatedClient struct {
+	*activity.EntityRecord
+	// metadata holds the client's labels. It's only kept in memory, for the
+	// tests that use the generated data
+	metadata map[string]string
+	// tokens are the non-entity token clients generated with an entity client
+	// by tokens_per_entity, which are repeated along with it
+	tokens []*generatedClient
 }
 
 // singleMonthActivityClients holds a single month's client IDs, in the order they were seen
 type singleMonthActivityClients struct {
 	// clients are indexed by ID
-	clients []*activity.EntityRecord
+	clients []*generatedClient
 	// predefinedSegments map from the segment number to the client's index in
 	// the clients slice
 	predefinedSegments map[int][]int
 	// generationParameters holds the generation request
 	generationParameters *generation.Data
+	// generatedClientIDs holds the IDs of the clients that were given a
+	// generated ID, in the order they were generated
+	generatedClientIDs []string
+	// segments holds the month's clients split into segments, once they've
+	// been written. See populateSegments
+	segments map[int][]*activity.EntityRecord
+	// idReader is the source of randomness for generated client IDs. When
+	// nil, crypto/rand is used
+	idReader io.Reader
+	// repeatedClients counts the clients that were repeated from each of the
+	// earlier months
+	repeatedClients map[int32]int
+	// returningSplit counts the new and returning clients that the clients
+	// with a returning ratio were split into
+	returningSplit generation.ReturningSplit
+	// entityTokens counts the clients that were generated or repeated as the
+	// tokens of an entity client
+	entityTokens int
+	// workers is the number of segments that are populated or written at
+	// the same time
+	workers int
+	// paths are the storage keys of the month's segments, in segment index
+	// order, once they've been written
+	paths []string
+	// emptySegments is the number of usable segment indexes that didn't get
+	// any clients, once the segments have been populated. Skipped and empty
+	// segment indexes aren't counted
+	emptySegments int
 }
 
 // multipleMonthsActivityClients holds multiple month's data
 type multipleMonthsActivityClients struct {
 	// months are in order, with month 0 being the current month and index 1 being 1 month ago
 	months []*singleMonthActivityClients
+	// rand is the seeded source of randomness, if a seed was given
+	rand *rand.Rand
+	// now is the start of the current month, which months are relative to
+	now time.Time
+	// checkpointSize is the number of segments that are written to storage
+	// between checkpoints, where writing waits for every segment written so
+	// far. When 0, it's the number of workers a month has
+	checkpointSize int
+	// overwrite removes the existing entity segments of the months before
+	// their segments are written, and clearedEntries is the number of storage
+	// entries that were removed
+	overwrite      bool
+	clearedEntries int
+	// listMounts and listAuths list the secrets and auth mounts, they're the
+	// core's ListMounts and ListAuths unless a test replaces them. Each are
+	// only listed once a client needs them, and are then kept in mounts and
+	// auths for every month of the write request. They aren't invalidated, as
+	// the mounts aren't expected to change while the data is generated, so a
+	// mount that's added or removed during the request isn't seen by it
+	listMounts   func() ([]*MountEntry, error)
+	mounts       []*MountEntry
+	mountsListed bool
+	listAuths    func() ([]*MountEntry, error)
+	auths        []*MountEntry
+	authsListed  bool
 }
 
-func (s *singleMonthActivityClients) addEntityRecord(record *activity.EntityRecord, segmentIndex *int) {
+func (s *singleMonthActivityClients) addEntityRecord(record *generatedClient, segmentIndex *int) {
 	s.clients = append(s.clients, record)
 	if segmentIndex != nil {
 		index := len(s.clients) - 1
@@ -84,12 +645,26 @@ func (s *singleMonthActivityClients) addEntityRecord(record *activity.EntityReco
 // populateSegments converts a month of clients into a segmented map. The map's
 // keys are the segment index, and the value are the clients that were seen in
 // that index. If the value is an empty slice, then it's an empty index. If the
-// value is nil, then it's a skipped index
+// value is nil, then it's a skipped index. Once the clients are assigned to
+// segments, the segments are filled concurrently by the month's workers.
+//
+// A month without any clients, skipped indexes, or empty indexes has a single
+// empty segment at index 0. That way an empty month is still written to
+// storage as log/entity/<month start>/0, and the activity log sees the month
+// as present with no clients, rather than as a gap
 func (s *singleMonthActivityClients) populateSegments() (map[int][]*activity.EntityRecord, error) {
+	s.emptySegments = 0
 	segments := make(map[int][]*activity.EntityRecord)
 	ignoreIndexes := make(map[int]struct{})
 	skipIndexes := s.generationParameters.SkipSegmentIndexes
 	emptyIndexes := s.generationParameters.EmptySegmentIndexes
+	// the number of segments is only known up front when the clients are
+	// split by num segments, so the other ways only check for negative indexes
+	if len(s.predefinedSegments) > 0 || s.generationParameters.GetSegmentByteSize() > 0 || len(s.generationParameters.GetSegmentCapacities()) > 0 {
+		if err := checkSegmentIndexes(skipIndexes, emptyIndexes, -1); err != nil {
+			return nil, err
+		}
+	}
 
 	for _, i := range skipIndexes {
 		segments[int(i)] = nil
@@ -100,15 +675,71 @@ func (s *singleMonthActivityClients) populateSegments() (map[int][]*activity.Ent
 		ignoreIndexes[int(i)] = struct{}{}
 	}
 
+	roundRobin := s.generationParameters.GetSegmentDistribution() == generation.SegmentDistribution_SEGMENT_DISTRIBUTION_ROUND_ROBIN
+	if roundRobin && (len(s.predefinedSegments) > 0 || s.generationParameters.GetSegmentByteSize() > 0 || len(s.generationParameters.GetSegmentCapacities()) > 0 || len(s.generationParameters.GetSegmentWeights()) > 0) {
+		return nil, errors.New("the round robin segment distribution can only be used with num segments, not with clients in segments, segment weights, segment byte size or segment capacities")
+	}
+
+	matchProduction := s.generationParameters.GetMatchProductionSplitting()
+	if matchProduction && (len(s.predefinedSegments) > 0 || s.generationParameters.GetNumSegments() > 0 || len(s.generationParameters.GetSegmentWeights()) > 0 || s.generationParameters.GetSegmentByteSize() > 0 || len(s.generationParameters.GetSegmentCapacities()) > 0 || roundRobin || len(segments) > 0) {
+		return nil, errors.New("match production splitting can't be used with clients in segments, num segments, segment weights, segment byte size, segment capacities, the round robin segment distribution, or skipped and empty segment indexes")
+	}
+
+	if len(s.clients) == 0 && len(segments) == 0 {
+		segments[0] = make([]*activity.EntityRecord, 0)
+		return segments, nil
+	}
+
+	if matchProduction {
+		// the activity log only rotates to a new segment while the segment
+		// index is below activityLogMaxSegmentPerMonth, so the last index it
+		// writes is activityLogMaxSegmentPerMonth
+		numSegments, err := productionSegmentCount(len(s.clients), activitySegmentClientCapacity, activityLogMaxSegmentPerMonth+1)
+		if err != nil {
+			return nil, err
+		}
+		assignments := make(map[int][]int, numSegments)
+		for clientIndex := range s.clients {
+			i := clientIndex / activitySegmentClientCapacity
+			assignments[i] = append(assignments[i], clientIndex)
+		}
+		s.fillSegments(segments, assignments)
+		return segments, nil
+	}
+
 	// if we have predefined segments, then we can construct the map using those
 	if len(s.predefinedSegments) > 0 {
-		for segment, clientIndexes := range s.predefinedSegments {
-			clientsInSegment := make([]*activity.EntityRecord, 0, len(clientIndexes))
-			for _, idx := range clientIndexes {
-				clientsInSegment = append(clientsInSegment, s.clients[idx])
-			}
-			segments[segment] = clientsInSegment
+		if err := checkPredefinedSegmentIndexes(s.predefinedSegments, skipIndexes, emptyIndexes); err != nil {
+			return nil, err
 		}
+		s.fillSegments(segments, s.predefinedSegments)
+		return segments, nil
+	}
+
+	if capacities := s.generationParameters.GetSegmentCapacities(); len(capacities) > 0 {
+		if s.generationParameters.GetNumSegments() > 0 || len(s.generationParameters.GetSegmentWeights()) > 0 || s.generationParameters.GetSegmentByteSize() > 0 {
+			return nil, errors.New("segment capacities can't be used with num segments, segment weights or segment byte size")
+		}
+		assignments, err := s.segmentsByCapacity(capacities, ignoreIndexes)
+		if err != nil {
+			return nil, err
+		}
+		if s.generationParameters.GetStrictSegments() && s.emptySegments > 0 {
+			return nil, fmt.Errorf("%d segments with a capacity don't get any of the %d clients", s.emptySegments, len(s.clients))
+		}
+		s.fillSegments(segments, assignments)
+		return segments, nil
+	}
+
+	if s.generationParameters.GetSegmentByteSize() > 0 {
+		if s.generationParameters.GetNumSegments() > 0 || len(s.generationParameters.GetSegmentWeights()) > 0 {
+			return nil, errors.New("segment byte size can't be used with num segments or segment weights")
+		}
+		assignments, err := s.segmentsBySize(int(s.generationParameters.GetSegmentByteSize()), ignoreIndexes)
+		if err != nil {
+			return nil, err
+		}
+		s.fillSegments(segments, assignments)
 		return segments, nil
 	}
 
@@ -116,11 +747,54 @@ func (s *singleMonthActivityClients) populateSegments() (map[int][]*activity.Ent
 	if s.generationParameters.GetNumSegments() > 0 {
 		totalSegmentCount = int(s.generationParameters.GetNumSegments())
 	}
+	if err := checkSegmentIndexes(skipIndexes, emptyIndexes, totalSegmentCount); err != nil {
+		return nil, err
+	}
 	numNonUsable := len(skipIndexes) + len(emptyIndexes)
 	usableSegmentCount := totalSegmentCount - numNonUsable
 	if usableSegmentCount <= 0 {
 		return nil, fmt.Errorf("num segments %d is too low, it must be greater than %d (%d skipped indexes + %d empty indexes)", totalSegmentCount, numNonUsable, len(skipIndexes), len(emptyIndexes))
 	}
+	if s.generationParameters.GetStrictSegments() && usableSegmentCount > len(s.clients) {
+		return nil, fmt.Errorf("%d usable segments is more than the %d clients to split between them", usableSegmentCount, len(s.clients))
+	}
+
+	if len(s.generationParameters.GetSegmentWeights()) > 0 {
+		sizes, err := weightedSegmentSizes(len(s.clients), totalSegmentCount, s.generationParameters.GetSegmentWeights(), ignoreIndexes)
+		if err != nil {
+			return nil, err
+		}
+		assignments := make(map[int][]int)
+		clientIndex := 0
+		for i, size := range sizes {
+			if _, ok := ignoreIndexes[i]; !ok && size == 0 {
+				s.emptySegments++
+			}
+			for j := 0; j < size; j++ {
+				assignments[i] = append(assignments[i], clientIndex)
+				clientIndex++
+			}
+		}
+		s.fillSegments(segments, assignments)
+		return segments, nil
+	}
+
+	assignments := make(map[int][]int)
+	if roundRobin {
+		usableIndexes := make([]int, 0, usableSegmentCount)
+		for i := 0; i < totalSegmentCount; i++ {
+			if _, ok := ignoreIndexes[i]; !ok {
+				usableIndexes = append(usableIndexes, i)
+			}
+		}
+		for clientIndex := range s.clients {
+			i := usableIndexes[clientIndex%len(usableIndexes)]
+			assignments[i] = append(assignments[i], clientIndex)
+		}
+		s.emptySegments = usableSegmentCount - len(assignments)
+		s.fillSegments(segments, assignments)
+		return segments, nil
+	}
 
 	// determine how many clients should be in each segment
 	segmentSizes := len(s.clients) / usableSegmentCount
@@ -136,99 +810,855 @@ func (s *singleMonthActivityClients) populateSegments() (map[int][]*activity.Ent
 		if _, ok := ignoreIndexes[i]; ok {
 			continue
 		}
-		for len(segments[i]) < segmentSizes && clientIndex < len(s.clients) {
-			segments[i] = append(segments[i], s.clients[clientIndex])
+		for len(assignments[i]) < segmentSizes && clientIndex < len(s.clients) {
+			assignments[i] = append(assignments[i], clientIndex)
 			clientIndex++
 		}
 	}
+	s.emptySegments = usableSegmentCount - len(assignments)
+	s.fillSegments(segments, assignments)
 	return segments, nil
 }
 
-// addNewClients generates clients according to the given parameters, and adds them to the month
-// the client will always have the mountAccessor as its mount accessor
-func (s *singleMonthActivityClients) addNewClients(c *generation.Client, mountAccessor string, segmentIndex *int) error {
-	count := 1
-	if c.Count > 1 {
-		count = int(c.Count)
+// productionSegmentCount returns the number of segments that the activity log
+// would split numClients clients into, when each segment holds at most capacity
+// clients. The activity log stores at most maxSegments segments in a month,
+// and drops the clients that don't fit, so it's an error if more segments are
+// needed
+func productionSegmentCount(numClients int, capacity int, maxSegments int) (int, error) {
+	numSegments := (numClients + capacity - 1) / capacity
+	if numSegments == 0 {
+		numSegments = 1
 	}
-	clientType := entityActivityType
-	if c.NonEntity {
-		clientType = nonEntityTokenActivityType
+	if numSegments > maxSegments {
+		return 0, fmt.Errorf("%d clients need %d segments of %d clients, more than the %d segments the activity log stores in a month", numClients, numSegments, capacity, maxSegments)
 	}
-	for i := 0; i < count; i++ {
-		record := &activity.EntityRecord{
-			ClientID:      c.Id,
-			NamespaceID:   c.Namespace,
-			NonEntity:     c.NonEntity,
-			MountAccessor: mountAccessor,
-			ClientType:    clientType,
-		}
-		if record.ClientID == "" {
-			var err error
-			record.ClientID, err = uuid.GenerateUUID()
-			if err != nil {
-				return err
+	return numSegments, nil
+}
+
+// checkSegmentIndexes verifies that the skipped and empty segment indexes are
+// at least 0 and less than the total segment count. A negative total segment
+// count means that there's no upper limit. Every index that's out of range is
+// listed in the error
+func checkSegmentIndexes(skipIndexes []int32, emptyIndexes []int32, totalSegmentCount int) error {
+	outOfRange := func(indexes []int32) []int32 {
+		var invalid []int32
+		for _, i := range indexes {
+			if i < 0 || (totalSegmentCount >= 0 && int(i) >= totalSegmentCount) {
+				invalid = append(invalid, i)
 			}
 		}
-		s.addEntityRecord(record, segmentIndex)
+		return invalid
 	}
-	return nil
+	var invalid []string
+	if indexes := outOfRange(skipIndexes); len(indexes) > 0 {
+		invalid = append(invalid, fmt.Sprintf("skip segment indexes %v", indexes))
+	}
+	if indexes := outOfRange(emptyIndexes); len(indexes) > 0 {
+		invalid = append(invalid, fmt.Sprintf("empty segment indexes %v", indexes))
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	if totalSegmentCount < 0 {
+		return fmt.Errorf("segment indexes must not be negative, invalid %s", strings.Join(invalid, " and "))
+	}
+	return fmt.Errorf("segment indexes must be between 0 and %d, invalid %s", totalSegmentCount-1, strings.Join(invalid, " and "))
 }
 
-// processMonth populates a month of client data
-func (m *multipleMonthsActivityClients) processMonth(ctx context.Context, core *Core, month *generation.Data) error {
-	// default to using the root namespace and the first mount on the root namespace
-	mounts, err := core.ListMounts()
-	if err != nil {
-		return err
+// segmentIndexConflictError is returned when a predefined segment uses a
+// segment index that's also a skipped or empty segment index
+type segmentIndexConflictError struct {
+	// Index is the segment index that's used twice
+	Index int
+	// Conflict is the kind of segment index that the predefined segment
+	// collides with, either "skipped" or "empty"
+	Conflict string
+}
+
+func (e *segmentIndexConflictError) Error() string {
+	return fmt.Sprintf("segment index %d is used by a predefined segment and is also %s", e.Index, e.Conflict)
+}
+
+// checkPredefinedSegmentIndexes verifies that none of the predefined segments
+// use an index that's skipped or empty. The lowest colliding index is reported
+func checkPredefinedSegmentIndexes(predefinedSegments map[int][]int, skipIndexes []int32, emptyIndexes []int32) error {
+	conflicts := make(map[int]string, len(skipIndexes)+len(emptyIndexes))
+	for _, i := range emptyIndexes {
+		conflicts[int(i)] = "empty"
 	}
-	defaultMountAccessorRootNS := ""
-	for _, mount := range mounts {
-		if mount.NamespaceID == namespace.RootNamespaceID {
-			defaultMountAccessorRootNS = mount.Accessor
-			break
+	for _, i := range skipIndexes {
+		conflicts[int(i)] = "skipped"
+	}
+	indexes := make([]int, 0, len(predefinedSegments))
+	for i := range predefinedSegments {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		if conflict, ok := conflicts[i]; ok {
+			return &segmentIndexConflictError{Index: i, Conflict: conflict}
 		}
 	}
-	m.months[month.GetMonthsAgo()].generationParameters = month
-	add := func(c []*generation.Client, segmentIndex *int) error {
-		for _, clients := range c {
+	return nil
+}
 
-			if clients.Namespace == "" {
-				clients.Namespace = namespace.RootNamespaceID
+// segmentsBySize assigns the clients to segments in order, starting a new
+// segment whenever the next client would make the serialized segment larger
+// than maxBytes, the way that the activity log limits the size of the segments
+// it stores. Skipped and empty segment indexes aren't used
+func (s *singleMonthActivityClients) segmentsBySize(maxBytes int, ignoreIndexes map[int]struct{}) (map[int][]int, error) {
+	assignments := make(map[int][]int)
+	nextIndex := func(i int) int {
+		for {
+			if _, ok := ignoreIndexes[i]; !ok {
+				return i
 			}
+			i++
+		}
+	}
+	segmentIndex := nextIndex(0)
+	segmentBytes := 0
+	for i, client := range s.clients {
+		// each client is a length delimited entry in the segment's clients field
+		clientBytes := protowire.SizeTag(1) + protowire.SizeBytes(proto.Size(client.EntityRecord))
+		if clientBytes > maxBytes {
+			return nil, fmt.Errorf("client %s is %d bytes, which is more than the segment byte size %d", client.ClientID, clientBytes, maxBytes)
+		}
+		if segmentBytes+clientBytes > maxBytes {
+			segmentIndex = nextIndex(segmentIndex + 1)
+			segmentBytes = 0
+		}
+		assignments[segmentIndex] = append(assignments[segmentIndex], i)
+		segmentBytes += clientBytes
+	}
+	return assignments, nil
+}
 
-			// verify that the namespace exists
-			ns, err := core.NamespaceByID(ctx, clients.Namespace)
-			if err != nil {
-				return err
-			}
+// segmentsByCapacity assigns the clients to the segment indexes that have a
+// capacity, in index order, filling each segment up to its capacity before
+// the next one is used. Skipped and empty segment indexes can't have a
+// capacity, and the capacities must add up to at least the number of clients.
+// Segments with a capacity that don't get any clients are counted as empty
+func (s *singleMonthActivityClients) segmentsByCapacity(capacities map[int32]int32, ignoreIndexes map[int]struct{}) (map[int][]int, error) {
+	indexes := make([]int, 0, len(capacities))
+	for i := range capacities {
+		indexes = append(indexes, int(i))
+	}
+	sort.Ints(indexes)
 
-			// verify that the mount exists
-			if clients.Mount != "" {
-				nctx := namespace.ContextWithNamespace(ctx, ns)
-				mountEntry := core.router.MatchingMountEntry(nctx, clients.Mount)
-				if mountEntry == nil {
-					return fmt.Errorf("unable to find matching mount in namespace %s", clients.Namespace)
-				}
+	totalCapacity := 0
+	for _, i := range indexes {
+		if _, ok := ignoreIndexes[i]; ok {
+			return nil, fmt.Errorf("skipped or empty segment %d can't have a capacity", i)
+		}
+		totalCapacity += int(capacities[int32(i)])
+	}
+	if totalCapacity < len(s.clients) {
+		return nil, fmt.Errorf("segment capacities add up to %d clients, which is less than the %d clients", totalCapacity, len(s.clients))
+	}
+
+	assignments := make(map[int][]int)
+	clientIndex := 0
+	for _, i := range indexes {
+		for len(assignments[i]) < int(capacities[int32(i)]) && clientIndex < len(s.clients) {
+			assignments[i] = append(assignments[i], clientIndex)
+			clientIndex++
+		}
+		if len(assignments[i]) == 0 {
+			s.emptySegments++
+		}
+	}
+	return assignments, nil
+}
+
+// weightedSegmentSizes splits numClients clients over the segment indexes in
+// proportion to their weights, and returns the number of clients for each
+// index. There must be a weight for every segment index, and skipped or empty
+// indexes must have a weight of 0. The sizes are rounded down, and any clients
+// left over go to the indexes with the largest remainders, lowest index first
+func weightedSegmentSizes(numClients int, totalSegmentCount int, weights []float64, ignoreIndexes map[int]struct{}) ([]int, error) {
+	if len(weights) != totalSegmentCount {
+		return nil, fmt.Errorf("%d segment weights given for %d segments, there must be a weight for each segment", len(weights), totalSegmentCount)
+	}
+	total := 0.0
+	for i, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("segment weight %v for segment %d must not be negative", weight, i)
+		}
+		if _, ok := ignoreIndexes[i]; ok && weight != 0 {
+			return nil, fmt.Errorf("segment weight for skipped or empty segment %d must be 0", i)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one segment weight must be greater than 0")
+	}
+
+	sizes := make([]int, len(weights))
+	remainders := make([]float64, len(weights))
+	assigned := 0
+	for i, weight := range weights {
+		exact := float64(numClients) * weight / total
+		sizes[i] = int(math.Floor(exact))
+		remainders[i] = exact - float64(sizes[i])
+		assigned += sizes[i]
+	}
+	// only segments with a weight can get the left over clients
+	byRemainder := make([]int, 0, len(weights))
+	for i, weight := range weights {
+		if weight > 0 {
+			byRemainder = append(byRemainder, i)
+		}
+	}
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return remainders[byRemainder[i]] > remainders[byRemainder[j]]
+	})
+	for i := 0; assigned < numClients; i++ {
+		sizes[byRemainder[i%len(byRemainder)]]++
+		assigned++
+	}
+	return sizes, nil
+}
+
+// fillSegments adds the clients to each segment, given a map from the segment
+// index to the indexes of the segment's clients in the clients slice. Segments
+// are filled concurrently by the month's workers, and the clients in each
+// segment keep the order of their indexes. The segments are handled in segment
+// index order rather than map order, so that the same assignments always fill
+// the same segments
+func (s *singleMonthActivityClients) fillSegments(segments map[int][]*activity.EntityRecord, assignments map[int][]int) {
+	segmentIndexes := make([]int, 0, len(assignments))
+	for segment := range assignments {
+		segmentIndexes = append(segmentIndexes, segment)
+	}
+	sort.Ints(segmentIndexes)
+	filled := make([][]*activity.EntityRecord, len(segmentIndexes))
+
+	g := new(errgroup.Group)
+	g.SetLimit(s.numWorkers())
+	for i, segment := range segmentIndexes {
+		i, clientIndexes := i, assignments[segment]
+		g.Go(func() error {
+			clientsInSegment := make([]*activity.EntityRecord, 0, len(clientIndexes))
+			for _, idx := range clientIndexes {
+				clientsInSegment = append(clientsInSegment, s.clients[idx].EntityRecord)
 			}
+			filled[i] = clientsInSegment
+			return nil
+		})
+	}
+	g.Wait()
+
+	for i, segment := range segmentIndexes {
+		segments[segment] = filled[i]
+	}
+}
+
+// numWorkers returns the number of workers used to populate and write the
+// month's segments
+func (s *singleMonthActivityClients) numWorkers() int {
+	if s.workers > 0 {
+		return s.workers
+	}
+	return 1
+}
+
+// firstMountAccessor returns the accessor of the first secrets mount in the
+// namespace, and whether the namespace has one, for clients that don't have a
+// mount
+func (m *multipleMonthsActivityClients) firstMountAccessor(ctx context.Context, core *Core, nsID string) (string, bool, error) {
+	mounts, err := m.secretsMounts(ctx, core)
+	if err != nil {
+		return "", false, err
+	}
+	for _, mount := range mounts {
+		if mount.NamespaceID == nsID {
+			return mount.Accessor, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// secretsMounts returns the secrets mounts, which are listed the first time
+// it's called
+func (m *multipleMonthsActivityClients) secretsMounts(ctx context.Context, core *Core) ([]*MountEntry, error) {
+	if !m.mountsListed {
+		listMounts := m.listMounts
+		if listMounts == nil {
+			listMounts = core.ListMounts
+		}
+		mounts, err := listMountsWithRetry(ctx, "mounts", listMounts)
+		if err != nil {
+			return nil, err
+		}
+		m.mounts = mounts
+		m.mountsListed = true
+	}
+	return m.mounts, nil
+}
+
+// mountEntries returns the auth mounts followed by the secrets mounts, for
+// the clients that pick their mounts from all of a namespace's mounts. The
+// auth mounts are listed the first time it's called
+func (m *multipleMonthsActivityClients) mountEntries(ctx context.Context, core *Core) ([]*MountEntry, error) {
+	if !m.authsListed {
+		listAuths := m.listAuths
+		if listAuths == nil {
+			listAuths = core.ListAuths
+		}
+		auths, err := listMountsWithRetry(ctx, "auth mounts", listAuths)
+		if err != nil {
+			return nil, err
+		}
+		m.auths = auths
+		m.authsListed = true
+	}
+	mounts, err := m.secretsMounts(ctx, core)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*MountEntry, 0, len(m.auths)+len(mounts))
+	return append(append(entries, m.auths...), mounts...), nil
+}
+
+// mountListAttempts is how often listing the mounts is tried before the write
+// request fails, mountListRetryWait how long to wait after the first failed
+// attempt, which doubles after each of the others, and mountListTimeout how
+// long an attempt may take. Tests of the retries lower them
+var (
+	mountListAttempts  = 3
+	mountListRetryWait = 100 * time.Millisecond
+	mountListTimeout   = 10 * time.Second
+)
+
+// listMountsWithRetry calls list until it succeeds, up to mountListAttempts
+// times, so that a transient failure doesn't fail the whole generation. An
+// attempt that takes longer than mountListTimeout counts as failed, the call
+// is left to finish on its own
+func listMountsWithRetry(ctx context.Context, kind string, list func() ([]*MountEntry, error)) ([]*MountEntry, error) {
+	type result struct {
+		entries []*MountEntry
+		err     error
+	}
+	wait := mountListRetryWait
+	var err error
+	for attempt := 1; ; attempt++ {
+		resultCh := make(chan result, 1)
+		go func() {
+			entries, err := list()
+			resultCh <- result{entries: entries, err: err}
+		}()
+		timer := time.NewTimer(mountListTimeout)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case res := <-resultCh:
+			timer.Stop()
+			if res.err == nil {
+				return res.entries, nil
+			}
+			err = res.err
+		case <-timer.C:
+			err = fmt.Errorf("timed out after %s", mountListTimeout)
+		}
+		if attempt >= mountListAttempts {
+			return nil, fmt.Errorf("unable to list %s after %d attempts: %w", kind, attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// addNewClients generates clients according to the given parameters, and adds them to the month
+// the client will always have the mountAccessor as its mount accessor
+func (s *singleMonthActivityClients) addNewClients(ctx context.Context, c *generation.Client, mountAccessor string, segmentIndex *int) error {
+	count, err := positiveClientCount(c)
+	if err != nil {
+		return err
+	}
+	clientType, nonEntity, err := generatedClientType(c)
+	if err != nil {
+		return err
+	}
+	numEntity := -1
+	if c.EntityRatio != nil {
+		numEntity, err = numEntityClients(c, count)
+		if err != nil {
+			return err
+		}
+	}
+	var timestamp int64
+	if c.UsageTime != "" {
+		usageTime, err := parseUsageTime(c.UsageTime)
+		if err != nil {
+			return err
+		}
+		timestamp = usageTime.Unix()
+	}
+	metadata, err := generatedMetadata(c.Metadata)
+	if err != nil {
+		return err
+	}
+	if c.TokenTtl != "" {
+		if err := checkTokenTTL(c, clientType); err != nil {
+			return err
+		}
+	}
+	if c.TokensPerEntity > 0 && numEntity < 0 && clientType != entityActivityType {
+		return fmt.Errorf("tokens per entity can only be used for entity clients, not for client type %q", clientType)
+	}
+	newClientID := func() (string, error) {
+		var id string
+		var err error
+		if s.idReader != nil {
+			id, err = uuid.GenerateUUIDWithReader(s.idReader)
+		} else {
+			id, err = uuid.GenerateUUID()
+		}
+		if err != nil {
+			return "", err
+		}
+		s.generatedClientIDs = append(s.generatedClientIDs, id)
+		return id, nil
+	}
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if numEntity >= 0 {
+			// spread the entity clients evenly between the non-entity
+			// clients, so that each segment gets a similar mix
+			if (i+1)*numEntity/count > i*numEntity/count {
+				clientType, nonEntity = entityActivityType, false
+			} else {
+				clientType, nonEntity = nonEntityTokenActivityType, true
+			}
+		}
+		clientID := c.Id
+		if len(c.Ids) > 0 {
+			clientID = c.Ids[i]
+		}
+		record := &generatedClient{
+			EntityRecord: &activity.EntityRecord{
+				ClientID:      clientID,
+				NamespaceID:   c.Namespace,
+				NonEntity:     nonEntity,
+				MountAccessor: mountAccessor,
+				ClientType:    clientType,
+				Timestamp:     timestamp,
+			},
+			metadata: metadata,
+		}
+		if record.ClientID == "" {
+			record.ClientID, err = newClientID()
+			if err != nil {
+				return err
+			}
+		}
+		s.addEntityRecord(record, segmentIndex)
+		if nonEntity {
+			continue
+		}
+		for j := 0; j < int(c.TokensPerEntity); j++ {
+			token := &generatedClient{
+				EntityRecord: &activity.EntityRecord{
+					NamespaceID:   c.Namespace,
+					NonEntity:     true,
+					MountAccessor: mountAccessor,
+					ClientType:    nonEntityTokenActivityType,
+					Timestamp:     timestamp,
+				},
+				metadata: metadata,
+			}
+			token.ClientID, err = newClientID()
+			if err != nil {
+				return err
+			}
+			record.tokens = append(record.tokens, token)
+			s.addEntityRecord(token, segmentIndex)
+		}
+		s.entityTokens += len(record.tokens)
+	}
+	return nil
+}
+
+// addRepeatedClient adds a client from an earlier month to the month, along
+// with the tokens generated with it, and returns the number of clients added
+func (s *singleMonthActivityClients) addRepeatedClient(client *generatedClient, segmentIndex *int) int {
+	s.addEntityRecord(client, segmentIndex)
+	for _, token := range client.tokens {
+		s.addEntityRecord(token, segmentIndex)
+	}
+	s.entityTokens += len(client.tokens)
+	return 1 + len(client.tokens)
+}
 
-			mountAccessor := defaultMountAccessorRootNS
-			if clients.Namespace != namespace.RootNamespaceID && clients.Mount == "" {
-				// if we're not using the root namespace, find a mount on the namespace that we are using
-				found := false
-				for _, mount := range mounts {
-					if mount.NamespaceID == clients.Namespace {
-						mountAccessor = mount.Accessor
-						found = true
-						break
+// clientCount returns the number of clients that c stands for, which is one
+// when its count is left out. A client with ids stands for one client per id,
+// and its count is ignored
+func clientCount(c *generation.Client) int {
+	if len(c.Ids) > 0 {
+		return len(c.Ids)
+	}
+	if c.Count == nil {
+		return 1
+	}
+	return int(c.GetCount())
+}
+
+// positiveClientCount returns the number of clients that c stands for, like
+// clientCount, for generating or repeating them. A count that's set must be
+// positive, so an explicit 0 is an error instead of one client, or none
+func positiveClientCount(c *generation.Client) (int, error) {
+	count := clientCount(c)
+	if count < 1 {
+		return 0, fmt.Errorf("invalid client count %d: must be positive, leave count out for one client", count)
+	}
+	return count, nil
+}
+
+// numEntityClients returns how many of count clients are entity clients,
+// given the client's entity ratio. The number is rounded to the nearest whole
+// client, and the rest of the clients are non-entity token clients
+func numEntityClients(c *generation.Client, count int) (int, error) {
+	ratio := c.GetEntityRatio()
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("entity ratio %v must be between 0 and 1", ratio)
+	}
+	if c.ClientType != "" || c.NonEntity {
+		return 0, fmt.Errorf("entity ratio can't be used with a client type or non-entity")
+	}
+	if c.Id != "" {
+		return 0, fmt.Errorf("entity ratio can't be used with a client ID")
+	}
+	return int(math.Round(float64(count) * ratio)), nil
+}
+
+// generatedMetadata validates a client's metadata and returns a copy of it to
+// keep with the client's generated records
+func generatedMetadata(metadata map[string]string) (map[string]string, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	copied := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if k == "" {
+			return nil, errors.New("metadata keys can't be empty")
+		}
+		if len(k) > maxMetadataKeyLength {
+			return nil, fmt.Errorf("metadata key %q is longer than %d bytes", k, maxMetadataKeyLength)
+		}
+		if len(v) > maxMetadataValueLength {
+			return nil, fmt.Errorf("metadata value for key %q is longer than %d bytes", k, maxMetadataValueLength)
+		}
+		copied[k] = v
+	}
+	return copied, nil
+}
+
+// checkTokenTTL validates a non-entity token client's token TTL. The TTL is
+// never written, as entity records don't have anywhere to store it, so a valid
+// TTL is still reported as an unsupported field rather than being dropped
+func checkTokenTTL(c *generation.Client, clientType string) error {
+	if clientType != nonEntityTokenActivityType {
+		return fmt.Errorf("token TTL can only be set on non-entity token clients")
+	}
+	ttl, err := parseutil.ParseDurationSecond(c.TokenTtl)
+	if err != nil {
+		return fmt.Errorf("invalid token TTL %q: %w", c.TokenTtl, err)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("invalid token TTL %q: must be positive", c.TokenTtl)
+	}
+	return fmt.Errorf("unsupported field token_ttl: entity records don't store token TTLs")
+}
+
+// checkReferenceTime verifies that the reference time that months are
+// relative to is a timestamp after the unix epoch, as activity log segments
+// are stored by their month's unix time
+func checkReferenceTime(referenceTime string) error {
+	t, err := parseTimestamp(referenceTime)
+	if err != nil {
+		return err
+	}
+	if t.Unix() <= 0 {
+		return errors.New("must be after the unix epoch")
+	}
+	return nil
+}
+
+// parseTimestamp parses an RFC3339 or unix timestamp, in UTC
+func parseTimestamp(timestamp string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return t.UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("must be an RFC3339 or unix timestamp")
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// parseUsageTime parses a client's usage time, which is either an RFC3339
+// timestamp or a unix timestamp in seconds
+func parseUsageTime(usageTime string) (time.Time, error) {
+	t, err := parseTimestamp(usageTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid usage time %q: %w", usageTime, err)
+	}
+	return t, nil
+}
+
+// generatedClientType returns the activity type for the client, and whether
+// the client is a non-entity client. When the client type isn't set, it's
+// decided by the client's NonEntity field. Only entity clients have entities,
+// so every other type is non-entity
+func generatedClientType(c *generation.Client) (string, bool, error) {
+	switch c.ClientType {
+	case "":
+		if c.NonEntity {
+			return nonEntityTokenActivityType, true, nil
+		}
+		return entityActivityType, false, nil
+	case entityActivityType:
+		if c.NonEntity {
+			return "", false, fmt.Errorf("client type %q can't be non-entity", c.ClientType)
+		}
+		return entityActivityType, false, nil
+	case nonEntityTokenActivityType, acmeActivityType, secretSyncActivityType:
+		return c.ClientType, true, nil
+	default:
+		return "", false, fmt.Errorf("unknown client type %q", c.ClientType)
+	}
+}
+
+// checkClientIDs verifies that each id given to the month's new clients is only
+// used by one of them, or with shared client IDs, only once for each client
+// type. Repeated clients are taken from earlier months, and so aren't checked
+func checkClientIDs(month *generation.Data) error {
+	types := make(map[string]map[string]struct{})
+	var errs *multierror.Error
+	for _, c := range monthClients(month) {
+		if c.Repeated || c.RepeatedFromMonth > 0 || c.RepeatedFromAll {
+			continue
+		}
+		ids := c.Ids
+		if c.Id != "" {
+			ids = append([]string{c.Id}, ids...)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		clientType, _, err := generatedClientType(c)
+		if err != nil {
+			// reported when the client is generated
+			continue
+		}
+		for _, id := range ids {
+			if _, ok := types[id]; !ok {
+				types[id] = make(map[string]struct{})
+			}
+			switch _, ok := types[id][clientType]; {
+			case ok:
+				errs = multierror.Append(errs, fmt.Errorf("month %d: client id %s is used by more than one client of type %s", month.GetMonthsAgo(), id, clientType))
+			case len(types[id]) > 0 && !month.GetSharedClientIds():
+				errs = multierror.Append(errs, fmt.Errorf("month %d: client id %s is used by more than one client, set \"shared_client_ids\" to use it for clients of different types", month.GetMonthsAgo(), id))
+			}
+			types[id][clientType] = struct{}{}
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// checkMountVisible verifies that a mount matched from the namespace is in the
+// namespace or in one of its descendants. A mount in a descendant namespace is
+// given by its path relative to the namespace, e.g. "child/kv/", and the
+// clients using it keep their own namespace, with the mount's accessor
+func checkMountVisible(ns *namespace.Namespace, mountEntry *MountEntry) error {
+	if mountEntry.NamespaceID == ns.ID {
+		return nil
+	}
+	mountNS := mountEntry.Namespace()
+	if mountNS == nil || !mountNS.HasParent(ns) {
+		return fmt.Errorf("mount %s is in namespace %s, which isn't namespace %s or one of its descendants", mountEntry.Path, mountEntry.NamespaceID, ns.ID)
+	}
+	return nil
+}
+
+// clientMount returns the path of the mount that the client is using. This is
+// the client's own mount, or otherwise the month's default mount. An empty path
+// means that the first mount on the client's namespace is used
+func clientMount(month *generation.Data, c *generation.Client) string {
+	if c.Mount != "" {
+		return c.Mount
+	}
+	return month.GetDefaultMount()
+}
+
+// validateInput checks the input before any clients are generated, and
+// returns all of the problems found in the input, its references to
+// namespaces and mounts, and its client counts as one error
+func validateInput(ctx context.Context, core *Core, input *generation.ActivityLogMockInput, maxClients int, maxMonthClients int) error {
+	var errs *multierror.Error
+	errs = multierror.Append(errs, input.Validate())
+	if input.StoragePrefix != "" {
+		if err := checkStoragePrefix(input.StoragePrefix); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid \"storage_prefix\": %w", err))
+		}
+	}
+	if input.ReferenceTime != "" {
+		if err := checkReferenceTime(input.ReferenceTime); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid \"reference_time\" %q: %w", input.ReferenceTime, err))
+		}
+	}
+	errs = multierror.Append(errs, validateReferences(ctx, core, input.Data))
+	for _, month := range input.Data {
+		errs = multierror.Append(errs, checkClientIDs(month))
+	}
+	errs = multierror.Append(errs, checkClientLimits(input.Data, maxClients, maxMonthClients))
+	return errs.ErrorOrNil()
+}
+
+// mountOfType returns the first of the mount entries in the namespace with the
+// client's mount type. The auth mounts come before the secrets mounts in the
+// entries, so they're searched first
+func mountOfType(entries []*MountEntry, nsID string, c *generation.Client) (*MountEntry, error) {
+	if c.Mount != "" {
+		return nil, fmt.Errorf("mount %s and mount type %s can't both be set", c.Mount, c.MountType)
+	}
+	for _, entry := range entries {
+		if entry.NamespaceID == nsID && entry.Type == c.MountType {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("no mount of type %s in namespace %s", c.MountType, nsID)
+}
+
+// firstMounts returns the first num_mounts of the mount entries in the
+// namespace, for a client that's spread across them. Auth mounts come before
+// secrets mounts in the entries, and each are in the order of their mount
+// table, so the same mounts are used each time
+func firstMounts(entries []*MountEntry, nsID string, c *generation.Client) ([]*MountEntry, error) {
+	if c.Mount != "" || c.MountType != "" {
+		return nil, errors.New("num mounts can't be set with a mount or a mount type")
+	}
+	found := make([]*MountEntry, 0, c.NumMounts)
+	for _, entry := range entries {
+		if entry.NamespaceID != nsID {
+			continue
+		}
+		found = append(found, entry)
+		if len(found) == int(c.NumMounts) {
+			return found, nil
+		}
+	}
+	return nil, fmt.Errorf("namespace %s has %d mounts, which is fewer than the %d requested", nsID, len(found), c.NumMounts)
+}
+
+// processMonth populates a month of client data
+func (m *multipleMonthsActivityClients) processMonth(ctx context.Context, core *Core, month *generation.Data) error {
+	if err := m.checkMonthsAgo(month.GetMonthsAgo()); err != nil {
+		return err
+	}
+	m.months[month.GetMonthsAgo()].generationParameters = month
+	add := func(c []*generation.Client, segmentIndex *int) error {
+		for _, clients := range c {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if clients.Namespace == "" {
+				clients.Namespace = namespace.RootNamespaceID
+			}
+
+			// verify that the namespace exists
+			ns, err := core.NamespaceByID(ctx, clients.Namespace)
+			if err != nil {
+				return err
+			}
+
+			if clients.NumMounts > 0 {
+				if isRepeatedClient(clients) {
+					return errors.New("num mounts can't be set on repeated clients")
+				}
+				entries, err := m.mountEntries(ctx, core)
+				if err != nil {
+					return err
+				}
+				mountEntries, err := firstMounts(entries, clients.Namespace, clients)
+				if err != nil {
+					return err
+				}
+				// the mounts take turns, so that their counts differ by at most one
+				count, err := positiveClientCount(clients)
+				if err != nil {
+					return err
+				}
+				assigned := 0
+				for i, mountEntry := range mountEntries {
+					mountCount := count / len(mountEntries)
+					if i < count%len(mountEntries) {
+						mountCount++
+					}
+					if mountCount == 0 {
+						continue
+					}
+					mountClient := proto.Clone(clients).(*generation.Client)
+					mountClient.Count = proto.Int32(int32(mountCount))
+					if len(clients.Ids) > 0 {
+						mountClient.Ids = clients.Ids[assigned : assigned+mountCount]
+					}
+					assigned += mountCount
+					err = m.addClientToMonth(ctx, month.GetMonthsAgo(), mountClient, mountEntry.Accessor, segmentIndex)
+					if err != nil {
+						return err
 					}
 				}
-				if !found {
+				continue
+			}
+
+			var mountAccessor string
+			if clients.MountType != "" {
+				entries, err := m.mountEntries(ctx, core)
+				if err != nil {
+					return err
+				}
+				mountEntry, err := mountOfType(entries, clients.Namespace, clients)
+				if err != nil {
+					return err
+				}
+				mountAccessor = mountEntry.Accessor
+			} else if mountPath := clientMount(month, clients); mountPath != "" {
+				// verify that the mount exists, and use its accessor
+				nctx := namespace.ContextWithNamespace(ctx, ns)
+				mountEntry := core.router.MatchingMountEntry(nctx, mountPath)
+				if mountEntry == nil {
 					return fmt.Errorf("unable to find matching mount in namespace %s", clients.Namespace)
 				}
+				if err := checkMountVisible(ns, mountEntry); err != nil {
+					return err
+				}
+				mountAccessor = mountEntry.Accessor
+			} else {
+				// default to the first mount on the client's namespace. The
+				// root namespace always has mounts, and isn't checked
+				accessor, found, err := m.firstMountAccessor(ctx, core, clients.Namespace)
+				if err != nil {
+					return err
+				}
+				if !found && clients.Namespace != namespace.RootNamespaceID {
+					return fmt.Errorf("unable to find matching mount in namespace %s", clients.Namespace)
+				}
+				mountAccessor = accessor
 			}
 
-			err = m.addClientToMonth(month.GetMonthsAgo(), clients, mountAccessor, segmentIndex)
+			err = m.addClientToMonth(ctx, month.GetMonthsAgo(), clients, mountAccessor, segmentIndex)
 			if err != nil {
 				return err
 			}
@@ -237,16 +1667,22 @@ func (m *multipleMonthsActivityClients) processMonth(ctx context.Context, core *
 	}
 
 	if month.GetAll() != nil {
-		return add(month.GetAll().GetClients(), nil)
+		clients, err := m.distributeNamespaces(month.GetAll())
+		if err != nil {
+			return err
+		}
+		return add(clients, nil)
 	}
 	predefinedSegments := month.GetSegments()
 	for i, segment := range predefinedSegments.GetSegments() {
+		if len(segment.GetClients().GetNamespaces()) > 0 {
+			return errors.New("namespaces can only be given for all of a month's clients, not for segments")
+		}
 		index := i
 		if segment.SegmentIndex != nil {
 			index = int(*segment.SegmentIndex)
 		}
-		err = add(segment.GetClients().GetClients(), &index)
-		if err != nil {
+		if err := add(segment.GetClients().GetClients(), &index); err != nil {
 			return err
 		}
 	}
@@ -254,42 +1690,790 @@ func (m *multipleMonthsActivityClients) processMonth(ctx context.Context, core *
 	return nil
 }
 
-func (m *multipleMonthsActivityClients) addClientToMonth(monthsAgo int32, c *generation.Client, mountAccessor string, segmentIndex *int) error {
-	if c.Repeated || c.RepeatedFromMonth > 0 {
+// distributeNamespaces spreads the clients that don't have a namespace across
+// the given namespaces, and returns a client for each namespace that gets
+// some of a client's count. With round robin distribution, the namespaces
+// take turns across all of the clients, so that the counts differ by at most
+// one. With random distribution, each client's namespace is random, and
+// repeatable when a seed is set
+func (m *multipleMonthsActivityClients) distributeNamespaces(all *generation.Clients) ([]*generation.Client, error) {
+	namespaces := all.GetNamespaces()
+	if len(namespaces) == 0 {
+		return all.GetClients(), nil
+	}
+	var pick func() int
+	switch all.GetNamespaceDistribution() {
+	case generation.NamespaceDistribution_NAMESPACE_DISTRIBUTION_ROUND_ROBIN:
+		next := 0
+		pick = func() int {
+			i := next
+			next = (next + 1) % len(namespaces)
+			return i
+		}
+	case generation.NamespaceDistribution_NAMESPACE_DISTRIBUTION_RANDOM:
+		intn := rand.Intn
+		if m.rand != nil {
+			intn = m.rand.Intn
+		}
+		pick = func() int {
+			return intn(len(namespaces))
+		}
+	default:
+		return nil, fmt.Errorf("unknown namespace distribution %s", all.GetNamespaceDistribution())
+	}
+
+	clients := make([]*generation.Client, 0, len(all.GetClients()))
+	for _, c := range all.GetClients() {
+		if c.Namespace != "" {
+			clients = append(clients, c)
+			continue
+		}
+		count, err := positiveClientCount(c)
+		if err != nil {
+			return nil, err
+		}
+		counts := make([]int32, len(namespaces))
+		// the ids, if there are any, go to the namespaces they're picked for
+		ids := make([][]string, len(namespaces))
+		for i := 0; i < count; i++ {
+			ns := pick()
+			counts[ns]++
+			if len(c.Ids) > 0 {
+				ids[ns] = append(ids[ns], c.Ids[i])
+			}
+		}
+		for i, nsID := range namespaces {
+			if counts[i] == 0 {
+				continue
+			}
+			nsClient := proto.Clone(c).(*generation.Client)
+			nsClient.Namespace = nsID
+			nsClient.Count = proto.Int32(counts[i])
+			nsClient.Ids = ids[i]
+			clients = append(clients, nsClient)
+		}
+	}
+	return clients, nil
+}
+
+// checkMonthsAgo returns an error if monthsAgo isn't one of the generated
+// months
+func (m *multipleMonthsActivityClients) checkMonthsAgo(monthsAgo int32) error {
+	if monthsAgo < 0 || int(monthsAgo) >= len(m.months) {
+		return fmt.Errorf("invalid months ago %d: must be between 0 and %d", monthsAgo, len(m.months)-1)
+	}
+	return nil
+}
+
+// checkUsageTime returns an error if the client's usage time isn't within the
+// month that's monthsAgo months before now. Repeated clients are the same
+// records as the clients they repeat, so they can't have a usage time
+func (m *multipleMonthsActivityClients) checkUsageTime(monthsAgo int32, c *generation.Client) error {
+	if isRepeatedClient(c) {
+		return fmt.Errorf("usage time can't be set on repeated clients")
+	}
+	usageTime, err := parseUsageTime(c.UsageTime)
+	if err != nil {
+		return err
+	}
+	start := monthTimestamp(int(monthsAgo), m.now)
+	end := timeutil.EndOfMonth(start)
+	if usageTime.Before(start) || usageTime.After(end) {
+		return fmt.Errorf("usage time %s is outside of month %d, which is from %s to %s", usageTime.Format(time.RFC3339), monthsAgo, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (m *multipleMonthsActivityClients) addClientToMonth(ctx context.Context, monthsAgo int32, c *generation.Client, mountAccessor string, segmentIndex *int) error {
+	if err := m.checkMonthsAgo(monthsAgo); err != nil {
+		return err
+	}
+	if c.UsageTime != "" {
+		if err := m.checkUsageTime(monthsAgo, c); err != nil {
+			return err
+		}
+	}
+	if c.TokenTtl != "" && isRepeatedClient(c) {
+		return fmt.Errorf("token TTL can't be set on repeated clients")
+	}
+	if c.EntityRatio != nil && isRepeatedClient(c) {
+		return fmt.Errorf("entity ratio can't be set on repeated clients")
+	}
+	if len(c.Ids) > 0 && isRepeatedClient(c) {
+		return fmt.Errorf("ids can't be set on repeated clients")
+	}
+	if c.TokensPerEntity > 0 && isRepeatedClient(c) {
+		return fmt.Errorf("tokens per entity can't be set on repeated clients, whose tokens are repeated with them")
+	}
+	if c.ReturningRatio != nil {
+		return m.addReturningSplitClients(ctx, monthsAgo, c, mountAccessor, segmentIndex)
+	}
+	if c.RepeatedFromAll {
+		return m.addRepeatedFromAllClients(monthsAgo, c, mountAccessor, segmentIndex)
+	}
+	if isRepeatedClient(c) {
 		return m.addRepeatedClients(monthsAgo, c, mountAccessor, segmentIndex)
 	}
-	return m.months[monthsAgo].addNewClients(c, mountAccessor, segmentIndex)
+	return m.months[monthsAgo].addNewClients(ctx, c, mountAccessor, segmentIndex)
+}
+
+// addReturningSplitClients splits the client's count into returning clients,
+// which are repeated from repeated_from_month or the previous month, and new
+// clients. The number of returning clients is rounded to the nearest whole
+// client, and the earlier month must have enough matching clients for them
+func (m *multipleMonthsActivityClients) addReturningSplitClients(ctx context.Context, monthsAgo int32, c *generation.Client, mountAccessor string, segmentIndex *int) error {
+	ratio := c.GetReturningRatio()
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("returning ratio %v must be between 0 and 1", ratio)
+	}
+	if c.Repeated || c.RepeatedPercent != 0 || c.RepeatedFromAll || c.Id != "" || len(c.Ids) > 0 {
+		return fmt.Errorf("returning ratio can't be used with repeated, repeated percent, repeated from all, an id or ids")
+	}
+	count, err := positiveClientCount(c)
+	if err != nil {
+		return err
+	}
+	numReturning := int(math.Round(float64(count) * ratio))
+
+	if numReturning > 0 {
+		returning := proto.Clone(c).(*generation.Client)
+		returning.ReturningRatio = nil
+		returning.Repeated = true
+		// the returning entities' tokens are repeated with them
+		returning.TokensPerEntity = 0
+		returning.Count = proto.Int32(int32(numReturning))
+		if err := m.addClientToMonth(ctx, monthsAgo, returning, mountAccessor, segmentIndex); err != nil {
+			return fmt.Errorf("returning clients: %w", err)
+		}
+	}
+	if numNew := count - numReturning; numNew > 0 {
+		newClients := proto.Clone(c).(*generation.Client)
+		newClients.ReturningRatio = nil
+		newClients.RepeatedFromMonth = 0
+		newClients.Count = proto.Int32(int32(numNew))
+		if err := m.addClientToMonth(ctx, monthsAgo, newClients, mountAccessor, segmentIndex); err != nil {
+			return err
+		}
+	}
+	split := &m.months[monthsAgo].returningSplit
+	split.New += count - numReturning
+	split.Returning += numReturning
+	return nil
+}
+
+// isRepeatedClient returns true if the client is repeated from earlier months,
+// rather than generated
+func isRepeatedClient(c *generation.Client) bool {
+	return c.Repeated || c.RepeatedFromMonth > 0 || c.RepeatedPercent != 0 || c.RepeatedFromAll
 }
 
+// addRepeatedClients adds clients from an earlier month to the month. The
+// earlier month's clients include the clients that it repeated itself, so
+// clients can be repeated through a chain of months back to the month where
+// they were generated. Each client is only matched once, even when the earlier
+// month has more than one copy of it
 func (m *multipleMonthsActivityClients) addRepeatedClients(monthsAgo int32, c *generation.Client, mountAccessor string, segmentIndex *int) error {
 	addingTo := m.months[monthsAgo]
 	repeatedFromMonth := monthsAgo + 1
 	if c.RepeatedFromMonth > 0 {
 		repeatedFromMonth = c.RepeatedFromMonth
 	}
+	if repeatedFromMonth <= monthsAgo {
+		return fmt.Errorf("cannot repeat from month %d in month %d: clients can only be repeated from earlier months", repeatedFromMonth, monthsAgo)
+	}
+	if int(repeatedFromMonth) >= len(m.months) {
+		return fmt.Errorf("cannot repeat from month %d: only %d months generated", repeatedFromMonth, len(m.months))
+	}
 	repeatedFrom := m.months[repeatedFromMonth]
-	numClients := 1
-	if c.Count > 0 {
-		numClients = int(c.Count)
+	clientType, nonEntity, err := generatedClientType(c)
+	if err != nil {
+		return err
+	}
+	matching := repeatedFrom.matchingClients(c, clientType, nonEntity, mountAccessor)
+	numClients, err := numRepeatedClients(c, len(matching))
+	if err != nil {
+		return err
+	}
+	if numClients > len(matching) {
+		return fmt.Errorf("missing repeated %d clients from month %d with client type %q, namespace %q, and mount accessor %q", numClients-len(matching), repeatedFromMonth, clientType, c.Namespace, mountAccessor)
+	}
+	added := 0
+	for _, client := range matching[:numClients] {
+		added += addingTo.addRepeatedClient(client, segmentIndex)
+	}
+	if addingTo.repeatedClients == nil {
+		addingTo.repeatedClients = make(map[int32]int)
+	}
+	addingTo.repeatedClients[repeatedFromMonth] += added
+	return nil
+}
+
+// addRepeatedFromAllClients adds clients that are in every earlier month with
+// data to the month. The clients are taken from the oldest month, in order,
+// and only the ones that each of the later months repeated are kept
+func (m *multipleMonthsActivityClients) addRepeatedFromAllClients(monthsAgo int32, c *generation.Client, mountAccessor string, segmentIndex *int) error {
+	if c.Repeated || c.RepeatedFromMonth > 0 {
+		return fmt.Errorf("repeated from all can't be used with repeated or repeated from month")
+	}
+	clientType, nonEntity, err := generatedClientType(c)
+	if err != nil {
+		return err
+	}
+	var priorMonths []int32
+	for i := int32(len(m.months)) - 1; i > monthsAgo; i-- {
+		if m.months[i].generationParameters != nil || len(m.months[i].clients) > 0 {
+			priorMonths = append(priorMonths, i)
+		}
+	}
+	if len(priorMonths) == 0 {
+		return fmt.Errorf("cannot repeat from all months in month %d: there are no earlier months", monthsAgo)
+	}
+
+	matching := m.months[priorMonths[0]].matchingClients(c, clientType, nonEntity, mountAccessor)
+	numClients, err := numRepeatedClients(c, len(matching))
+	if err != nil {
+		return err
+	}
+	for _, priorMonth := range priorMonths {
+		inMonth := make(map[*generatedClient]struct{}, len(m.months[priorMonth].clients))
+		for _, client := range m.months[priorMonth].clients {
+			inMonth[client] = struct{}{}
+		}
+		kept := matching[:0]
+		for _, client := range matching {
+			if _, ok := inMonth[client]; ok {
+				kept = append(kept, client)
+			}
+		}
+		matching = kept
+		if numClients > len(matching) {
+			return fmt.Errorf("missing repeated %d clients from month %d with client type %q, namespace %q, and mount accessor %q, to repeat from all months", numClients-len(matching), priorMonth, clientType, c.Namespace, mountAccessor)
+		}
+	}
+
+	addingTo := m.months[monthsAgo]
+	added := 0
+	for _, client := range matching[:numClients] {
+		added += addingTo.addRepeatedClient(client, segmentIndex)
+	}
+	if addingTo.repeatedClients == nil {
+		addingTo.repeatedClients = make(map[int32]int)
+	}
+	for _, priorMonth := range priorMonths {
+		addingTo.repeatedClients[priorMonth] += added
+	}
+	return nil
+}
+
+// matchingClients returns the month's clients with the client type, namespace,
+// and mount accessor of c, in order. Each client is only returned once, even
+// when the month has more than one copy of it
+func (s *singleMonthActivityClients) matchingClients(c *generation.Client, clientType string, nonEntity bool, mountAccessor string) []*generatedClient {
+	matching := make([]*generatedClient, 0)
+	seen := make(map[*generatedClient]struct{})
+	for _, client := range s.clients {
+		if _, ok := seen[client]; ok {
+			continue
+		}
+		if nonEntity == client.NonEntity && clientType == client.ClientType && mountAccessor == client.MountAccessor && c.Namespace == client.NamespaceID {
+			seen[client] = struct{}{}
+			matching = append(matching, client)
+		}
+	}
+	return matching
+}
+
+// numRepeatedClients returns how many clients should be repeated, given the
+// number of matching clients in the month they're repeated from. When
+// RepeatedPercent is set, the percentage of matching clients is rounded to the
+// nearest whole client, but at least one client is always repeated
+func numRepeatedClients(c *generation.Client, numMatching int) (int, error) {
+	if c.RepeatedPercent == 0 {
+		return positiveClientCount(c)
+	}
+	if c.RepeatedPercent < 0 || c.RepeatedPercent > 100 {
+		return 0, fmt.Errorf("repeated percent %v must be between 0 and 100", c.RepeatedPercent)
+	}
+	if c.Count != nil {
+		return 0, fmt.Errorf("repeated percent and count can't both be set")
+	}
+	if numMatching == 0 {
+		return 0, fmt.Errorf("cannot repeat %v%% of clients: no matching clients to repeat", c.RepeatedPercent)
+	}
+	numClients := int(math.Round(float64(numMatching) * c.RepeatedPercent / 100))
+	if numClients == 0 {
+		numClients = 1
+	}
+	return numClients, nil
+}
+
+// write persists the generated months to storage. Each month's segments are
+// written as entity segments, and depending on the given options the
+// precomputed queries, distinct client counts and intent log are written too.
+// The activity log is then refreshed so that it picks up the current month.
+// The storage paths of the written segments are returned.
+//
+// Every month is segmented before anything is written, and if any write
+// fails, the storage entries that this write created or overwrote are removed
+// again. That way a failed write leaves no partial data behind, while entries
+// that something else writes in the meantime are kept.
+//
+// With overwrite, the existing entity segments of the months are removed
+// before the new ones are written, so that writing the same input again
+// doesn't add to the data. The removed segments aren't restored if the write
+// then fails
+func (m *multipleMonthsActivityClients) write(ctx context.Context, opts map[generation.WriteOptions]struct{}, activityLog *ActivityLog) ([]string, error) {
+	if err := m.populateSegments(); err != nil {
+		return nil, err
+	}
+	if _, writeEntities := opts[generation.WriteOptions_WRITE_ENTITIES]; m.overwrite && writeEntities {
+		cleared, err := m.clearSegments(ctx, activityLog)
+		m.clearedEntries = cleared
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove the existing segments, removed %d storage entries: %w", cleared, err)
+		}
+	}
+	paths, written, err := m.writeMonths(ctx, opts, activityLog)
+	if err != nil {
+		// the request's context might be what was cancelled, and the
+		// entries still need to be removed
+		rollbackCtx := ctx
+		if ctx.Err() != nil {
+			rollbackCtx = context.Background()
+		}
+		removed, rollbackErr := removeKeys(rollbackCtx, activityLog.view, written)
+		if rollbackErr != nil {
+			return nil, multierror.Append(err, fmt.Errorf("failed to remove the entries already written: %w", rollbackErr))
+		}
+		return nil, fmt.Errorf("%w, removed the %d storage entries already written", err, removed)
+	}
+
+	// refreshing a disabled activity log would delete the current month's
+	// segments, so only refresh when it's enabled. Activity logs for a storage
+	// prefix aren't the core's activity log, and are never refreshed. The
+	// refresh is for the activity log's own current month, even when the
+	// months were relative to a reference time
+	activityLog.fragmentLock.RLock()
+	enabled := activityLog.enabled
+	activityLog.fragmentLock.RUnlock()
+	if enabled && activityLog == activityLog.core.activityLog {
+		wg := sync.WaitGroup{}
+		err := activityLog.refreshFromStoredLog(ctx, &wg, timeutil.StartOfMonth(activityLog.clock.Now().UTC()))
+		if err != nil {
+			return nil, err
+		}
+		wg.Wait()
+	}
+	return paths, nil
+}
+
+// clearSegments removes the existing entity segments of the months that have
+// data, and returns the number of storage entries removed
+func (m *multipleMonthsActivityClients) clearSegments(ctx context.Context, activityLog *ActivityLog) (int, error) {
+	cleared := 0
+	for i, month := range m.months {
+		if month.generationParameters == nil {
+			continue
+		}
+		timestamp := monthTimestamp(i, m.now)
+		basePath := fmt.Sprintf("%s%d/", activityEntityBasePath, timestamp.Unix())
+		segments, err := activityLog.view.List(ctx, basePath)
+		if err != nil {
+			return cleared, err
+		}
+		keys := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			keys = append(keys, basePath+segment)
+		}
+		removed, err := removeKeys(ctx, activityLog.view, keys)
+		cleared += removed
+		if err != nil {
+			return cleared, err
+		}
 	}
-	for _, client := range repeatedFrom.clients {
-		if c.NonEntity == client.NonEntity && mountAccessor == client.MountAccessor && c.Namespace == client.NamespaceID {
-			addingTo.addEntityRecord(client, segmentIndex)
-			numClients--
-			if numClients == 0 {
-				break
+	return cleared, nil
+}
+
+// removeKeys deletes the given keys from the view, and returns the number of
+// entries that were deleted
+func removeKeys(ctx context.Context, view *BarrierView, keys []string) (int, error) {
+	removed := 0
+	var errs *multierror.Error
+	for _, key := range keys {
+		if err := view.Delete(ctx, key); err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errs.ErrorOrNil()
+}
+
+// writeMonths writes the segmented months to storage, for write. It returns
+// the paths of the written segments, and the keys of every entry it wrote or
+// tried to write, which are returned even when a write fails
+func (m *multipleMonthsActivityClients) writeMonths(ctx context.Context, opts map[generation.WriteOptions]struct{}, activityLog *ActivityLog) ([]string, []string, error) {
+	now := m.now
+	paths := []string{}
+	written := []string{}
+
+	_, writePQ := opts[generation.WriteOptions_WRITE_PRECOMPUTED_QUERIES]
+	_, writeDistinctClients := opts[generation.WriteOptions_WRITE_DISTINCT_CLIENTS]
+	_, writeEntities := opts[generation.WriteOptions_WRITE_ENTITIES]
+	_, writeIntentLog := opts[generation.WriteOptions_WRITE_INTENT_LOGS]
+
+	pqOpts := pqOptions{}
+	if writePQ || writeDistinctClients {
+		pqOpts.byNamespace = make(map[string]*processByNamespace)
+		pqOpts.byMonth = make(map[int64]*processMonth)
+		pqOpts.activePeriodEnd = m.latestTimestamp(now)
+		pqOpts.endTime = timeutil.EndOfMonth(pqOpts.activePeriodEnd)
+		pqOpts.activePeriodStart = m.earliestTimestamp(now)
+	}
+
+	for i, month := range m.months {
+		if month.generationParameters == nil {
+			continue
+		}
+		timestamp := monthTimestamp(i, now)
+		segments := month.segments
+		if writeEntities {
+			entityPaths, err := month.writeSegments(ctx, activityLog, i, timestamp, m.checkpointSize)
+			written = append(written, entityPaths...)
+			if err != nil {
+				return nil, written, err
 			}
+			month.paths = entityPaths
+			paths = append(paths, entityPaths...)
 		}
+		if writePQ || writeDistinctClients {
+			// the month's distinct clients and its precomputed query
+			written = append(written,
+				fmt.Sprintf("%s%d", distinctClientsBasePath, timestamp.Unix()),
+				fmt.Sprintf("%s%d/%d", activityQueryBasePath, timestamp.Unix(), pqOpts.endTime.Unix()))
+			reader := newSliceSegmentReader(segments)
+			err := activityLog.segmentToPrecomputedQuery(ctx, timestamp, reader, pqOpts)
+			if err != nil {
+				return nil, written, err
+			}
+		}
+	}
+
+	if writeIntentLog {
+		latest := m.latestTimestamp(now)
+		written = append(written, activityIntentLogKey)
+		err := activityLog.writeIntentLog(ctx, latest.Unix(), timeutil.StartOfNextMonth(latest).Unix())
+		if err != nil {
+			return nil, written, err
+		}
+	}
+	return paths, written, nil
+}
+
+// writeSegments writes the month's segments to storage in segment index order,
+// each with its own Put. The month's workers write the segments concurrently,
+// and after every checkpointSize segments writing waits until they're all
+// written, so that a failure stops it at a known point and the progress can be
+// logged. The storage has no batched writes, so the segments between
+// checkpoints aren't written atomically. Skipped segment indexes aren't
+// written. The storage paths of the written segments are returned, and when a
+// segment can't be written, the paths of the segments written before it are
+// returned with the error
+func (s *singleMonthActivityClients) writeSegments(ctx context.Context, activityLog *ActivityLog, monthsAgo int, timestamp time.Time, checkpointSize int) ([]string, error) {
+	segmentIndexes := make([]int, 0, len(s.segments))
+	for _, segmentIndex := range sortedSegmentIndexes(s.segments) {
+		// skip the nil indexes
+		if s.segments[segmentIndex] != nil {
+			segmentIndexes = append(segmentIndexes, segmentIndex)
+		}
+	}
+	if checkpointSize <= 0 {
+		checkpointSize = s.numWorkers()
+	}
+
+	segmentPaths := make([]string, len(segmentIndexes))
+	writtenPaths := func() []string {
+		entityPaths := make([]string, 0, len(segmentIndexes))
+		for _, path := range segmentPaths {
+			if path != "" {
+				entityPaths = append(entityPaths, path)
+			}
+		}
+		return entityPaths
 	}
-	if numClients > 0 {
-		return fmt.Errorf("missing repeated %d clients matching given parameters", numClients)
+	for start := 0; start < len(segmentIndexes); start += checkpointSize {
+		if err := ctx.Err(); err != nil {
+			return writtenPaths(), err
+		}
+		end := start + checkpointSize
+		if end > len(segmentIndexes) {
+			end = len(segmentIndexes)
+		}
+		g := new(errgroup.Group)
+		g.SetLimit(s.numWorkers())
+		for i := start; i < end; i++ {
+			i, segmentIndex := i, segmentIndexes[i]
+			g.Go(func() error {
+				entityPath, err := activityLog.saveSegmentEntitiesInternal(ctx, segmentInfo{
+					startTimestamp:       timestamp.Unix(),
+					currentClients:       &activity.EntityActivityLog{Clients: s.segments[segmentIndex]},
+					clientSequenceNumber: uint64(segmentIndex),
+					tokenCount:           &activity.TokenCount{},
+				}, true)
+				if err != nil {
+					return fmt.Errorf("failed to write segment %d of month %d: %w", segmentIndex, monthsAgo, err)
+				}
+				segmentPaths[i] = entityPath
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return writtenPaths(), err
+		}
+		activityLog.logger.Debug("wrote generated segments", "months_ago", monthsAgo, "written", end, "total", len(segmentIndexes))
+	}
+	return writtenPaths(), nil
+}
+
+// populateSegments splits the clients of each month with data into segments
+func (m *multipleMonthsActivityClients) populateSegments() error {
+	for _, month := range m.months {
+		if month.generationParameters == nil {
+			continue
+		}
+		segments, err := month.populateSegments()
+		if err != nil {
+			return err
+		}
+		month.segments = segments
 	}
 	return nil
 }
 
+// summary describes the months with data for the write endpoint's response,
+// with their client counts, segment sizes and written storage paths. Skipped
+// segment indexes are left out, and the months' start and end are in UTC
+func (m *multipleMonthsActivityClients) summary() []map[string]interface{} {
+	summary := m.writeSummary(nil, "")
+	months := make([]map[string]interface{}, 0, len(summary.Months))
+	for _, month := range summary.Months {
+		segments := make(map[int]int, len(month.Segments))
+		for _, segment := range month.Segments {
+			segments[segment.Index] = segment.NumClients
+		}
+		months = append(months, map[string]interface{}{
+			"months_ago":           month.MonthsAgo,
+			"start":                month.Start,
+			"end":                  month.End,
+			"num_clients":          month.NumClients,
+			"generated_client_ids": month.GeneratedClientIDs,
+			"repeated_clients":     month.RepeatedClients,
+			"returning_split":      map[string]int{"new": month.ReturningSplit.New, "returning": month.ReturningSplit.Returning},
+			"entity_tokens":        month.EntityTokens,
+			"segments":             segments,
+			"empty_segments":       month.EmptySegments,
+			"paths":                month.Paths,
+		})
+	}
+	return months
+}
+
+// writeSummary returns the summary of the generated months with the stable
+// layout of generation.WriteSummary, along with the paths of the written
+// segments and the storage prefix they were written to. The months of summary
+// are derived from it, so that both responses describe the months the same way
+func (m *multipleMonthsActivityClients) writeSummary(paths []string, storagePrefix string) *generation.WriteSummary {
+	if paths == nil {
+		paths = []string{}
+	}
+	summary := &generation.WriteSummary{
+		Months:         make([]generation.MonthSummary, 0, len(m.months)),
+		Paths:          paths,
+		StoragePrefix:  storagePrefix,
+		ClearedEntries: m.clearedEntries,
+	}
+	for i, month := range m.months {
+		if month.generationParameters == nil {
+			continue
+		}
+		clientsByType := make(map[string]int)
+		for _, client := range month.clients {
+			clientsByType[client.ClientType]++
+		}
+		segments := make([]generation.SegmentSummary, 0, len(month.segments))
+		for _, segmentIndex := range sortedSegmentIndexes(month.segments) {
+			clients := month.segments[segmentIndex]
+			if clients == nil {
+				continue
+			}
+			segments = append(segments, generation.SegmentSummary{
+				Index:      segmentIndex,
+				NumClients: len(clients),
+			})
+		}
+		generatedClientIDs := month.generatedClientIDs
+		if generatedClientIDs == nil {
+			generatedClientIDs = []string{}
+		}
+		monthPaths := month.paths
+		if monthPaths == nil {
+			monthPaths = []string{}
+		}
+		repeatedClients := make(map[int]int, len(month.repeatedClients))
+		for repeatedFrom, numClients := range month.repeatedClients {
+			repeatedClients[int(repeatedFrom)] = numClients
+		}
+		start := monthTimestamp(i, m.now)
+		summary.Months = append(summary.Months, generation.MonthSummary{
+			MonthsAgo:          i,
+			Start:              start,
+			End:                timeutil.EndOfMonth(start),
+			NumClients:         len(month.clients),
+			ClientsByType:      clientsByType,
+			GeneratedClientIDs: generatedClientIDs,
+			RepeatedClients:    repeatedClients,
+			ReturningSplit:     month.returningSplit,
+			EntityTokens:       month.entityTokens,
+			Segments:           segments,
+			EmptySegments:      month.emptySegments,
+			Paths:              monthPaths,
+		})
+	}
+	return summary
+}
+
+// serializedSegments returns the segments of each month with data, as they
+// would be written to storage, without writing them. The segments are base64
+// encoded EntityActivityLog protobufs, keyed by months ago and then by segment
+// index. Skipped segment indexes are left out
+func (m *multipleMonthsActivityClients) serializedSegments() (map[int]map[int]string, error) {
+	months := make(map[int]map[int]string, len(m.months))
+	for i, month := range m.months {
+		if month.generationParameters == nil {
+			continue
+		}
+		segments := make(map[int]string, len(month.segments))
+		for segmentIndex, clients := range month.segments {
+			if clients == nil {
+				continue
+			}
+			b, err := proto.Marshal(&activity.EntityActivityLog{Clients: clients})
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize segment %d of month %d: %w", segmentIndex, i, err)
+			}
+			segments[segmentIndex] = base64.StdEncoding.EncodeToString(b)
+		}
+		months[i] = segments
+	}
+	return months, nil
+}
+
+// warnings describes the months with segments that didn't get any clients,
+// which usually means that more segments were requested than there were
+// clients to fill them
+func (m *multipleMonthsActivityClients) warnings() []string {
+	var warnings []string
+	for i, month := range m.months {
+		if month.emptySegments > 0 {
+			warnings = append(warnings, fmt.Sprintf("month %d has %d segments without any clients, as there are %d clients", i, month.emptySegments, len(month.clients)))
+		}
+	}
+	return warnings
+}
+
+// latestTimestamp returns the start of the most recent month with data
+func (m *multipleMonthsActivityClients) latestTimestamp(now time.Time) time.Time {
+	for i, month := range m.months {
+		if month.generationParameters != nil {
+			return monthTimestamp(i, now)
+		}
+	}
+	return time.Time{}
+}
+
+// earliestTimestamp returns the start of the oldest month with data
+func (m *multipleMonthsActivityClients) earliestTimestamp(now time.Time) time.Time {
+	for i := len(m.months) - 1; i >= 0; i-- {
+		if m.months[i].generationParameters != nil {
+			return monthTimestamp(i, now)
+		}
+	}
+	return time.Time{}
+}
+
+// monthTimestamp returns the start of the month that is monthsAgo months
+// before now
+func monthTimestamp(monthsAgo int, now time.Time) time.Time {
+	if monthsAgo == 0 {
+		return timeutil.StartOfMonth(now)
+	}
+	return timeutil.StartOfMonth(timeutil.MonthsPreviousTo(monthsAgo, now))
+}
+
+func sortedSegmentIndexes(segments map[int][]*activity.EntityRecord) []int {
+	indexes := make([]int, 0, len(segments))
+	for i := range segments {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// sliceSegmentReader is a SegmentReader over generated segments that haven't
+// been read from storage. Skipped segments are not returned. Generated data
+// has no token counts, so ReadToken always returns io.EOF
+type sliceSegmentReader struct {
+	index    int
+	segments [][]*activity.EntityRecord
+}
+
+func newSliceSegmentReader(segments map[int][]*activity.EntityRecord) *sliceSegmentReader {
+	reader := &sliceSegmentReader{
+		segments: make([][]*activity.EntityRecord, 0, len(segments)),
+	}
+	for _, i := range sortedSegmentIndexes(segments) {
+		if segments[i] == nil {
+			continue
+		}
+		reader.segments = append(reader.segments, segments[i])
+	}
+	return reader
+}
+
+func (s *sliceSegmentReader) ReadToken(ctx context.Context) (*activity.TokenCount, error) {
+	return nil, io.EOF
+}
+
+func (s *sliceSegmentReader) ReadEntity(ctx context.Context) (*activity.EntityActivityLog, error) {
+	if s.index >= len(s.segments) {
+		return nil, io.EOF
+	}
+	record := &activity.EntityActivityLog{Clients: s.segments[s.index]}
+	s.index++
+	return record, nil
+}
+
+// setSeed makes the generated data deterministic, so that the same input
+// generates the same client IDs
+func (m *multipleMonthsActivityClients) setSeed(seed int64) {
+	m.rand = rand.New(rand.NewSource(seed))
+	for _, month := range m.months {
+		month.idReader = m.rand
+	}
+}
+
+// setWorkers sets the number of segments of each month that are populated or
+// written at the same time
+func (m *multipleMonthsActivityClients) setWorkers(workers int) {
+	for _, month := range m.months {
+		month.workers = workers
+	}
+}
+
 func newMultipleMonthsActivityClients(numberOfMonths int) *multipleMonthsActivityClients {
 	m := &multipleMonthsActivityClients{
 		months: make([]*singleMonthActivityClients, numberOfMonths),
+		now:    timeutil.StartOfMonth(time.Now().UTC()),
 	}
 	for i := 0; i < numberOfMonths; i++ {
 		m.months[i] = &singleMonthActivityClients{
@@ -7,13 +7,25 @@ package vault
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/benchhelpers"
 	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/helper/timeutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault/activity"
 	"github.com/hashicorp/vault/vault/activity/generation"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 // TestSystemBackend_handleActivityWriteData calls the activity log write endpoint and confirms that the inputs are
@@ -65,6 +77,18 @@ func TestSystemBackend_handleActivityWriteData(t *testing.T) {
 			input:     map[string]interface{}{"input": `{"write":["WRITE_PRECOMPUTED_QUERIES"],"data":[]}`},
 			wantError: logical.ErrInvalidRequest,
 		},
+		{
+			name:      "negative months ago fails",
+			operation: logical.CreateOperation,
+			input:     map[string]interface{}{"input": `{"write":["WRITE_PRECOMPUTED_QUERIES"],"data":[{"months_ago":-1,"all":{"clients":[{"count":5}]}}]}`},
+			wantError: logical.ErrInvalidRequest,
+		},
+		{
+			name:      "local clients fail",
+			operation: logical.CreateOperation,
+			input:     map[string]interface{}{"input": `{"write":["WRITE_ENTITIES"],"data":[{"current_month":true,"all":{"clients":[{"count":5,"local":true}]}}]}`},
+			wantError: logical.ErrInvalidRequest,
+		},
 		{
 			name:      "correctly formatted data succeeds",
 			operation: logical.CreateOperation,
@@ -128,7 +152,7 @@ func Test_singleMonthActivityClients_addNewClients(t *testing.T) {
 		{
 			name: "non zero count",
 			clients: &generation.Client{
-				Count: 5,
+				Count: proto.Int32(5),
 			},
 		},
 		{
@@ -148,13 +172,9 @@ func Test_singleMonthActivityClients_addNewClients(t *testing.T) {
 			m := &singleMonthActivityClients{
 				predefinedSegments: make(map[int][]int),
 			}
-			err := m.addNewClients(tt.clients, tt.mount, tt.segmentIndex)
+			err := m.addNewClients(context.Background(), tt.clients, tt.mount, tt.segmentIndex)
 			require.NoError(t, err)
-			numNew := tt.clients.Count
-			if numNew == 0 {
-				numNew = 1
-			}
-			require.Len(t, m.clients, int(numNew))
+			require.Len(t, m.clients, clientCount(tt.clients))
 			for i, rec := range m.clients {
 				require.NotNil(t, rec)
 				require.Equal(t, tt.wantNamespace, rec.NamespaceID)
@@ -173,6 +193,406 @@ func Test_singleMonthActivityClients_addNewClients(t *testing.T) {
 	}
 }
 
+// Test_multipleMonthsActivityClients_addClientToMonth_zeroCount verifies that
+// a client without a count stands for one client, and that an explicit count
+// of 0 is rejected for new and repeated clients instead of generating one
+func Test_multipleMonthsActivityClients_addClientToMonth_zeroCount(t *testing.T) {
+	m := newMultipleMonthsActivityClients(2)
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{}, "mount", nil))
+	require.Len(t, m.months[1].clients, 1)
+
+	err := m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(0)}, "mount", nil)
+	require.ErrorContains(t, err, "invalid client count 0: must be positive")
+	require.Len(t, m.months[1].clients, 1)
+
+	err = m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(0), Repeated: true}, "mount", nil)
+	require.ErrorContains(t, err, "invalid client count 0: must be positive")
+	require.Empty(t, m.months[0].clients)
+}
+
+// Test_multipleMonthsActivityClients_ids verifies that a client with ids is
+// generated as a new client for each of them, ignoring its count, that the ids
+// follow the clients spread across namespaces, and that they can't be
+// repeated
+func Test_multipleMonthsActivityClients_ids(t *testing.T) {
+	m := newMultipleMonthsActivityClients(2)
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Ids: []string{"a", "b", "c"}, Count: proto.Int32(10)}, "mount", nil))
+	ids := make([]string, 0, len(m.months[1].clients))
+	for _, c := range m.months[1].clients {
+		ids = append(ids, c.ClientID)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, ids)
+	require.Empty(t, m.months[1].generatedClientIDs)
+
+	clients, err := m.distributeNamespaces(&generation.Clients{
+		Namespaces: []string{"ns1", "ns2"},
+		Clients:    []*generation.Client{{Ids: []string{"a", "b", "c"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, clients, 2)
+	require.Equal(t, []string{"a", "c"}, clients[0].Ids)
+	require.Equal(t, []string{"b"}, clients[1].Ids)
+
+	err = m.addClientToMonth(context.Background(), 0, &generation.Client{Ids: []string{"a"}, Repeated: true}, "mount", nil)
+	require.ErrorContains(t, err, "ids can't be set on repeated clients")
+}
+
+// Test_multipleMonthsActivityClients_tokensPerEntity verifies that each new
+// entity client gets its own non-entity token clients in its namespace and
+// mount, and that repeating the entity repeats its tokens with it
+func Test_multipleMonthsActivityClients_tokensPerEntity(t *testing.T) {
+	ctx := context.Background()
+	m := newMultipleMonthsActivityClients(3)
+	require.NoError(t, m.addClientToMonth(ctx, 2, &generation.Client{Count: proto.Int32(2), Namespace: "ns", TokensPerEntity: 3}, "mount", nil))
+	month := m.months[2]
+	require.Len(t, month.clients, 8)
+	require.Equal(t, 6, month.entityTokens)
+	require.Len(t, month.generatedClientIDs, 8)
+	for i, entity := range []*generatedClient{month.clients[0], month.clients[4]} {
+		require.False(t, entity.NonEntity, "entity %d", i)
+		require.Len(t, entity.tokens, 3)
+		for _, token := range entity.tokens {
+			require.True(t, token.NonEntity)
+			require.Equal(t, nonEntityTokenActivityType, token.ClientType)
+			require.Equal(t, "ns", token.NamespaceID)
+			require.Equal(t, "mount", token.MountAccessor)
+			require.NotEqual(t, entity.ClientID, token.ClientID)
+		}
+	}
+	require.Equal(t, month.clients[1:4], month.clients[0].tokens)
+
+	// the entity ratio's non-entity clients don't get tokens
+	require.NoError(t, m.addClientToMonth(ctx, 2, &generation.Client{Count: proto.Int32(2), EntityRatio: proto.Float64(0.5), Namespace: "ns", TokensPerEntity: 1}, "mount", nil))
+	require.Len(t, month.clients, 11)
+	require.Equal(t, 7, month.entityTokens)
+
+	require.NoError(t, m.addClientToMonth(ctx, 1, &generation.Client{Count: proto.Int32(1), Repeated: true, Namespace: "ns", RepeatedFromMonth: 2}, "mount", nil))
+	require.Equal(t, month.clients[:4], m.months[1].clients)
+	require.Equal(t, 3, m.months[1].entityTokens)
+	require.Equal(t, map[int32]int{2: 4}, m.months[1].repeatedClients)
+
+	err := m.addClientToMonth(ctx, 0, &generation.Client{Repeated: true, Namespace: "ns", TokensPerEntity: 1}, "mount", nil)
+	require.ErrorContains(t, err, "tokens per entity can't be set on repeated clients")
+	err = m.addClientToMonth(ctx, 0, &generation.Client{NonEntity: true, TokensPerEntity: 1}, "mount", nil)
+	require.ErrorContains(t, err, "tokens per entity can only be used for entity clients")
+}
+
+// TestSystemBackend_handleActivityWriteData_tokensPerEntity verifies that
+// the number of tokens generated and repeated with the entity clients is
+// returned for each month, and that an invalid tokens_per_entity is rejected
+func TestSystemBackend_handleActivityWriteData_tokensPerEntity(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	write := func(input string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": input, "dry_run": true, "structured_summary": true}
+		return core.systemBackend.HandleRequest(ctx, req)
+	}
+
+	resp, err := write(`{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":2,"all":{"clients":[{"count":2,"tokens_per_entity":-1},{"count":1,"repeated":true,"tokens_per_entity":2}]}}
+	]}`)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	require.ErrorContains(t, resp.Error(), "month 2: invalid \"tokens_per_entity\" value -1: must not be negative")
+	require.ErrorContains(t, resp.Error(), "month 2: \"tokens_per_entity\" can't be set on repeated clients")
+
+	resp, err = write(`{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":2,"all":{"clients":[{"count":3,"tokens_per_entity":4}]}},
+		{"months_ago":1,"all":{"clients":[{"count":1,"repeated":true}]}}
+	]}`)
+	require.NoError(t, err)
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Equal(t, 5, months[0]["num_clients"])
+	require.Equal(t, 4, months[0]["entity_tokens"])
+	require.Equal(t, 15, months[1]["num_clients"])
+	require.Equal(t, 12, months[1]["entity_tokens"])
+	summary := resp.Data["summary"].(*generation.WriteSummary)
+	require.Equal(t, map[string]int{entityActivityType: 3, nonEntityTokenActivityType: 12}, summary.Months[1].ClientsByType)
+	require.Equal(t, 12, summary.Months[1].EntityTokens)
+}
+
+// TestSystemBackend_handleActivityWriteData_ids verifies that the ids of the
+// clients are validated together with the rest of the input, and that each
+// id is written once
+func TestSystemBackend_handleActivityWriteData_ids(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	write := func(input string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": input}
+		return core.systemBackend.HandleRequest(ctx, req)
+	}
+
+	resp, err := write(`{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":2,"all":{"clients":[{"id":"b","ids":["a","","a"]},{"ids":["c"],"repeated":true}]}},
+		{"months_ago":1,"all":{"clients":[{"ids":["d","e"]},{"ids":["e"]}]}}
+	]}`)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	for _, want := range []string{
+		"month 2: id b and ids can't both be set",
+		"month 2: ids[1] is empty",
+		"month 2: ids has id a more than once",
+		"month 2: ids can't be set on repeated clients",
+		"month 1: client id e is used by more than one client of type entity",
+	} {
+		require.ErrorContains(t, resp.Error(), want)
+	}
+
+	resp, err = write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"all":{"clients":[{"ids":["prod-1","prod-2"],"count":5}]}}]}`)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Data["paths"].([]string)))
+	entry, err := core.activityLog.view.Get(ctx, resp.Data["paths"].([]string)[0])
+	require.NoError(t, err)
+	segment := &activity.EntityActivityLog{}
+	require.NoError(t, proto.Unmarshal(entry.Value, segment))
+	require.Len(t, segment.Clients, 2)
+	require.Equal(t, "prod-1", segment.Clients[0].ClientID)
+	require.Equal(t, "prod-2", segment.Clients[1].ClientID)
+}
+
+// Test_singleMonthActivityClients_addNewClients_clientType verifies that new
+// clients are given the requested client type, and that the client type
+// decides whether the client is a non-entity client. Unknown client types and
+// entity clients marked as non-entity must be rejected
+func Test_singleMonthActivityClients_addNewClients_clientType(t *testing.T) {
+	tests := []struct {
+		name          string
+		clients       *generation.Client
+		wantType      string
+		wantNonEntity bool
+		wantError     bool
+	}{
+		{
+			name:     "default is entity",
+			clients:  &generation.Client{},
+			wantType: entityActivityType,
+		},
+		{
+			name:          "default non entity",
+			clients:       &generation.Client{NonEntity: true},
+			wantType:      nonEntityTokenActivityType,
+			wantNonEntity: true,
+		},
+		{
+			name:     "entity",
+			clients:  &generation.Client{ClientType: entityActivityType},
+			wantType: entityActivityType,
+		},
+		{
+			name:          "non entity",
+			clients:       &generation.Client{ClientType: nonEntityTokenActivityType},
+			wantType:      nonEntityTokenActivityType,
+			wantNonEntity: true,
+		},
+		{
+			name:          "acme",
+			clients:       &generation.Client{ClientType: acmeActivityType},
+			wantType:      acmeActivityType,
+			wantNonEntity: true,
+		},
+		{
+			name:          "secret sync",
+			clients:       &generation.Client{ClientType: secretSyncActivityType},
+			wantType:      secretSyncActivityType,
+			wantNonEntity: true,
+		},
+		{
+			name:      "non entity entity",
+			clients:   &generation.Client{ClientType: entityActivityType, NonEntity: true},
+			wantError: true,
+		},
+		{
+			name:      "unknown type",
+			clients:   &generation.Client{ClientType: "other"},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &singleMonthActivityClients{
+				predefinedSegments: make(map[int][]int),
+			}
+			err := m.addNewClients(context.Background(), tt.clients, "mount", nil)
+			if tt.wantError {
+				require.Error(t, err)
+				require.Empty(t, m.clients)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, m.clients, 1)
+			require.Equal(t, tt.wantType, m.clients[0].ClientType)
+			require.Equal(t, tt.wantNonEntity, m.clients[0].NonEntity)
+		})
+	}
+}
+
+// Test_multipleMonthsActivityClients_addClientToMonth_usageTime verifies that
+// a client's usage time is set as the record's timestamp, and that usage times
+// that are invalid or outside of the client's month are rejected
+func Test_multipleMonthsActivityClients_addClientToMonth_usageTime(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		client    *generation.Client
+		want      time.Time
+		wantError bool
+	}{
+		{
+			name:   "rfc3339",
+			client: &generation.Client{UsageTime: "2023-05-15T10:00:00Z"},
+			want:   time.Date(2023, 5, 15, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "rfc3339 with offset",
+			client: &generation.Client{UsageTime: "2023-05-01T01:00:00+01:00"},
+			want:   time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "unix timestamp",
+			client: &generation.Client{UsageTime: "1685577599"},
+			want:   time.Date(2023, 5, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:      "before month",
+			client:    &generation.Client{UsageTime: "2023-04-30T23:59:59Z"},
+			wantError: true,
+		},
+		{
+			name:      "after month",
+			client:    &generation.Client{UsageTime: "2023-06-01T00:00:00Z"},
+			wantError: true,
+		},
+		{
+			name:      "invalid",
+			client:    &generation.Client{UsageTime: "yesterday"},
+			wantError: true,
+		},
+		{
+			name:      "repeated",
+			client:    &generation.Client{UsageTime: "2023-05-15T10:00:00Z", Repeated: true},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMultipleMonthsActivityClients(3)
+			m.now = now
+			require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{}, "mount", nil))
+			err := m.addClientToMonth(context.Background(), 1, tt.client, "mount", nil)
+			if tt.wantError {
+				require.Error(t, err)
+				require.Empty(t, m.months[1].clients)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, m.months[1].clients, 1)
+			require.Equal(t, tt.want.Unix(), m.months[1].clients[0].Timestamp)
+		})
+	}
+}
+
+// Test_validateReferences verifies that every invalid namespace and mount
+// across all months is reported at once, and that valid references pass
+func Test_validateReferences(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	valid := []*generation.Data{
+		{
+			Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+				{},
+				{Namespace: namespace.RootNamespaceID, Mount: "identity/"},
+			}}},
+		},
+	}
+	require.NoError(t, validateReferences(ctx, core, valid))
+
+	invalid := []*generation.Data{
+		{
+			Month: &generation.Data_MonthsAgo{MonthsAgo: 1},
+			Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+				{Namespace: "missing_ns"},
+				{Mount: "identity/"},
+			}}},
+		},
+		{
+			Month: &generation.Data_MonthsAgo{MonthsAgo: 2},
+			Clients: &generation.Data_Segments{Segments: &generation.Segments{Segments: []*generation.Segment{
+				{Clients: &generation.Clients{Clients: []*generation.Client{{Mount: "missing_mount"}}}},
+				{Clients: &generation.Clients{Clients: []*generation.Client{{Namespace: "other_ns", Mount: "identity/"}}}},
+			}}},
+		},
+	}
+	err := validateReferences(ctx, core, invalid)
+	require.Error(t, err)
+	errs, ok := err.(*multierror.Error)
+	require.True(t, ok)
+	require.Len(t, errs.Errors, 3)
+	require.ErrorContains(t, err, "month 1: namespace missing_ns does not exist")
+	require.ErrorContains(t, err, "month 2: mount missing_mount does not exist in namespace root")
+	require.ErrorContains(t, err, "month 2: namespace other_ns does not exist")
+}
+
+// Test_checkMountVisible verifies that a mount can be used from its own
+// namespace and from its ancestors, but not from a sibling or a descendant
+func Test_checkMountVisible(t *testing.T) {
+	parent := &namespace.Namespace{ID: "parent", Path: "parent/"}
+	child := &namespace.Namespace{ID: "child", Path: "parent/child/"}
+	sibling := &namespace.Namespace{ID: "sibling", Path: "sibling/"}
+	childMount := &MountEntry{Path: "kv/", NamespaceID: child.ID, namespace: child}
+
+	require.NoError(t, checkMountVisible(child, childMount))
+	require.NoError(t, checkMountVisible(parent, childMount))
+	require.NoError(t, checkMountVisible(namespace.RootNamespace, childMount))
+	require.EqualError(t, checkMountVisible(sibling, childMount), "mount kv/ is in namespace child, which isn't namespace sibling or one of its descendants")
+
+	parentMount := &MountEntry{Path: "kv/", NamespaceID: parent.ID, namespace: parent}
+	require.Error(t, checkMountVisible(child, parentMount))
+}
+
+// Test_resolveNamespaces verifies that namespace paths are replaced with the
+// namespaces' IDs, that IDs are kept, and that unknown values are kept to be
+// reported by validateReferences
+func Test_resolveNamespaces(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	months := []*generation.Data{
+		{
+			Clients: &generation.Data_All{All: &generation.Clients{
+				Clients: []*generation.Client{
+					{},
+					{Namespace: "/"},
+					{Namespace: namespace.RootNamespaceID},
+					{Namespace: "ns1/"},
+				},
+				Namespaces: []string{"/", "ns1"},
+			}},
+		},
+	}
+	resolveNamespaces(ctx, core, months)
+	clients := months[0].GetAll().GetClients()
+	require.Equal(t, "", clients[0].Namespace)
+	require.Equal(t, namespace.RootNamespaceID, clients[1].Namespace)
+	require.Equal(t, namespace.RootNamespaceID, clients[2].Namespace)
+	require.Equal(t, "ns1/", clients[3].Namespace)
+	require.Equal(t, []string{namespace.RootNamespaceID, "ns1"}, months[0].GetAll().GetNamespaces())
+
+	err := validateReferences(ctx, core, months)
+	require.ErrorContains(t, err, "month 0: namespace ns1/ does not exist as an ID or a path")
+	require.ErrorContains(t, err, "month 0: namespace ns1 does not exist as an ID or a path")
+}
+
 // Test_multipleMonthsActivityClients_processMonth verifies that a month of data
 // is added correctly. The test checks that default values are handled correctly
 // for mounts and namespaces.
@@ -239,6 +659,24 @@ func Test_multipleMonthsActivityClients_processMonth(t *testing.T) {
 			},
 			numMonths: 5,
 		},
+		{
+			name: "month out of range",
+			clients: &generation.Data{
+				Month:   &generation.Data_MonthsAgo{MonthsAgo: 5},
+				Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{}}}},
+			},
+			wantError: true,
+			numMonths: 5,
+		},
+		{
+			name: "negative month",
+			clients: &generation.Data{
+				Month:   &generation.Data_MonthsAgo{MonthsAgo: -1},
+				Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{}}}},
+			},
+			wantError: true,
+			numMonths: 5,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -260,6 +698,472 @@ func Test_multipleMonthsActivityClients_processMonth(t *testing.T) {
 	}
 }
 
+// Test_multipleMonthsActivityClients_processMonth_mounts verifies that clients
+// with a mount use that mount's accessor, and clients without a mount use the
+// default mount accessor, when clients use several mounts in one namespace
+func Test_multipleMonthsActivityClients_processMonth_mounts(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	mountPaths := []string{"identity/", "secret/", "sys/"}
+	wantAccessors := make([]string, 0, len(mountPaths))
+	clients := make([]*generation.Client, 0, len(mountPaths)+1)
+	for _, path := range mountPaths {
+		mountEntry := core.router.MatchingMountEntry(ctx, path)
+		require.NotNil(t, mountEntry)
+		wantAccessors = append(wantAccessors, mountEntry.Accessor)
+		clients = append(clients, &generation.Client{Mount: path, Count: proto.Int32(2)})
+	}
+	clients = append(clients, &generation.Client{})
+
+	m := newMultipleMonthsActivityClients(1)
+	err := m.processMonth(ctx, core, &generation.Data{
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: clients}},
+	})
+	require.NoError(t, err)
+	month := m.months[0]
+	require.Len(t, month.clients, 7)
+	for i, accessor := range wantAccessors {
+		require.Equal(t, accessor, month.clients[2*i].MountAccessor)
+		require.Equal(t, accessor, month.clients[2*i+1].MountAccessor)
+	}
+	require.Len(t, map[string]struct{}{wantAccessors[0]: {}, wantAccessors[1]: {}, wantAccessors[2]: {}}, 3)
+	require.NotEmpty(t, month.clients[6].MountAccessor)
+}
+
+// Test_multipleMonthsActivityClients_processMonth_defaultMount verifies that
+// clients without a mount use the month's default mount, and that clients with
+// a mount keep using their own
+func Test_multipleMonthsActivityClients_processMonth_defaultMount(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	defaultMount := core.router.MatchingMountEntry(ctx, "secret/")
+	require.NotNil(t, defaultMount)
+	otherMount := core.router.MatchingMountEntry(ctx, "sys/")
+	require.NotNil(t, otherMount)
+
+	m := newMultipleMonthsActivityClients(1)
+	month := &generation.Data{
+		DefaultMount: "secret/",
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+			{Count: proto.Int32(2)},
+			{Count: proto.Int32(1), Mount: "sys/"},
+		}}},
+	}
+	require.NoError(t, validateReferences(ctx, core, []*generation.Data{month}))
+	require.NoError(t, m.processMonth(ctx, core, month))
+	clients := m.months[0].clients
+	require.Len(t, clients, 3)
+	require.Equal(t, defaultMount.Accessor, clients[0].MountAccessor)
+	require.Equal(t, defaultMount.Accessor, clients[1].MountAccessor)
+	require.Equal(t, otherMount.Accessor, clients[2].MountAccessor)
+
+	month.DefaultMount = "missing/"
+	err := validateReferences(ctx, core, []*generation.Data{month})
+	require.ErrorContains(t, err, "mount missing/ does not exist in namespace root")
+	err = newMultipleMonthsActivityClients(1).processMonth(ctx, core, month)
+	require.ErrorContains(t, err, "unable to find matching mount")
+}
+
+// Test_multipleMonthsActivityClients_processMonth_explicitMounts verifies that
+// the mounts are only listed for the default mount once a client doesn't have
+// a mount, and then only once for all of the months
+func Test_multipleMonthsActivityClients_processMonth_explicitMounts(t *testing.T) {
+	lowerMountListRetryWait(t)
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	sysMount := core.router.MatchingMountEntry(ctx, "sys/")
+	require.NotNil(t, sysMount)
+
+	listed := 0
+	m := newMultipleMonthsActivityClients(3)
+	m.listMounts = func() ([]*MountEntry, error) {
+		listed++
+		return nil, errors.New("listing mounts failed")
+	}
+	require.NoError(t, m.processMonth(ctx, core, &generation.Data{
+		Month:   &generation.Data_MonthsAgo{MonthsAgo: 2},
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(2), Mount: "sys/"}}}},
+	}))
+	require.NoError(t, m.processMonth(ctx, core, &generation.Data{
+		Month:        &generation.Data_MonthsAgo{MonthsAgo: 1},
+		DefaultMount: "sys/",
+		Clients:      &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(1)}}}},
+	}))
+	require.Equal(t, 0, listed)
+	for _, month := range m.months[1:] {
+		for _, c := range month.clients {
+			require.Equal(t, sysMount.Accessor, c.MountAccessor)
+		}
+	}
+
+	err := m.processMonth(ctx, core, &generation.Data{
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(1)}}}},
+	})
+	require.EqualError(t, err, "unable to list mounts after 3 attempts: listing mounts failed")
+	require.Equal(t, 3, listed)
+
+	m.listMounts = func() ([]*MountEntry, error) {
+		listed++
+		return core.ListMounts()
+	}
+	month := &generation.Data{Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(1)}, {Count: proto.Int32(1)}}}}}
+	require.NoError(t, m.processMonth(ctx, core, month))
+	require.NoError(t, m.processMonth(ctx, core, month))
+	require.Equal(t, 4, listed)
+	require.NotEmpty(t, m.months[0].clients[0].MountAccessor)
+}
+
+// lowerMountListRetryWait shortens the wait between the attempts to list the
+// mounts for the test
+func lowerMountListRetryWait(t testing.TB) {
+	defaultRetryWait := mountListRetryWait
+	mountListRetryWait = time.Millisecond
+	t.Cleanup(func() {
+		mountListRetryWait = defaultRetryWait
+	})
+}
+
+// Test_listMountsWithRetry verifies that listing the mounts is retried after
+// a failure or a timeout, up to mountListAttempts times, and that it stops
+// once the context is cancelled
+func Test_listMountsWithRetry(t *testing.T) {
+	lowerMountListRetryWait(t)
+	defaultTimeout := mountListTimeout
+	mountListTimeout = 50 * time.Millisecond
+	t.Cleanup(func() {
+		mountListTimeout = defaultTimeout
+	})
+	ctx := context.Background()
+	want := []*MountEntry{{Path: "kv/"}}
+
+	calls := 0
+	mounts, err := listMountsWithRetry(ctx, "mounts", func() ([]*MountEntry, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("transient failure")
+		}
+		return want, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, want, mounts)
+	require.Equal(t, 3, calls)
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+	_, err = listMountsWithRetry(ctx, "auth mounts", func() ([]*MountEntry, error) {
+		<-blocked
+		return want, nil
+	})
+	require.EqualError(t, err, "unable to list auth mounts after 3 attempts: timed out after 50ms")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = listMountsWithRetry(cancelled, "mounts", func() ([]*MountEntry, error) {
+		<-blocked
+		return want, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+// Test_multipleMonthsActivityClients_processMonth_mountsListedOnce verifies
+// that the auth and secrets mounts are listed once for all of the months and
+// clients that need them
+func Test_multipleMonthsActivityClients_processMonth_mountsListedOnce(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	m := newMultipleMonthsActivityClients(4)
+	listedMounts, listedAuths := countMountLists(m, core)
+	for monthsAgo := int32(3); monthsAgo > 0; monthsAgo-- {
+		require.NoError(t, m.processMonth(ctx, core, &generation.Data{
+			Month: &generation.Data_MonthsAgo{MonthsAgo: monthsAgo},
+			Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+				{Count: proto.Int32(2), MountType: "kv"},
+				{Count: proto.Int32(2), NumMounts: 2},
+				{Count: proto.Int32(1)},
+			}}},
+		}))
+	}
+	require.Equal(t, 1, *listedMounts)
+	require.Equal(t, 1, *listedAuths)
+}
+
+// countMountLists makes m count how often it lists the core's secrets and
+// auth mounts
+func countMountLists(m *multipleMonthsActivityClients, core *Core) (*int, *int) {
+	listedMounts, listedAuths := new(int), new(int)
+	m.listMounts = func() ([]*MountEntry, error) {
+		*listedMounts++
+		return core.ListMounts()
+	}
+	m.listAuths = func() ([]*MountEntry, error) {
+		*listedAuths++
+		return core.ListAuths()
+	}
+	return listedMounts, listedAuths
+}
+
+// Test_multipleMonthsActivityClients_returningRatio verifies that a client
+// with a returning ratio is split into clients repeated from the earlier month
+// and new clients, that the split is in the summary, and that the earlier
+// month must have enough clients to repeat
+func Test_multipleMonthsActivityClients_returningRatio(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	ratio := func(r float64) *float64 { return &r }
+
+	m := newMultipleMonthsActivityClients(4)
+	require.NoError(t, m.processMonth(ctx, core, &generation.Data{
+		Month:   &generation.Data_MonthsAgo{MonthsAgo: 3},
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(10)}}}},
+	}))
+	require.NoError(t, m.processMonth(ctx, core, &generation.Data{
+		Month:   &generation.Data_MonthsAgo{MonthsAgo: 2},
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(4)}}}},
+	}))
+	require.NoError(t, m.processMonth(ctx, core, &generation.Data{
+		Month: &generation.Data_MonthsAgo{MonthsAgo: 1},
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+			{Count: proto.Int32(10), ReturningRatio: ratio(0.25)},
+			{Count: proto.Int32(5), ReturningRatio: ratio(1), RepeatedFromMonth: 3},
+		}}},
+	}))
+
+	month := m.months[1]
+	require.Len(t, month.clients, 15)
+	require.Equal(t, generation.ReturningSplit{New: 7, Returning: 8}, month.returningSplit)
+	require.Equal(t, map[int32]int{2: 3, 3: 5}, month.repeatedClients)
+	require.Len(t, month.generatedClientIDs, 7)
+	require.Same(t, m.months[2].clients[0], month.clients[0])
+	require.Same(t, m.months[3].clients[0], month.clients[10])
+	summary := m.summary()
+	require.Equal(t, map[string]int{"new": 7, "returning": 8}, summary[0]["returning_split"])
+	require.Equal(t, map[string]int{"new": 0, "returning": 0}, summary[1]["returning_split"])
+
+	err := m.processMonth(ctx, core, &generation.Data{
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(40), ReturningRatio: ratio(0.5)}}}},
+	})
+	require.ErrorContains(t, err, "returning clients: missing repeated 5 clients from month 1")
+
+	for _, c := range []*generation.Client{
+		{Count: proto.Int32(2), ReturningRatio: ratio(1.5)},
+		{Count: proto.Int32(2), ReturningRatio: ratio(0.5), Repeated: true},
+		{Id: "client", ReturningRatio: ratio(0.5)},
+	} {
+		err := newMultipleMonthsActivityClients(2).processMonth(ctx, core, &generation.Data{
+			Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{c}}},
+		})
+		require.ErrorContains(t, err, "returning ratio")
+	}
+}
+
+// Test_multipleMonthsActivityClients_processMonth_mountType verifies that
+// clients with a mount type use a mount of that type in their namespace, and
+// that an unknown mount type or a mount type combined with a mount is an error
+func Test_multipleMonthsActivityClients_processMonth_mountType(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	kvMount := core.router.MatchingMountEntry(ctx, "secret/")
+	require.NotNil(t, kvMount)
+	tokenMount := core.router.MatchingMountEntry(ctx, "auth/token/")
+	require.NotNil(t, tokenMount)
+
+	m := newMultipleMonthsActivityClients(1)
+	month := &generation.Data{
+		DefaultMount: "sys/",
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+			{Count: proto.Int32(2), MountType: "kv"},
+			{Count: proto.Int32(1), MountType: "token"},
+		}}},
+	}
+	require.NoError(t, validateReferences(ctx, core, []*generation.Data{month}))
+	require.NoError(t, m.processMonth(ctx, core, month))
+	clients := m.months[0].clients
+	require.Len(t, clients, 3)
+	require.Equal(t, kvMount.Accessor, clients[0].MountAccessor)
+	require.Equal(t, kvMount.Accessor, clients[1].MountAccessor)
+	require.Equal(t, tokenMount.Accessor, clients[2].MountAccessor)
+
+	month.GetAll().Clients[0].MountType = "missing"
+	err := validateReferences(ctx, core, []*generation.Data{month})
+	require.ErrorContains(t, err, "month 0: no mount of type missing in namespace root")
+	err = newMultipleMonthsActivityClients(1).processMonth(ctx, core, month)
+	require.ErrorContains(t, err, "no mount of type missing in namespace root")
+
+	month.GetAll().Clients[0].MountType = "kv"
+	month.GetAll().Clients[0].Mount = "secret/"
+	err = newMultipleMonthsActivityClients(1).processMonth(ctx, core, month)
+	require.ErrorContains(t, err, "mount secret/ and mount type kv can't both be set")
+}
+
+// Test_multipleMonthsActivityClients_processMonth_numMounts verifies that
+// clients with num_mounts are spread evenly across the first mounts of their
+// namespace, in the same way each time, and that the namespace must have enough
+// mounts
+func Test_multipleMonthsActivityClients_processMonth_numMounts(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	month := &generation.Data{
+		Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+			{Count: proto.Int32(7), NumMounts: 3},
+		}}},
+	}
+	entries, err := newMultipleMonthsActivityClients(1).mountEntries(ctx, core)
+	require.NoError(t, err)
+	mountEntries, err := firstMounts(entries, namespace.RootNamespaceID, month.GetAll().Clients[0])
+	require.NoError(t, err)
+	require.Len(t, mountEntries, 3)
+	require.NoError(t, validateReferences(ctx, core, []*generation.Data{month}))
+
+	process := func() []string {
+		t.Helper()
+		m := newMultipleMonthsActivityClients(1)
+		require.NoError(t, m.processMonth(ctx, core, month))
+		accessors := make([]string, 0, len(m.months[0].clients))
+		for _, c := range m.months[0].clients {
+			accessors = append(accessors, c.MountAccessor)
+		}
+		return accessors
+	}
+	accessors := process()
+	require.Len(t, accessors, 7)
+	counts := make(map[string]int)
+	for _, accessor := range accessors {
+		counts[accessor]++
+	}
+	require.Equal(t, map[string]int{
+		mountEntries[0].Accessor: 3,
+		mountEntries[1].Accessor: 2,
+		mountEntries[2].Accessor: 2,
+	}, counts)
+	require.Equal(t, accessors, process())
+
+	month.GetAll().Clients[0].NumMounts = 100
+	err = validateReferences(ctx, core, []*generation.Data{month})
+	require.ErrorContains(t, err, "which is fewer than the 100 requested")
+	err = newMultipleMonthsActivityClients(1).processMonth(ctx, core, month)
+	require.ErrorContains(t, err, "which is fewer than the 100 requested")
+
+	month.GetAll().Clients[0].NumMounts = 2
+	month.GetAll().Clients[0].Mount = "secret/"
+	err = newMultipleMonthsActivityClients(1).processMonth(ctx, core, month)
+	require.ErrorContains(t, err, "num mounts can't be set with a mount or a mount type")
+}
+
+// Test_Data_ExpandMatrices verifies that a client matrix is expanded into a
+// client for each namespace and mount combination in order, that its count is
+// spread across them, and that random expansion is repeatable with a seed
+func Test_Data_ExpandMatrices(t *testing.T) {
+	newMonth := func(matrix *generation.ClientMatrix) *generation.Data {
+		return &generation.Data{
+			Clients:  &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Id: "existing"}}}},
+			Matrices: []*generation.ClientMatrix{matrix},
+		}
+	}
+	month := newMonth(&generation.ClientMatrix{
+		Namespaces: []string{"ns1", "ns2"},
+		Mounts:     []string{"kv/", "auth/userpass/", "pki/"},
+		Count:      8,
+		Client:     &generation.Client{ClientType: acmeActivityType},
+	})
+	require.NoError(t, month.ExpandMatrices(nil))
+	require.Empty(t, month.Matrices)
+	clients := month.GetAll().Clients
+	require.Len(t, clients, 7)
+	require.Equal(t, "existing", clients[0].Id)
+	type combination struct {
+		namespace string
+		mount     string
+		count     int32
+	}
+	got := make([]combination, 0, len(clients)-1)
+	for _, c := range clients[1:] {
+		require.Equal(t, acmeActivityType, c.ClientType)
+		got = append(got, combination{c.Namespace, c.Mount, c.GetCount()})
+	}
+	require.Equal(t, []combination{
+		{"ns1", "kv/", 2},
+		{"ns1", "auth/userpass/", 2},
+		{"ns1", "pki/", 1},
+		{"ns2", "kv/", 1},
+		{"ns2", "auth/userpass/", 1},
+		{"ns2", "pki/", 1},
+	}, got)
+
+	random := func(seed int64) []*generation.Client {
+		t.Helper()
+		month := newMonth(&generation.ClientMatrix{
+			Namespaces:   []string{"ns1", "ns2", "ns3"},
+			Mounts:       []string{"kv/", "pki/"},
+			Count:        50,
+			Distribution: generation.NamespaceDistribution_NAMESPACE_DISTRIBUTION_RANDOM,
+		})
+		require.NoError(t, month.ExpandMatrices(rand.New(rand.NewSource(seed))))
+		total := int32(0)
+		for _, c := range month.GetAll().Clients[1:] {
+			total += c.GetCount()
+		}
+		require.Equal(t, int32(50), total)
+		return month.GetAll().Clients
+	}
+	require.Equal(t, random(7), random(7))
+
+	month = &generation.Data{Matrices: []*generation.ClientMatrix{{Count: 2}}}
+	require.NoError(t, month.ExpandMatrices(nil))
+	require.Len(t, month.GetAll().Clients, 1)
+	require.Equal(t, "", month.GetAll().Clients[0].Namespace)
+	require.Equal(t, "", month.GetAll().Clients[0].Mount)
+	require.Equal(t, int32(2), month.GetAll().Clients[0].GetCount())
+
+	err := newMonth(&generation.ClientMatrix{Client: &generation.Client{Namespace: "ns1", Id: "id"}}).ExpandMatrices(nil)
+	require.ErrorContains(t, err, "invalid matrix count 0: must be positive")
+	require.ErrorContains(t, err, "can't have a namespace, mount or count")
+	require.ErrorContains(t, err, "can't have an id, ids, mount type or num mounts")
+
+	month = &generation.Data{
+		Clients:  &generation.Data_Segments{Segments: &generation.Segments{}},
+		Matrices: []*generation.ClientMatrix{{Count: 1}},
+	}
+	require.ErrorContains(t, month.ExpandMatrices(nil), "matrices can only be used for all of a month's clients")
+}
+
+// TestSystemBackend_handleActivityWriteData_matrix verifies that the clients
+// of a matrix are written to each of its mounts, and that a mount of the
+// matrix that doesn't exist is reported like any other client's
+func TestSystemBackend_handleActivityWriteData_matrix(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	month := &generation.Data{Matrices: []*generation.ClientMatrix{{
+		Namespaces: []string{"/"},
+		Mounts:     []string{"secret/", "cubbyhole/"},
+		Count:      5,
+	}}}
+	require.NoError(t, month.ExpandMatrices(nil))
+	resolveNamespaces(ctx, core, []*generation.Data{month})
+	require.NoError(t, validateReferences(ctx, core, []*generation.Data{month}))
+	m := newMultipleMonthsActivityClients(1)
+	require.NoError(t, m.processMonth(ctx, core, month))
+	counts := make(map[string]int)
+	for _, c := range m.months[0].clients {
+		require.Equal(t, namespace.RootNamespaceID, c.NamespaceID)
+		counts[c.MountAccessor]++
+	}
+	nctx := namespace.ContextWithNamespace(ctx, namespace.RootNamespace)
+	require.Equal(t, map[string]int{
+		core.router.MatchingMountEntry(nctx, "secret/").Accessor:    3,
+		core.router.MatchingMountEntry(nctx, "cubbyhole/").Accessor: 2,
+	}, counts)
+
+	b := core.systemBackend
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":1,"matrices":[{"mounts":["secret/","missing/"],"count":2}]}
+	]}`}
+	resp, err := b.HandleRequest(ctx, req)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	require.ErrorContains(t, resp.Error(), "month 1: mount missing/ does not exist in namespace root")
+}
+
 // Test_multipleMonthsActivityClients_processMonth_segmented verifies that segments
 // are filled correctly when a month is processed with segmented data. The clients
 // should be in the clients array, and should also be in the predefinedSegments map
@@ -310,68 +1214,295 @@ func Test_multipleMonthsActivityClients_addRepeatedClients(t *testing.T) {
 	m := newMultipleMonthsActivityClients(3)
 	defaultMount := "default"
 
-	require.NoError(t, m.addClientToMonth(2, &generation.Client{Count: 2}, "identity", nil))
-	require.NoError(t, m.addClientToMonth(2, &generation.Client{Count: 2, Namespace: "other_ns"}, defaultMount, nil))
-	require.NoError(t, m.addClientToMonth(1, &generation.Client{Count: 2}, defaultMount, nil))
-	require.NoError(t, m.addClientToMonth(1, &generation.Client{Count: 2, NonEntity: true}, defaultMount, nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(2)}, "identity", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(2), Namespace: "other_ns"}, defaultMount, nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(2)}, defaultMount, nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(2), NonEntity: true}, defaultMount, nil))
 
 	month2Clients := m.months[2].clients
 	month1Clients := m.months[1].clients
 
 	thisMonth := m.months[0]
 	// this will match the first client in month 1
-	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: 1, Repeated: true}, defaultMount, nil))
+	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), Repeated: true}, defaultMount, nil))
 	require.Contains(t, month1Clients, thisMonth.clients[0])
 
 	// this will match the 3rd client in month 1
-	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: 1, Repeated: true, NonEntity: true}, defaultMount, nil))
+	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), Repeated: true, NonEntity: true}, defaultMount, nil))
 	require.Equal(t, month1Clients[2], thisMonth.clients[1])
 
 	// this will match the first two clients in month 1
-	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: 2, Repeated: true}, defaultMount, nil))
+	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(2), Repeated: true}, defaultMount, nil))
 	require.Equal(t, month1Clients[0:2], thisMonth.clients[2:4])
 
 	// this will match the first client in month 2
-	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: 1, RepeatedFromMonth: 2}, "identity", nil))
+	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), RepeatedFromMonth: 2}, "identity", nil))
 	require.Equal(t, month2Clients[0], thisMonth.clients[4])
 
 	// this will match the 3rd client in month 2
-	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: 1, RepeatedFromMonth: 2, Namespace: "other_ns"}, defaultMount, nil))
+	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), RepeatedFromMonth: 2, Namespace: "other_ns"}, defaultMount, nil))
 	require.Equal(t, month2Clients[2], thisMonth.clients[5])
 
-	require.Error(t, m.addRepeatedClients(0, &generation.Client{Count: 1, RepeatedFromMonth: 2, Namespace: "other_ns"}, "other_mount", nil))
+	require.Error(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), RepeatedFromMonth: 2, Namespace: "other_ns"}, "other_mount", nil))
 }
 
-// Test_singleMonthActivityClients_populateSegments calls populateSegments for a
-// collection of 5 clients, segmented in various ways. The test ensures that the
-// resulting map has the correct clients for each segment index
-func Test_singleMonthActivityClients_populateSegments(t *testing.T) {
-	clients := []*activity.EntityRecord{
-		{ClientID: "a"},
-		{ClientID: "b"},
-		{ClientID: "c"},
-		{ClientID: "d"},
-		{ClientID: "e"},
-	}
-	cases := []struct {
-		name         string
-		segments     map[int][]int
-		numSegments  int
-		emptyIndexes []int32
-		skipIndexes  []int32
-		wantSegments map[int][]*activity.EntityRecord
+// Test_multipleMonthsActivityClients_addRepeatedClients_percent verifies that
+// the number of clients repeated with RepeatedPercent is the rounded
+// percentage of the matching clients in the source month
+func Test_multipleMonthsActivityClients_addRepeatedClients_percent(t *testing.T) {
+	tests := []struct {
+		name      string
+		percent   float64
+		count     *int32
+		matching  int32
+		want      int
+		wantError bool
 	}{
 		{
-			name: "segmented",
-			segments: map[int][]int{
-				0: {0, 1},
-				1: {2, 3},
-				2: {4},
-			},
-			wantSegments: map[int][]*activity.EntityRecord{
-				0: {{ClientID: "a"}, {ClientID: "b"}},
-				1: {{ClientID: "c"}, {ClientID: "d"}},
-				2: {{ClientID: "e"}},
+			name:     "exact percentage",
+			percent:  30,
+			matching: 10,
+			want:     3,
+		},
+		{
+			name:     "rounds down",
+			percent:  33,
+			matching: 10,
+			want:     3,
+		},
+		{
+			name:     "rounds half up",
+			percent:  25,
+			matching: 10,
+			want:     3,
+		},
+		{
+			name:     "all clients",
+			percent:  100,
+			matching: 7,
+			want:     7,
+		},
+		{
+			name:     "at least one client",
+			percent:  1,
+			matching: 10,
+			want:     1,
+		},
+		{
+			name:      "no matching clients",
+			percent:   50,
+			wantError: true,
+		},
+		{
+			name:      "percent too high",
+			percent:   101,
+			matching:  10,
+			wantError: true,
+		},
+		{
+			name:      "negative percent",
+			percent:   -10,
+			matching:  10,
+			wantError: true,
+		},
+		{
+			name:      "percent and count",
+			percent:   50,
+			count:     proto.Int32(2),
+			matching:  10,
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMultipleMonthsActivityClients(2)
+			if tt.matching > 0 {
+				require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(tt.matching)}, "mount", nil))
+			}
+			// this client never matches, and shouldn't affect the percentage
+			require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(5), NonEntity: true}, "mount", nil))
+
+			err := m.addClientToMonth(context.Background(), 0, &generation.Client{RepeatedPercent: tt.percent, Count: tt.count}, "mount", nil)
+			if tt.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, m.months[0].clients, tt.want)
+			require.Equal(t, m.months[1].clients[:tt.want], m.months[0].clients)
+		})
+	}
+}
+
+// Test_multipleMonthsActivityClients_addRepeatedClients_outOfRange verifies
+// that clients can't be repeated from a month that wasn't generated, or from
+// the same or a later month
+func Test_multipleMonthsActivityClients_addRepeatedClients_outOfRange(t *testing.T) {
+	m := newMultipleMonthsActivityClients(3)
+	require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(2)}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(2)}, "mount", nil))
+
+	err := m.addRepeatedClients(2, &generation.Client{Count: proto.Int32(1), Repeated: true}, "mount", nil)
+	require.ErrorContains(t, err, "cannot repeat from month 3: only 3 months generated")
+
+	err = m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), RepeatedFromMonth: 3}, "mount", nil)
+	require.ErrorContains(t, err, "cannot repeat from month 3: only 3 months generated")
+
+	err = m.addRepeatedClients(1, &generation.Client{Count: proto.Int32(1), RepeatedFromMonth: 1}, "mount", nil)
+	require.ErrorContains(t, err, "only be repeated from earlier months")
+
+	err = m.addRepeatedClients(2, &generation.Client{Count: proto.Int32(1), RepeatedFromMonth: 1}, "mount", nil)
+	require.ErrorContains(t, err, "only be repeated from earlier months")
+}
+
+// Test_multipleMonthsActivityClients_addRepeatedClients_chained verifies that
+// a client can be repeated through a chain of months that only repeat clients,
+// including months that aren't next to each other, and that every month gets
+// the originally generated client
+func Test_multipleMonthsActivityClients_addRepeatedClients_chained(t *testing.T) {
+	m := newMultipleMonthsActivityClients(7)
+	require.NoError(t, m.addClientToMonth(context.Background(), 6, &generation.Client{Count: proto.Int32(3)}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 4, &generation.Client{Count: proto.Int32(3), RepeatedFromMonth: 6}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 3, &generation.Client{Count: proto.Int32(2), Repeated: true}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(2), RepeatedFromMonth: 3}, "mount", nil))
+
+	original := m.months[6].clients
+	require.Equal(t, original, m.months[4].clients)
+	require.Equal(t, original[:2], m.months[3].clients)
+	require.Len(t, m.months[0].clients, 2)
+	for i, client := range m.months[0].clients {
+		require.Same(t, original[i], client)
+	}
+	require.Equal(t, map[int32]int{3: 2}, m.months[0].repeatedClients)
+
+	// a month with the same client twice only offers it to be repeated once
+	require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(2), RepeatedFromMonth: 3}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(2), RepeatedFromMonth: 3}, "mount", nil))
+	require.Len(t, m.months[2].clients, 4)
+	err := m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(3), Repeated: true}, "mount", nil)
+	require.ErrorContains(t, err, "missing repeated 1 clients from month 2")
+}
+
+// Test_multipleMonthsActivityClients_addRepeatedClients_fromAll verifies that
+// clients repeated from all months are the clients in every earlier month,
+// over four months, and that a month without enough of them is reported
+func Test_multipleMonthsActivityClients_addRepeatedClients_fromAll(t *testing.T) {
+	m := newMultipleMonthsActivityClients(4)
+	require.NoError(t, m.addClientToMonth(context.Background(), 3, &generation.Client{Count: proto.Int32(4)}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 3, &generation.Client{Count: proto.Int32(2), ClientType: acmeActivityType}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(2)}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(3), RepeatedFromAll: true}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(3), RepeatedFromAll: true}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(2), RepeatedFromAll: true}, "mount", nil))
+
+	original := m.months[3].clients[:3]
+	require.Equal(t, original, m.months[2].clients[2:])
+	require.Equal(t, original, m.months[1].clients)
+	require.Equal(t, original[:2], m.months[0].clients)
+	require.Equal(t, map[int32]int{3: 3}, m.months[2].repeatedClients)
+	require.Equal(t, map[int32]int{3: 3, 2: 3}, m.months[1].repeatedClients)
+	require.Equal(t, map[int32]int{3: 2, 2: 2, 1: 2}, m.months[0].repeatedClients)
+
+	// the fourth original client isn't in months 2 or 1
+	err := m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(4), RepeatedFromAll: true}, "mount", nil)
+	require.ErrorContains(t, err, "missing repeated 1 clients from month 2")
+
+	// the acme clients are only in month 3
+	err = m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(1), RepeatedFromAll: true, ClientType: acmeActivityType}, "mount", nil)
+	require.ErrorContains(t, err, "missing repeated 1 clients from month 2")
+
+	err = m.addClientToMonth(context.Background(), 3, &generation.Client{Count: proto.Int32(1), RepeatedFromAll: true}, "mount", nil)
+	require.ErrorContains(t, err, "there are no earlier months")
+
+	err = m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(1), RepeatedFromAll: true, RepeatedFromMonth: 2}, "mount", nil)
+	require.ErrorContains(t, err, "can't be used with repeated or repeated from month")
+}
+
+// Test_multipleMonthsActivityClients_mixedClientTypes generates a month with
+// entity, non-entity, and secret sync clients, and repeats them in the next
+// month. The test verifies that every client keeps its type through
+// segmentation and repetition
+func Test_multipleMonthsActivityClients_mixedClientTypes(t *testing.T) {
+	m := newMultipleMonthsActivityClients(2)
+	mount := "mount"
+
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(2)}, mount, nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(2), NonEntity: true}, mount, nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(2), ClientType: secretSyncActivityType}, mount, nil))
+
+	require.NoError(t, m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(1), Repeated: true}, mount, nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(1), Repeated: true, ClientType: secretSyncActivityType}, mount, nil))
+
+	m.months[1].generationParameters = &generation.Data{NumSegments: 3}
+	segments, err := m.months[1].populateSegments()
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+	for i, wantType := range []string{entityActivityType, nonEntityTokenActivityType, secretSyncActivityType} {
+		require.Len(t, segments[i], 2)
+		for _, client := range segments[i] {
+			require.Equal(t, wantType, client.ClientType)
+			require.Equal(t, wantType != entityActivityType, client.NonEntity)
+		}
+	}
+
+	thisMonth := m.months[0]
+	require.Len(t, thisMonth.clients, 2)
+	require.Equal(t, m.months[1].clients[0], thisMonth.clients[0])
+	require.Equal(t, m.months[1].clients[4], thisMonth.clients[1])
+}
+
+// Test_multipleMonthsActivityClients_addRepeatedClients_clientType verifies
+// that repeated clients are only matched with clients of the same type, when
+// clients of different types share a namespace and mount
+func Test_multipleMonthsActivityClients_addRepeatedClients_clientType(t *testing.T) {
+	m := newMultipleMonthsActivityClients(2)
+	mount := "mount"
+
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(1), NonEntity: true}, mount, nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(1), ClientType: acmeActivityType}, mount, nil))
+	lastMonthClients := m.months[1].clients
+
+	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), Repeated: true, ClientType: acmeActivityType}, mount, nil))
+	require.Equal(t, lastMonthClients[1], m.months[0].clients[0])
+
+	require.NoError(t, m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), Repeated: true, NonEntity: true}, mount, nil))
+	require.Equal(t, lastMonthClients[0], m.months[0].clients[1])
+
+	err := m.addRepeatedClients(0, &generation.Client{Count: proto.Int32(1), Repeated: true, ClientType: secretSyncActivityType}, mount, nil)
+	require.ErrorContains(t, err, `client type "secret-sync"`)
+}
+
+// Test_singleMonthActivityClients_populateSegments calls populateSegments for a
+// collection of 5 clients, segmented in various ways. The test ensures that the
+// resulting map has the correct clients for each segment index
+func Test_singleMonthActivityClients_populateSegments(t *testing.T) {
+	clients := []*generatedClient{
+		{EntityRecord: &activity.EntityRecord{ClientID: "a"}},
+		{EntityRecord: &activity.EntityRecord{ClientID: "b"}},
+		{EntityRecord: &activity.EntityRecord{ClientID: "c"}},
+		{EntityRecord: &activity.EntityRecord{ClientID: "d"}},
+		{EntityRecord: &activity.EntityRecord{ClientID: "e"}},
+	}
+	cases := []struct {
+		name         string
+		segments     map[int][]int
+		numSegments  int
+		emptyIndexes []int32
+		skipIndexes  []int32
+		distribution generation.SegmentDistribution
+		wantSegments map[int][]*activity.EntityRecord
+	}{
+		{
+			name: "segmented",
+			segments: map[int][]int{
+				0: {0, 1},
+				1: {2, 3},
+				2: {4},
+			},
+			wantSegments: map[int][]*activity.EntityRecord{
+				0: {{ClientID: "a"}, {ClientID: "b"}},
+				1: {{ClientID: "c"}, {ClientID: "d"}},
+				2: {{ClientID: "e"}},
 			},
 		},
 		{
@@ -418,13 +1549,2273 @@ func Test_singleMonthActivityClients_populateSegments(t *testing.T) {
 				4: {{ClientID: "d"}, {ClientID: "e"}},
 			},
 		},
+		{
+			name:         "all clients split filling each segment",
+			numSegments:  3,
+			distribution: generation.SegmentDistribution_SEGMENT_DISTRIBUTION_FILL,
+			wantSegments: map[int][]*activity.EntityRecord{
+				0: {{ClientID: "a"}, {ClientID: "b"}},
+				1: {{ClientID: "c"}, {ClientID: "d"}},
+				2: {{ClientID: "e"}},
+			},
+		},
+		{
+			name:         "all clients split round robin",
+			numSegments:  3,
+			distribution: generation.SegmentDistribution_SEGMENT_DISTRIBUTION_ROUND_ROBIN,
+			wantSegments: map[int][]*activity.EntityRecord{
+				0: {{ClientID: "a"}, {ClientID: "d"}},
+				1: {{ClientID: "b"}, {ClientID: "e"}},
+				2: {{ClientID: "c"}},
+			},
+		},
+		{
+			name:         "all clients round robin with skip and empty",
+			numSegments:  5,
+			skipIndexes:  []int32{0, 3},
+			emptyIndexes: []int32{2},
+			distribution: generation.SegmentDistribution_SEGMENT_DISTRIBUTION_ROUND_ROBIN,
+			wantSegments: map[int][]*activity.EntityRecord{
+				0: nil,
+				1: {{ClientID: "a"}, {ClientID: "c"}, {ClientID: "e"}},
+				2: {},
+				3: nil,
+				4: {{ClientID: "b"}, {ClientID: "d"}},
+			},
+		},
+		{
+			name:         "round robin without num segments",
+			distribution: generation.SegmentDistribution_SEGMENT_DISTRIBUTION_ROUND_ROBIN,
+			wantSegments: map[int][]*activity.EntityRecord{
+				0: {{ClientID: "a"}, {ClientID: "b"}, {ClientID: "c"}, {ClientID: "d"}, {ClientID: "e"}},
+			},
+		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			s := singleMonthActivityClients{predefinedSegments: tc.segments, clients: clients, generationParameters: &generation.Data{EmptySegmentIndexes: tc.emptyIndexes, SkipSegmentIndexes: tc.skipIndexes, NumSegments: int32(tc.numSegments)}}
+			s := singleMonthActivityClients{predefinedSegments: tc.segments, clients: clients, generationParameters: &generation.Data{EmptySegmentIndexes: tc.emptyIndexes, SkipSegmentIndexes: tc.skipIndexes, NumSegments: int32(tc.numSegments), SegmentDistribution: tc.distribution}}
 			gotSegments, err := s.populateSegments()
 			require.NoError(t, err)
 			require.Equal(t, tc.wantSegments, gotSegments)
 		})
 	}
 }
+
+// Test_singleMonthActivityClients_populateSegments_roundRobinConflicts
+// verifies that the round robin segment distribution can't be combined with
+// the ways of splitting the clients other than num segments
+func Test_singleMonthActivityClients_populateSegments_roundRobinConflicts(t *testing.T) {
+	clients := []*generatedClient{
+		{EntityRecord: &activity.EntityRecord{ClientID: "a"}},
+		{EntityRecord: &activity.EntityRecord{ClientID: "b"}},
+	}
+	roundRobin := generation.SegmentDistribution_SEGMENT_DISTRIBUTION_ROUND_ROBIN
+	for name, s := range map[string]singleMonthActivityClients{
+		"clients in segments": {predefinedSegments: map[int][]int{0: {0, 1}}, generationParameters: &generation.Data{SegmentDistribution: roundRobin}},
+		"segment weights":     {generationParameters: &generation.Data{NumSegments: 2, SegmentWeights: []float64{1, 1}, SegmentDistribution: roundRobin}},
+		"segment byte size":   {generationParameters: &generation.Data{SegmentByteSize: 1024, SegmentDistribution: roundRobin}},
+		"segment capacities":  {generationParameters: &generation.Data{SegmentCapacities: map[int32]int32{0: 1, 1: 1}, SegmentDistribution: roundRobin}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s.clients = clients
+			_, err := s.populateSegments()
+			require.ErrorContains(t, err, "the round robin segment distribution can only be used with num segments")
+		})
+	}
+}
+
+// Test_singleMonthActivityClients_populateSegments_matchProductionSplitting
+// verifies that matching the production splitting fills segments of the
+// activity log's segment capacity in order, and that it can't be combined with
+// the other ways of splitting the clients
+func Test_singleMonthActivityClients_populateSegments_matchProductionSplitting(t *testing.T) {
+	clients := make([]*generatedClient, 2*activitySegmentClientCapacity+1)
+	for i := range clients {
+		clients[i] = &generatedClient{EntityRecord: &activity.EntityRecord{ClientID: fmt.Sprintf("client-%d", i)}}
+	}
+	s := singleMonthActivityClients{clients: clients, generationParameters: &generation.Data{MatchProductionSplitting: true}}
+	segments, err := s.populateSegments()
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+	require.Len(t, segments[0], activitySegmentClientCapacity)
+	require.Len(t, segments[1], activitySegmentClientCapacity)
+	require.Len(t, segments[2], 1)
+	require.Equal(t, "client-0", segments[0][0].ClientID)
+	require.Equal(t, fmt.Sprintf("client-%d", activitySegmentClientCapacity), segments[1][0].ClientID)
+	require.Equal(t, clients[len(clients)-1].ClientID, segments[2][0].ClientID)
+	require.Zero(t, s.emptySegments)
+
+	s = singleMonthActivityClients{generationParameters: &generation.Data{MatchProductionSplitting: true}}
+	segments, err = s.populateSegments()
+	require.NoError(t, err)
+	require.Equal(t, map[int][]*activity.EntityRecord{0: {}}, segments)
+
+	for name, params := range map[string]*generation.Data{
+		"num segments":       {NumSegments: 2},
+		"segment weights":    {SegmentWeights: []float64{1, 1}},
+		"segment byte size":  {SegmentByteSize: 1024},
+		"segment capacities": {SegmentCapacities: map[int32]int32{0: 1}},
+		"round robin":        {SegmentDistribution: generation.SegmentDistribution_SEGMENT_DISTRIBUTION_ROUND_ROBIN},
+		"skipped indexes":    {SkipSegmentIndexes: []int32{1}},
+		"empty indexes":      {EmptySegmentIndexes: []int32{0}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			params.MatchProductionSplitting = true
+			s := singleMonthActivityClients{clients: clients[:2], generationParameters: params}
+			_, err := s.populateSegments()
+			require.ErrorContains(t, err, "match production splitting can't be used with")
+		})
+	}
+	t.Run("clients in segments", func(t *testing.T) {
+		s := singleMonthActivityClients{clients: clients[:2], predefinedSegments: map[int][]int{0: {0, 1}}, generationParameters: &generation.Data{MatchProductionSplitting: true}}
+		_, err := s.populateSegments()
+		require.ErrorContains(t, err, "match production splitting can't be used with")
+	})
+}
+
+// Test_productionSegmentCount verifies the number of segments that clients are
+// split into, and that more segments than the maximum are rejected
+func Test_productionSegmentCount(t *testing.T) {
+	for _, tc := range []struct {
+		numClients int
+		want       int
+	}{
+		{numClients: 0, want: 1},
+		{numClients: 1, want: 1},
+		{numClients: 10, want: 1},
+		{numClients: 11, want: 2},
+		{numClients: 30, want: 3},
+	} {
+		got, err := productionSegmentCount(tc.numClients, 10, 3)
+		require.NoError(t, err, tc.numClients)
+		require.Equal(t, tc.want, got, tc.numClients)
+	}
+
+	_, err := productionSegmentCount(31, 10, 3)
+	require.EqualError(t, err, "31 clients need 4 segments of 10 clients, more than the 3 segments the activity log stores in a month")
+
+	got, err := productionSegmentCount((activityLogMaxSegmentPerMonth+1)*activitySegmentClientCapacity, activitySegmentClientCapacity, activityLogMaxSegmentPerMonth+1)
+	require.NoError(t, err)
+	require.Equal(t, activityLogMaxSegmentPerMonth+1, got)
+}
+
+// TestSystemBackend_handleActivityWriteData_matchProductionSplitting verifies
+// that the write endpoint splits a month's clients into the segments the
+// activity log would write for them
+func TestSystemBackend_handleActivityWriteData_matchProductionSplitting(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": fmt.Sprintf(`{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":1,"match_production_splitting":true,"all":{"clients":[{"count":%d}]}}
+	]}`, activitySegmentClientCapacity+1)}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+
+	monthPath := fmt.Sprintf("%s%d/", activityEntityBasePath, monthTimestamp(1, timeutil.StartOfMonth(a.clock.Now().UTC())).Unix())
+	require.Equal(t, []string{monthPath + "0", monthPath + "1"}, resp.Data["paths"])
+	for i, want := range []int{activitySegmentClientCapacity, 1} {
+		entry, err := a.view.Get(ctx, fmt.Sprintf("%s%d", monthPath, i))
+		require.NoError(t, err)
+		segment := &activity.EntityActivityLog{}
+		require.NoError(t, proto.Unmarshal(entry.Value, segment))
+		require.Len(t, segment.Clients, want)
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_writes calls the activity log
+// write endpoint with entity, precomputed query and intent log write options,
+// and verifies that the segments, queries, distinct clients, and intent log
+// are all written to storage
+func TestSystemBackend_handleActivityWriteData_writes(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES","WRITE_PRECOMPUTED_QUERIES","WRITE_INTENT_LOGS"],
+		"data":[
+			{"months_ago":1,"all":{"clients":[{"count":4, "repeated":true}]}},
+			{"months_ago":2,"num_segments":2,"all":{"clients":[{"count":4},{"count":2,"non_entity":true}]}}
+		]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	now := timeutil.StartOfMonth(time.Now().UTC())
+	oneMonthAgo := timeutil.StartOfMonth(timeutil.MonthsPreviousTo(1, now))
+	twoMonthsAgo := timeutil.StartOfMonth(timeutil.MonthsPreviousTo(2, now))
+	require.Equal(t, []string{
+		fmt.Sprintf("%s%d/0", activityEntityBasePath, oneMonthAgo.Unix()),
+		fmt.Sprintf("%s%d/0", activityEntityBasePath, twoMonthsAgo.Unix()),
+		fmt.Sprintf("%s%d/1", activityEntityBasePath, twoMonthsAgo.Unix()),
+	}, resp.Data["paths"])
+
+	clientCount := 0
+	for _, path := range resp.Data["paths"].([]string) {
+		entry, err := a.view.Get(ctx, path)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		segment := &activity.EntityActivityLog{}
+		require.NoError(t, proto.Unmarshal(entry.Value, segment))
+		clientCount += len(segment.Clients)
+	}
+	require.Equal(t, 10, clientCount)
+
+	pq, err := a.queryStore.Get(ctx, twoMonthsAgo, timeutil.EndOfMonth(oneMonthAgo))
+	require.NoError(t, err)
+	require.NotNil(t, pq)
+	require.Len(t, pq.Months, 2)
+	require.Len(t, pq.Namespaces, 1)
+	require.Equal(t, uint64(4), pq.Namespaces[0].Entities)
+	require.Equal(t, uint64(2), pq.Namespaces[0].NonEntityTokens)
+
+	hll, err := a.CreateOrFetchHyperlogLog(ctx, twoMonthsAgo)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), hll.Estimate())
+
+	entry, err := a.view.Get(ctx, activityIntentLogKey)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	intentLog := &ActivityIntentLog{}
+	require.NoError(t, entry.DecodeJSON(intentLog))
+	require.Equal(t, oneMonthAgo.Unix(), intentLog.PreviousMonth)
+	require.Equal(t, now.Unix(), intentLog.NextMonth)
+}
+
+// TestSystemBackend_handleActivityWriteData_skippedSegments verifies that
+// skipped segment indexes aren't written to storage, and empty segment
+// indexes are written without any clients
+func TestSystemBackend_handleActivityWriteData_skippedSegments(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[{"months_ago":1,"num_segments":3,"skip_segment_indexes":[0],"empty_segment_indexes":[1],"all":{"clients":[{"count":3}]}}]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	oneMonthAgo := timeutil.StartOfMonth(timeutil.MonthsPreviousTo(1, time.Now().UTC()))
+	emptyPath := fmt.Sprintf("%s%d/1", activityEntityBasePath, oneMonthAgo.Unix())
+	fullPath := fmt.Sprintf("%s%d/2", activityEntityBasePath, oneMonthAgo.Unix())
+	require.Equal(t, []string{emptyPath, fullPath}, resp.Data["paths"])
+
+	entry, err := a.view.Get(ctx, fmt.Sprintf("%s%d/0", activityEntityBasePath, oneMonthAgo.Unix()))
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	for path, numClients := range map[string]int{emptyPath: 0, fullPath: 3} {
+		entry, err = a.view.Get(ctx, path)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		segment := &activity.EntityActivityLog{}
+		require.NoError(t, proto.Unmarshal(entry.Value, segment))
+		require.Len(t, segment.Clients, numClients)
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_summary verifies that the write
+// endpoint's response describes each generated month. Clients given an ID in
+// the input and repeated clients must not be reported as generated
+func TestSystemBackend_handleActivityWriteData_summary(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[
+			{"months_ago":1,"all":{"clients":[{"count":2, "repeated_from_month":3}]}},
+			{"months_ago":3,"num_segments":3,"skip_segment_indexes":[2],"all":{"clients":[{"count":2},{"id":"client-id"}]}}
+		]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Len(t, months, 2)
+
+	require.Equal(t, 1, months[0]["months_ago"])
+	require.Equal(t, 2, months[0]["num_clients"])
+	require.Empty(t, months[0]["generated_client_ids"])
+	require.Equal(t, map[int]int{3: 2}, months[0]["repeated_clients"])
+	require.Equal(t, map[int]int{0: 2}, months[0]["segments"])
+
+	require.Equal(t, 3, months[1]["months_ago"])
+	require.Equal(t, 3, months[1]["num_clients"])
+	require.Len(t, months[1]["generated_client_ids"], 2)
+	require.NotContains(t, months[1]["generated_client_ids"], "client-id")
+	require.Empty(t, months[1]["repeated_clients"])
+	require.Equal(t, map[int]int{0: 2, 1: 1}, months[1]["segments"])
+}
+
+// TestSystemBackend_handleActivityWriteData_seed verifies that writing the
+// same input with the same seed generates the same client IDs, and that a
+// different seed or no seed generates different client IDs
+func TestSystemBackend_handleActivityWriteData_seed(t *testing.T) {
+	b := testSystemBackend(t)
+	write := func(seed string) []string {
+		t.Helper()
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": `{"write":["WRITE_ENTITIES"],` + seed + `"data":[
+			{"months_ago":1,"all":{"clients":[{"count":3}]}},
+			{"months_ago":2,"all":{"clients":[{"count":3}]}}
+		]}`}
+		resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+		require.NoError(t, err)
+		var ids []string
+		for _, month := range resp.Data["months"].([]map[string]interface{}) {
+			ids = append(ids, month["generated_client_ids"].([]string)...)
+		}
+		require.Len(t, ids, 6)
+		return ids
+	}
+
+	seeded := write(`"seed":1,`)
+	require.Equal(t, seeded, write(`"seed":1,`))
+	require.NotEqual(t, seeded, write(`"seed":2,`))
+	require.NotEqual(t, seeded, write(""))
+}
+
+// TestSystemBackend_handleActivityWriteData_dryRun verifies that a dry run
+// describes the generated months without writing anything to storage
+func TestSystemBackend_handleActivityWriteData_dryRun(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{
+		"dry_run": true,
+		"input": `{
+		"write":["WRITE_ENTITIES","WRITE_PRECOMPUTED_QUERIES","WRITE_INTENT_LOGS"],
+		"data":[
+			{"months_ago":1,"all":{"clients":[{"count":1, "repeated":true},{"count":2}]}},
+			{"months_ago":2,"num_segments":2,"all":{"clients":[{"count":3}]}}
+		]}`,
+	}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, true, resp.Data["dry_run"])
+	require.NotContains(t, resp.Data, "paths")
+
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Len(t, months, 2)
+	require.Equal(t, 3, months[0]["num_clients"])
+	require.Len(t, months[0]["generated_client_ids"], 2)
+	require.Equal(t, map[int]int{2: 1}, months[0]["repeated_clients"])
+	require.Equal(t, map[int]int{0: 3}, months[0]["segments"])
+	require.Equal(t, 3, months[1]["num_clients"])
+	require.Equal(t, map[int]int{0: 2, 1: 1}, months[1]["segments"])
+
+	for _, path := range []string{activityEntityBasePath, distinctClientsBasePath} {
+		keys, err := a.view.List(ctx, path)
+		require.NoError(t, err)
+		require.Empty(t, keys)
+	}
+	entry, err := a.view.Get(ctx, activityIntentLogKey)
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
+// TestSystemBackend_handleActivityWriteData_validateOnly verifies that
+// validate_only returns the unresolved namespace and mount references of all
+// months, without rejecting the input or writing anything to storage
+func TestSystemBackend_handleActivityWriteData_validateOnly(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+
+	validate := func(input string, dryRun bool) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"validate_only": true, "input": input}
+		if dryRun {
+			req.Data["dry_run"] = true
+		}
+		return core.systemBackend.HandleRequest(ctx, req)
+	}
+
+	resp, err := validate(`{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":1,"all":{"clients":[{"count":2,"mount":"secret/"},{"namespace":"/","mount_type":"kv"}]}}
+	]}`, false)
+	require.NoError(t, err)
+	require.Equal(t, true, resp.Data["valid"])
+	require.Empty(t, resp.Data["unresolved_references"])
+
+	resp, err = validate(`{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":1,"all":{"clients":[{"count":2,"mount":"missing/"},{"count":1,"mount":"secret/"}]}},
+		{"months_ago":2,"all":{"clients":[{"namespace":"missing_ns"},{"mount_type":"missing_type"}]}}
+	]}`, false)
+	require.NoError(t, err)
+	require.Equal(t, false, resp.Data["valid"])
+	unresolved := resp.Data["unresolved_references"].([]string)
+	require.Len(t, unresolved, 3)
+	require.Equal(t, "month 1: mount missing/ does not exist in namespace root", unresolved[0])
+	require.Equal(t, "month 2: namespace missing_ns does not exist as an ID or a path", unresolved[1])
+	require.Contains(t, unresolved[2], "month 2: ")
+	require.Contains(t, unresolved[2], "missing_type")
+
+	keys, err := a.view.List(ctx, activityEntityBasePath)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	resp, err = validate(`{"data":[{"months_ago":1,"all":{"clients":[{}]}}]}`, true)
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.Equal(t, "\"validate_only\" can't be used with \"dry_run\"", resp.Error().Error())
+}
+
+// Test_singleMonthActivityClients_populateSegments_workers verifies that
+// populating segments with multiple workers gives the same segments, with the
+// clients in the same order, as populating them with a single worker, and that
+// a seed gives the same segments each time
+func Test_singleMonthActivityClients_populateSegments_workers(t *testing.T) {
+	generate := func(workers int) map[int][]*activity.EntityRecord {
+		t.Helper()
+		m := newMultipleMonthsActivityClients(2)
+		m.setSeed(7)
+		m.months[1].generationParameters = &generation.Data{
+			NumSegments:         20,
+			SkipSegmentIndexes:  []int32{3},
+			EmptySegmentIndexes: []int32{7},
+		}
+		require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(1000)}, "mount", nil))
+		m.setWorkers(workers)
+		segments, err := m.months[1].populateSegments()
+		require.NoError(t, err)
+		return segments
+	}
+
+	want := generate(1)
+	require.Len(t, want, 20)
+	for _, workers := range []int{1, 4, 16} {
+		require.Equal(t, want, generate(workers), "workers=%d", workers)
+	}
+}
+
+// generateLargeMonth creates a month of numClients clients split over
+// numSegments segments
+func generateLargeMonth(b *testing.B, numClients, numSegments int) *multipleMonthsActivityClients {
+	b.Helper()
+	m := newMultipleMonthsActivityClients(2)
+	m.months[1].generationParameters = &generation.Data{NumSegments: int32(numSegments)}
+	require.NoError(b, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(int32(numClients))}, "mount", nil))
+	return m
+}
+
+// Benchmark_singleMonthActivityClients_populateSegments compares populating the
+// segments of a large month with different numbers of workers
+func Benchmark_singleMonthActivityClients_populateSegments(b *testing.B) {
+	m := generateLargeMonth(b, 500_000, 100)
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			m.setWorkers(workers)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := m.months[1].populateSegments()
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+// Benchmark_multipleMonthsActivityClients_processMonth_mountLists processes
+// a year of months whose clients pick their mounts by type, and reports how
+// often the mounts are listed for each year, which is once for the auth and
+// once for the secrets mounts rather than for every client
+func Benchmark_multipleMonthsActivityClients_processMonth_mountLists(b *testing.B) {
+	core, _, _ := TestCoreUnsealed(benchhelpers.TBtoT(b))
+	ctx := namespace.RootContext(nil)
+	months := make([]*generation.Data, 0, 12)
+	for monthsAgo := int32(12); monthsAgo > 0; monthsAgo-- {
+		months = append(months, &generation.Data{
+			Month: &generation.Data_MonthsAgo{MonthsAgo: monthsAgo},
+			Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{
+				{Count: proto.Int32(10), MountType: "kv"},
+				{Count: proto.Int32(10), NumMounts: 2},
+			}}},
+		})
+	}
+
+	lists := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := newMultipleMonthsActivityClients(13)
+		listedMounts, listedAuths := countMountLists(m, core)
+		for _, month := range months {
+			if err := m.processMonth(ctx, core, month); err != nil {
+				b.Fatal(err)
+			}
+		}
+		lists += *listedMounts + *listedAuths
+	}
+	b.ReportMetric(float64(lists)/float64(b.N), "mount-lists/op")
+}
+
+// Benchmark_multipleMonthsActivityClients_write compares writing the segments
+// of a large month with different numbers of workers
+func Benchmark_multipleMonthsActivityClients_write(b *testing.B) {
+	core, _, _ := TestCoreUnsealed(benchhelpers.TBtoT(b))
+	ctx := namespace.RootContext(nil)
+	opts := map[generation.WriteOptions]struct{}{generation.WriteOptions_WRITE_ENTITIES: {}}
+	m := generateLargeMonth(b, 200_000, 100)
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			m.setWorkers(workers)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := m.write(ctx, opts, core.activityLog)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+// Benchmark_multipleMonthsActivityClients_write_checkpointSize compares waiting
+// for the segments of a large month after each segment with waiting after
+// larger numbers of segments
+func Benchmark_multipleMonthsActivityClients_write_checkpointSize(b *testing.B) {
+	core, _, _ := TestCoreUnsealed(benchhelpers.TBtoT(b))
+	ctx := namespace.RootContext(nil)
+	opts := map[generation.WriteOptions]struct{}{generation.WriteOptions_WRITE_ENTITIES: {}}
+	m := generateLargeMonth(b, 200_000, 100)
+	m.setWorkers(16)
+	for _, checkpointSize := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("checkpoint_size=%d", checkpointSize), func(b *testing.B) {
+			m.checkpointSize = checkpointSize
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := m.write(ctx, opts, core.activityLog)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+// Test_parseActivityCSV verifies that CSV rows are parsed into months of
+// clients, and that invalid headers and rows are rejected. Every invalid row
+// must be reported
+func Test_parseActivityCSV(t *testing.T) {
+	months, err := parseActivityCSV(`months_ago,namespace,mount,client_type,count,repeated
+1,root,identity/,,3,
+0,,,non-entity-token,,true
+1,,,acme,2,false
+`)
+	require.NoError(t, err)
+	require.Len(t, months, 2)
+	require.Equal(t, int32(1), months[0].GetMonthsAgo())
+	require.Equal(t, []*generation.Client{
+		{Namespace: "root", Mount: "identity/", Count: proto.Int32(3)},
+		{ClientType: acmeActivityType, Count: proto.Int32(2)},
+	}, months[0].GetAll().GetClients())
+	require.Equal(t, int32(0), months[1].GetMonthsAgo())
+	require.Equal(t, []*generation.Client{
+		{ClientType: nonEntityTokenActivityType, Repeated: true},
+	}, months[1].GetAll().GetClients())
+
+	for name, header := range map[string]string{
+		"missing column":   "namespace,mount,client_type,count,months_ago",
+		"unknown column":   "namespace,mount,client_type,count,months_ago,repeated,other",
+		"duplicate column": "namespace,mount,client_type,count,months_ago,repeated,count",
+		"empty":            "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseActivityCSV(header)
+			require.Error(t, err)
+		})
+	}
+
+	_, err = parseActivityCSV(`namespace,mount,client_type,count,months_ago,repeated
+root,,,abc,0,
+root,,,1,-1,
+root,,,1,0,maybe
+root,,,1,0
+root,,,1,0,
+`)
+	require.Error(t, err)
+	errs, ok := err.(*multierror.Error)
+	require.True(t, ok)
+	require.Len(t, errs.Errors, 4)
+	require.ErrorContains(t, err, `row 2: invalid count "abc"`)
+	require.ErrorContains(t, err, `row 3: invalid months_ago "-1"`)
+	require.ErrorContains(t, err, `row 4: invalid repeated "maybe"`)
+	require.ErrorContains(t, err, "row 5:")
+}
+
+// TestSystemBackend_handleActivityWriteData_csv verifies that clients in the
+// input CSV are generated along with the clients in the JSON input, and that
+// a month can't be defined in both
+func TestSystemBackend_handleActivityWriteData_csv(t *testing.T) {
+	b := testSystemBackend(t)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{
+		"input": `{"write":["WRITE_ENTITIES"],"data":[{"months_ago":2,"all":{"clients":[{"count":4}]}}]}`,
+		"input_csv": `namespace,mount,client_type,count,months_ago,repeated
+,,,2,1,true
+,,acme,3,1,
+`,
+	}
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	require.NoError(t, err)
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Len(t, months, 2)
+	require.Equal(t, 1, months[0]["months_ago"])
+	require.Equal(t, 5, months[0]["num_clients"])
+	require.Equal(t, map[int]int{2: 2}, months[0]["repeated_clients"])
+
+	req.Data["input"] = `{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"all":{"clients":[{"count":4}]}}]}`
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	require.ErrorContains(t, resp.Error(), "Month 1 is in both")
+}
+
+// Test_singleMonthActivityClients_populateSegments_weights verifies that
+// clients are split over the segments in proportion to the segment weights,
+// and that invalid weights are rejected
+func Test_singleMonthActivityClients_populateSegments_weights(t *testing.T) {
+	tests := []struct {
+		name       string
+		numClients int32
+		parameters *generation.Data
+		want       map[int]int
+		wantError  bool
+	}{
+		{
+			name:       "proportional",
+			numClients: 10,
+			parameters: &generation.Data{NumSegments: 3, SegmentWeights: []float64{1, 2, 2}},
+			want:       map[int]int{0: 2, 1: 4, 2: 4},
+		},
+		{
+			name:       "left over clients go to the largest remainders",
+			numClients: 10,
+			parameters: &generation.Data{NumSegments: 3, SegmentWeights: []float64{1, 1, 1}},
+			want:       map[int]int{0: 4, 1: 3, 2: 3},
+		},
+		{
+			name:       "uneven remainders",
+			numClients: 7,
+			parameters: &generation.Data{NumSegments: 3, SegmentWeights: []float64{0.5, 0.3, 0.2}},
+			want:       map[int]int{0: 4, 1: 2, 2: 1},
+		},
+		{
+			name:       "skipped and empty segments",
+			numClients: 9,
+			parameters: &generation.Data{
+				NumSegments:         4,
+				SkipSegmentIndexes:  []int32{0},
+				EmptySegmentIndexes: []int32{2},
+				SegmentWeights:      []float64{0, 2, 0, 1},
+			},
+			want: map[int]int{1: 6, 2: 0, 3: 3},
+		},
+		{
+			name:       "zero weight segment",
+			numClients: 4,
+			parameters: &generation.Data{NumSegments: 3, SegmentWeights: []float64{1, 0, 1}},
+			want:       map[int]int{0: 2, 2: 2},
+		},
+		{
+			name:       "missing weights",
+			numClients: 4,
+			parameters: &generation.Data{NumSegments: 3, SegmentWeights: []float64{1, 1}},
+			wantError:  true,
+		},
+		{
+			name:       "negative weight",
+			numClients: 4,
+			parameters: &generation.Data{NumSegments: 2, SegmentWeights: []float64{1, -1}},
+			wantError:  true,
+		},
+		{
+			name:       "weight on a skipped segment",
+			numClients: 4,
+			parameters: &generation.Data{NumSegments: 2, SkipSegmentIndexes: []int32{1}, SegmentWeights: []float64{1, 1}},
+			wantError:  true,
+		},
+		{
+			name:       "all zero weights",
+			numClients: 4,
+			parameters: &generation.Data{NumSegments: 2, SegmentWeights: []float64{0, 0}},
+			wantError:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			month := &singleMonthActivityClients{
+				predefinedSegments:   make(map[int][]int),
+				generationParameters: tt.parameters,
+			}
+			require.NoError(t, month.addNewClients(context.Background(), &generation.Client{Count: proto.Int32(tt.numClients)}, "mount", nil))
+			segments, err := month.populateSegments()
+			if tt.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			got := make(map[int]int)
+			for i, segment := range segments {
+				if segment != nil {
+					got[i] = len(segment)
+				}
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_emptyMonth verifies that a month
+// without any clients is written as a single empty segment, so that the month
+// is in the activity log's available logs
+func TestSystemBackend_handleActivityWriteData_emptyMonth(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[
+			{"months_ago":1,"all":{"clients":[{"count":2}]}},
+			{"months_ago":2},
+			{"months_ago":3,"all":{"clients":[{"count":2}]}}
+		]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Len(t, months, 3)
+	require.Equal(t, 0, months[1]["num_clients"])
+	require.Equal(t, map[int]int{0: 0}, months[1]["segments"])
+
+	twoMonthsAgo := timeutil.StartOfMonth(timeutil.MonthsPreviousTo(2, time.Now().UTC()))
+	path := fmt.Sprintf("%s%d/0", activityEntityBasePath, twoMonthsAgo.Unix())
+	require.Contains(t, resp.Data["paths"], path)
+	entry, err := a.view.Get(ctx, path)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	segment := &activity.EntityActivityLog{}
+	require.NoError(t, proto.Unmarshal(entry.Value, segment))
+	require.Empty(t, segment.Clients)
+
+	times, err := a.availableLogs(ctx)
+	require.NoError(t, err)
+	require.Len(t, times, 3)
+	require.Equal(t, twoMonthsAgo, times[1])
+}
+
+// TestSystemBackend_handleActivityWriteData_monthPaths verifies that each
+// month in the response lists the storage keys of its segments, and that the
+// segments can be read back from storage with those keys
+func TestSystemBackend_handleActivityWriteData_monthPaths(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[
+			{"months_ago":1,"num_segments":2,"all":{"clients":[{"count":3}]}},
+			{"months_ago":2,"num_segments":3,"skip_segment_indexes":[1],"all":{"clients":[{"count":4}]}}
+		]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Len(t, months, 2)
+
+	now := time.Now().UTC()
+	oneMonthAgo := timeutil.StartOfMonth(timeutil.MonthsPreviousTo(1, now)).Unix()
+	twoMonthsAgo := timeutil.StartOfMonth(timeutil.MonthsPreviousTo(2, now)).Unix()
+	require.Equal(t, []string{
+		fmt.Sprintf("%s%d/0", activityEntityBasePath, oneMonthAgo),
+		fmt.Sprintf("%s%d/1", activityEntityBasePath, oneMonthAgo),
+	}, months[0]["paths"])
+	require.Equal(t, []string{
+		fmt.Sprintf("%s%d/0", activityEntityBasePath, twoMonthsAgo),
+		fmt.Sprintf("%s%d/2", activityEntityBasePath, twoMonthsAgo),
+	}, months[1]["paths"])
+
+	for _, month := range months {
+		monthSegments := month["segments"].(map[int]int)
+		for _, path := range month["paths"].([]string) {
+			segmentNum, ok := parseSegmentNumberFromPath(path)
+			require.True(t, ok)
+			entry, err := a.view.Get(ctx, path)
+			require.NoError(t, err)
+			require.NotNil(t, entry)
+			segment := &activity.EntityActivityLog{}
+			require.NoError(t, proto.Unmarshal(entry.Value, segment))
+			require.Len(t, segment.Clients, monthSegments[segmentNum])
+		}
+	}
+}
+
+// Test_multipleMonthsActivityClients_metadata verifies that a client's
+// metadata is kept with its generated records, and that repeated clients keep
+// the metadata of the month they're repeated from
+func Test_multipleMonthsActivityClients_metadata(t *testing.T) {
+	ctx := context.Background()
+	m := newMultipleMonthsActivityClients(3)
+	want := map[string]string{"team": "engineering", "env": "dev"}
+	require.NoError(t, m.addClientToMonth(ctx, 2, &generation.Client{Count: proto.Int32(2), Metadata: want}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(ctx, 2, &generation.Client{Count: proto.Int32(1)}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(ctx, 1, &generation.Client{Count: proto.Int32(2), Repeated: true, Metadata: map[string]string{"team": "other"}}, "mount", nil))
+
+	for _, monthsAgo := range []int{1, 2} {
+		withMetadata := 0
+		for _, client := range m.months[monthsAgo].clients {
+			if client.metadata != nil {
+				require.Equal(t, want, client.metadata)
+				withMetadata++
+			}
+		}
+		require.Equal(t, 2, withMetadata, "month %d", monthsAgo)
+	}
+}
+
+// Test_singleMonthActivityClients_addNewClients_metadata verifies that
+// metadata keys and values are validated
+func Test_singleMonthActivityClients_addNewClients_metadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  map[string]string
+		wantError string
+	}{
+		{
+			name:     "no metadata",
+			metadata: nil,
+		},
+		{
+			name:     "max sizes",
+			metadata: map[string]string{strings.Repeat("k", maxMetadataKeyLength): strings.Repeat("v", maxMetadataValueLength)},
+		},
+		{
+			name:      "empty key",
+			metadata:  map[string]string{"": "value"},
+			wantError: "metadata keys can't be empty",
+		},
+		{
+			name:      "key too long",
+			metadata:  map[string]string{strings.Repeat("k", maxMetadataKeyLength+1): "value"},
+			wantError: "is longer than 128 bytes",
+		},
+		{
+			name:      "value too long",
+			metadata:  map[string]string{"key": strings.Repeat("v", maxMetadataValueLength+1)},
+			wantError: "is longer than 512 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &singleMonthActivityClients{}
+			err := m.addNewClients(context.Background(), &generation.Client{Count: proto.Int32(2), Metadata: tt.metadata}, "mount", nil)
+			if tt.wantError != "" {
+				require.ErrorContains(t, err, tt.wantError)
+				require.Empty(t, m.clients)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, m.clients, 2)
+			for _, client := range m.clients {
+				require.Equal(t, tt.metadata, client.metadata)
+			}
+		})
+	}
+}
+
+// Test_singleMonthActivityClients_populateSegments_emptySegments verifies that
+// the usable segments without clients are counted, and that strict segments
+// reject more usable segments than clients
+func Test_singleMonthActivityClients_populateSegments_emptySegments(t *testing.T) {
+	cases := []struct {
+		name        string
+		numClients  int
+		params      *generation.Data
+		wantEmpty   int
+		wantError   string
+		wantNumSegs int
+	}{
+		{
+			name:        "enough clients",
+			numClients:  6,
+			params:      &generation.Data{NumSegments: 3},
+			wantNumSegs: 3,
+		},
+		{
+			name:        "more segments than clients",
+			numClients:  2,
+			params:      &generation.Data{NumSegments: 5},
+			wantEmpty:   3,
+			wantNumSegs: 2,
+		},
+		{
+			name:        "ignored indexes aren't counted",
+			numClients:  2,
+			params:      &generation.Data{NumSegments: 5, SkipSegmentIndexes: []int32{0}, EmptySegmentIndexes: []int32{1}},
+			wantEmpty:   1,
+			wantNumSegs: 4,
+		},
+		{
+			name:        "weighted",
+			numClients:  2,
+			params:      &generation.Data{NumSegments: 3, SegmentWeights: []float64{1, 0, 1}},
+			wantEmpty:   1,
+			wantNumSegs: 2,
+		},
+		{
+			name:       "strict",
+			numClients: 2,
+			params:     &generation.Data{NumSegments: 5, StrictSegments: true},
+			wantError:  "5 usable segments is more than the 2 clients",
+		},
+		{
+			name:        "strict with enough clients",
+			numClients:  3,
+			params:      &generation.Data{NumSegments: 5, SkipSegmentIndexes: []int32{1, 3}, StrictSegments: true},
+			wantNumSegs: 5,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &singleMonthActivityClients{generationParameters: tc.params}
+			require.NoError(t, s.addNewClients(context.Background(), &generation.Client{Count: proto.Int32(int32(tc.numClients))}, "mount", nil))
+			segments, err := s.populateSegments()
+			if tc.wantError != "" {
+				require.ErrorContains(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, segments, tc.wantNumSegs)
+			require.Equal(t, tc.wantEmpty, s.emptySegments)
+		})
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_emptySegments verifies that the
+// write endpoint's response counts the segments without clients and warns
+// about them, and that strict segments fail the request
+func TestSystemBackend_handleActivityWriteData_emptySegments(t *testing.T) {
+	b := testSystemBackend(t)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[
+			{"months_ago":1,"num_segments":2,"all":{"clients":[{"count":2}]}},
+			{"months_ago":2,"num_segments":4,"all":{"clients":[{"count":1}]}}
+		]}`}
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	require.NoError(t, err)
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Len(t, months, 2)
+	require.Equal(t, 0, months[0]["empty_segments"])
+	require.Equal(t, 3, months[1]["empty_segments"])
+	require.Equal(t, []string{"month 2 has 3 segments without any clients, as there are 1 clients"}, resp.Warnings)
+
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[{"months_ago":1,"num_segments":4,"strict_segments":true,"all":{"clients":[{"count":1}]}}]}`}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	require.Error(t, err)
+	require.True(t, resp.IsError())
+}
+
+// Test_checkClientLimits verifies that the total and per month client limits
+// are enforced, and that clients repeated by percentage aren't counted
+func Test_checkClientLimits(t *testing.T) {
+	months := []*generation.Data{
+		{
+			Month:   &generation.Data_MonthsAgo{MonthsAgo: 2},
+			Clients: &generation.Data_All{All: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(4)}, {}}}},
+		},
+		{
+			Month: &generation.Data_MonthsAgo{MonthsAgo: 1},
+			Clients: &generation.Data_Segments{Segments: &generation.Segments{Segments: []*generation.Segment{
+				{Clients: &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(3)}}}},
+				{Clients: &generation.Clients{Clients: []*generation.Client{{RepeatedPercent: 100, RepeatedFromMonth: 2}}}},
+			}}},
+		},
+	}
+	require.NoError(t, checkClientLimits(months, 8, 5))
+	require.ErrorContains(t, checkClientLimits(months, 7, 5), "8 clients requested, which is more than the limit of 7 clients")
+	require.ErrorContains(t, checkClientLimits(months, 8, 4), "month 2 has 5 clients, which is more than the limit of 4 clients per month")
+
+	// months with the same months ago are counted together
+	sameMonth := []*generation.Data{months[0], proto.Clone(months[0]).(*generation.Data)}
+	require.ErrorContains(t, checkClientLimits(sameMonth, 10, 9), "month 2 has 10 clients")
+}
+
+// TestSystemBackend_handleActivityWriteData_clientLimits verifies that the
+// write endpoint rejects inputs over the client limits, before generating any
+// clients
+func TestSystemBackend_handleActivityWriteData_clientLimits(t *testing.T) {
+	defaultMaxClients, defaultMaxMonthClients := maxGeneratedClients, maxGeneratedMonthClients
+	maxGeneratedClients, maxGeneratedMonthClients = 10, 6
+	t.Cleanup(func() {
+		maxGeneratedClients, maxGeneratedMonthClients = defaultMaxClients, defaultMaxMonthClients
+	})
+
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	write := func(input string) (*logical.Response, error) {
+		t.Helper()
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": input, "dry_run": true}
+		return core.systemBackend.HandleRequest(ctx, req)
+	}
+
+	resp, err := write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"all":{"clients":[{"count":5}]}},{"months_ago":2,"all":{"clients":[{"count":5}]}}]}`)
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"all":{"clients":[{"count":7}]}}]}`)
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.Contains(t, resp.Error().Error(), "more than the limit of 6 clients per month")
+
+	resp, err = write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"all":{"clients":[{"count":6}]}},{"months_ago":2,"all":{"clients":[{"count":5}]}}]}`)
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.Contains(t, resp.Error().Error(), "more than the limit of 10 clients")
+}
+
+// Test_multipleMonthsActivityClients_distributeNamespaces verifies that clients
+// without a namespace are spread across the given namespaces, round robin or
+// randomly, and that random distribution is repeatable with a seed
+func Test_multipleMonthsActivityClients_distributeNamespaces(t *testing.T) {
+	namespaces := []string{"ns1", "ns2", "ns3"}
+	counts := func(clients []*generation.Client) map[string]int32 {
+		t.Helper()
+		got := make(map[string]int32)
+		for _, c := range clients {
+			got[c.Namespace] += c.GetCount()
+		}
+		return got
+	}
+
+	t.Run("round robin", func(t *testing.T) {
+		m := newMultipleMonthsActivityClients(1)
+		clients, err := m.distributeNamespaces(&generation.Clients{
+			Namespaces: namespaces,
+			Clients: []*generation.Client{
+				{Count: proto.Int32(4), ClientType: acmeActivityType},
+				{Count: proto.Int32(3), Namespace: "other"},
+				{},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]int32{"ns1": 2, "ns2": 2, "ns3": 1, "other": 3}, counts(clients))
+		require.Equal(t, acmeActivityType, clients[0].ClientType)
+		require.Equal(t, "ns2", clients[4].Namespace)
+		require.Equal(t, int32(1), clients[4].GetCount())
+	})
+
+	t.Run("random", func(t *testing.T) {
+		distribute := func(seed int64) []*generation.Client {
+			t.Helper()
+			m := newMultipleMonthsActivityClients(1)
+			m.setSeed(seed)
+			clients, err := m.distributeNamespaces(&generation.Clients{
+				Namespaces:            namespaces,
+				NamespaceDistribution: generation.NamespaceDistribution_NAMESPACE_DISTRIBUTION_RANDOM,
+				Clients:               []*generation.Client{{Count: proto.Int32(100)}},
+			})
+			require.NoError(t, err)
+			return clients
+		}
+		clients := distribute(1)
+		got := counts(clients)
+		require.Len(t, got, 3)
+		require.Equal(t, int32(100), got["ns1"]+got["ns2"]+got["ns3"])
+		require.Equal(t, clients, distribute(1))
+	})
+
+	t.Run("no namespaces", func(t *testing.T) {
+		all := &generation.Clients{Clients: []*generation.Client{{Count: proto.Int32(2)}}}
+		clients, err := newMultipleMonthsActivityClients(1).distributeNamespaces(all)
+		require.NoError(t, err)
+		require.Equal(t, all.Clients, clients)
+	})
+}
+
+// Test_multipleMonthsActivityClients_processMonth_namespaces verifies that the
+// listed namespaces are validated, and that they can only be given for all of
+// a month's clients
+func Test_multipleMonthsActivityClients_processMonth_namespaces(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	month := &generation.Data{
+		Clients: &generation.Data_All{All: &generation.Clients{
+			Namespaces: []string{namespace.RootNamespaceID},
+			Clients:    []*generation.Client{{Count: proto.Int32(3)}},
+		}},
+	}
+	require.NoError(t, validateReferences(ctx, core, []*generation.Data{month}))
+	m := newMultipleMonthsActivityClients(1)
+	require.NoError(t, m.processMonth(ctx, core, month))
+	require.Len(t, m.months[0].clients, 3)
+
+	month.GetAll().Namespaces = append(month.GetAll().Namespaces, "missing")
+	err := validateReferences(ctx, core, []*generation.Data{month})
+	require.ErrorContains(t, err, "month 0: namespace missing does not exist")
+
+	segmented := &generation.Data{
+		Clients: &generation.Data_Segments{Segments: &generation.Segments{Segments: []*generation.Segment{
+			{Clients: &generation.Clients{Namespaces: []string{namespace.RootNamespaceID}, Clients: []*generation.Client{{}}}},
+		}}},
+	}
+	err = newMultipleMonthsActivityClients(1).processMonth(ctx, core, segmented)
+	require.ErrorContains(t, err, "namespaces can only be given for all of a month's clients")
+}
+
+// TestSystemBackend_handleActivityWriteData_stableSegments writes the same
+// seeded input twice, with predefined segments, skipped and empty indexes, and
+// repeated clients, and verifies that the serialized segments are identical
+func TestSystemBackend_handleActivityWriteData_stableSegments(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+	input := `{
+		"write":["WRITE_ENTITIES"],
+		"seed":7,
+		"workers":4,
+		"data":[
+			{"months_ago":1,"empty_segment_indexes":[1],"segments":{"segments":[
+				{"segment_index":4,"clients":{"clients":[{"count":3,"repeated":true},{"count":2,"metadata":{"a":"1","b":"2","c":"3"}}]}},
+				{"segment_index":0,"clients":{"clients":[{"count":5}]}},
+				{"segment_index":2,"clients":{"clients":[{"count":2,"non_entity":true}]}}
+			]}},
+			{"months_ago":2,"num_segments":6,"skip_segment_indexes":[3],"all":{"clients":[{"count":20},{"count":4,"client_type":"acme"}]}}
+		]}`
+
+	write := func() map[string][]byte {
+		t.Helper()
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": input}
+		resp, err := core.systemBackend.HandleRequest(ctx, req)
+		require.NoError(t, err)
+		segments := make(map[string][]byte)
+		for _, path := range resp.Data["paths"].([]string) {
+			entry, err := a.view.Get(ctx, path)
+			require.NoError(t, err)
+			require.NotNil(t, entry)
+			segment := &activity.EntityActivityLog{}
+			require.NoError(t, proto.Unmarshal(entry.Value, segment))
+			serialized, err := proto.MarshalOptions{Deterministic: true}.Marshal(segment)
+			require.NoError(t, err)
+			segments[path] = serialized
+		}
+		return segments
+	}
+
+	first := write()
+	require.Len(t, first, 9)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, first, write())
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_predefinedAndEmptySegments
+// verifies that a month with predefined segments writes its empty segment
+// indexes as segments without clients in between the predefined ones, and
+// doesn't write its skipped indexes
+func TestSystemBackend_handleActivityWriteData_predefinedAndEmptySegments(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":1,"empty_segment_indexes":[1,4],"skip_segment_indexes":[2,5],"segments":{"segments":[
+			{"segment_index":3,"clients":{"clients":[{"count":2}]}},
+			{"segment_index":0,"clients":{"clients":[{"count":3}]}},
+			{"segment_index":6,"clients":{"clients":[{"count":1,"non_entity":true}]}}
+		]}}
+	]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+
+	monthPath := fmt.Sprintf("%s%d/", activityEntityBasePath, monthTimestamp(1, timeutil.StartOfMonth(a.clock.Now().UTC())).Unix())
+	wantClients := map[int]int{0: 3, 1: 0, 3: 2, 4: 0, 6: 1}
+	paths := make([]string, 0, len(wantClients))
+	for _, i := range []int{0, 1, 3, 4, 6} {
+		paths = append(paths, fmt.Sprintf("%s%d", monthPath, i))
+	}
+	require.Equal(t, paths, resp.Data["paths"])
+
+	for i, want := range wantClients {
+		entry, err := a.view.Get(ctx, fmt.Sprintf("%s%d", monthPath, i))
+		require.NoError(t, err)
+		require.NotNil(t, entry, "segment %d", i)
+		segment := &activity.EntityActivityLog{}
+		require.NoError(t, proto.Unmarshal(entry.Value, segment))
+		require.Len(t, segment.Clients, want, "segment %d", i)
+	}
+	for _, i := range []int{2, 5} {
+		entry, err := a.view.Get(ctx, fmt.Sprintf("%s%d", monthPath, i))
+		require.NoError(t, err)
+		require.Nil(t, entry, "skipped segment %d", i)
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_referenceTime verifies that with a
+// reference time, the months are relative to the reference time's month, and
+// that an invalid reference time is rejected
+func TestSystemBackend_handleActivityWriteData_referenceTime(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	write := func(referenceTime string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": fmt.Sprintf(`{"write":["WRITE_ENTITIES"],"reference_time":%q,"data":[
+			{"months_ago":0,"all":{"clients":[{"count":1}]}},
+			{"months_ago":2,"all":{"clients":[{"count":1}]}}
+		]}`, referenceTime)}
+		return core.systemBackend.HandleRequest(ctx, req)
+	}
+
+	march := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, referenceTime := range []string{"2023-05-15T10:00:00Z", "2023-05-31T20:00:00-03:00", fmt.Sprint(may.Add(time.Hour).Unix())} {
+		resp, err := write(referenceTime)
+		require.NoError(t, err, referenceTime)
+		require.Equal(t, []string{
+			fmt.Sprintf("%s%d/0", activityEntityBasePath, may.Unix()),
+			fmt.Sprintf("%s%d/0", activityEntityBasePath, march.Unix()),
+		}, resp.Data["paths"], referenceTime)
+		months := resp.Data["months"].([]map[string]interface{})
+		require.Equal(t, may, months[0]["start"])
+		require.Equal(t, march, months[1]["start"])
+	}
+
+	for _, referenceTime := range []string{"last tuesday", "0", "1969-12-31T00:00:00Z"} {
+		resp, err := write(referenceTime)
+		require.Equal(t, logical.ErrInvalidRequest, err, referenceTime)
+		require.ErrorContains(t, resp.Error(), fmt.Sprintf("invalid \"reference_time\" %q", referenceTime))
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_structuredSummary verifies that
+// with a structured summary, the response has a summary that unmarshals into
+// generation.WriteSummary from its JSON, with the months' client counts by
+// type, segment layouts, generated IDs and written paths
+func TestSystemBackend_handleActivityWriteData_structuredSummary(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{
+		"structured_summary": true,
+		"input": `{"write":["WRITE_ENTITIES"],"data":[
+			{"months_ago":2,"num_segments":3,"skip_segment_indexes":[1],"all":{"clients":[{"count":3},{"count":2,"client_type":"acme"}]}},
+			{"months_ago":1,"all":{"clients":[{"id":"client","non_entity":true},{"count":2,"repeated":true}]}}
+		]}`,
+	}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+
+	serialized, err := json.Marshal(resp.Data["summary"])
+	require.NoError(t, err)
+	summary := &generation.WriteSummary{}
+	require.NoError(t, json.Unmarshal(serialized, summary))
+	require.Equal(t, resp.Data["paths"], summary.Paths)
+	require.Equal(t, resp.Data["storage_prefix"], summary.StoragePrefix)
+	require.Len(t, summary.Months, 2)
+
+	month1, month2 := summary.Months[0], summary.Months[1]
+	require.Equal(t, 1, month1.MonthsAgo)
+	require.Equal(t, 3, month1.NumClients)
+	require.Equal(t, map[string]int{entityActivityType: 2, nonEntityTokenActivityType: 1}, month1.ClientsByType)
+	require.Empty(t, month1.GeneratedClientIDs)
+	require.Equal(t, map[int]int{2: 2}, month1.RepeatedClients)
+	require.Equal(t, []generation.SegmentSummary{{Index: 0, NumClients: 3}}, month1.Segments)
+	require.Len(t, month1.Paths, 1)
+
+	require.Equal(t, 2, month2.MonthsAgo)
+	require.True(t, month2.Start.Before(month1.Start))
+	require.Equal(t, map[string]int{entityActivityType: 3, acmeActivityType: 2}, month2.ClientsByType)
+	require.Len(t, month2.GeneratedClientIDs, 5)
+	require.Equal(t, []generation.SegmentSummary{{Index: 0, NumClients: 3}, {Index: 2, NumClients: 2}}, month2.Segments)
+	require.Len(t, month2.Paths, 2)
+}
+
+// TestSystemBackend_handleActivityWriteData_sharedClientIDs verifies that with
+// shared client IDs, clients of different types with the same id are both
+// written, and that repeating one of them doesn't repeat the other. Without
+// it, or for clients of the same type, the id can only be used once
+func TestSystemBackend_handleActivityWriteData_sharedClientIDs(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+	write := func(input string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": input}
+		return core.systemBackend.HandleRequest(ctx, req)
+	}
+
+	resp, err := write(`{"write":["WRITE_ENTITIES"],"data":[
+		{"months_ago":2,"shared_client_ids":true,"all":{"clients":[{"id":"shared"},{"id":"shared","client_type":"acme"}]}},
+		{"months_ago":1,"all":{"clients":[{"repeated":true,"client_type":"acme"}]}}
+	]}`)
+	require.NoError(t, err)
+	readClients := func(monthsAgo int) []*activity.EntityRecord {
+		t.Helper()
+		for _, path := range resp.Data["paths"].([]string) {
+			if strings.HasPrefix(path, fmt.Sprintf("%s%d/", activityEntityBasePath, monthTimestamp(monthsAgo, timeutil.StartOfMonth(a.clock.Now().UTC())).Unix())) {
+				entry, err := a.view.Get(ctx, path)
+				require.NoError(t, err)
+				segment := &activity.EntityActivityLog{}
+				require.NoError(t, proto.Unmarshal(entry.Value, segment))
+				return segment.Clients
+			}
+		}
+		t.Fatalf("no segment for month %d", monthsAgo)
+		return nil
+	}
+	month2 := readClients(2)
+	require.Len(t, month2, 2)
+	require.Equal(t, "shared", month2[0].ClientID)
+	require.Equal(t, entityActivityType, month2[0].ClientType)
+	require.Equal(t, "shared", month2[1].ClientID)
+	require.Equal(t, acmeActivityType, month2[1].ClientType)
+	month1 := readClients(1)
+	require.Len(t, month1, 1)
+	require.Equal(t, "shared", month1[0].ClientID)
+	require.Equal(t, acmeActivityType, month1[0].ClientType)
+
+	resp, err = write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"all":{"clients":[{"id":"shared"},{"id":"shared","client_type":"acme"}]}}]}`)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	require.ErrorContains(t, resp.Error(), "month 1: client id shared is used by more than one client, set \"shared_client_ids\"")
+
+	resp, err = write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"shared_client_ids":true,"all":{"clients":[{"id":"shared"},{"id":"shared","non_entity":true},{"id":"shared","client_type":"non-entity-token"}]}}]}`)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	require.ErrorContains(t, resp.Error(), "month 1: client id shared is used by more than one client of type non-entity-token")
+}
+
+// TestSystemBackend_handleActivityWriteData_overwrite verifies that writing
+// again adds to a month's segments by default, and that with overwrite the
+// month's existing segments are removed first, with the response saying how
+// many entries were removed
+func TestSystemBackend_handleActivityWriteData_overwrite(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	a := core.activityLog
+	ctx := namespace.RootContext(nil)
+
+	write := func(input string) *logical.Response {
+		t.Helper()
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": input}
+		resp, err := core.systemBackend.HandleRequest(ctx, req)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		return resp
+	}
+	monthKeys := func() []string {
+		t.Helper()
+		base := fmt.Sprintf("%s%d/", activityEntityBasePath, monthTimestamp(1, timeutil.StartOfMonth(a.clock.Now().UTC())).Unix())
+		keys, err := a.view.List(ctx, base)
+		require.NoError(t, err)
+		return keys
+	}
+
+	resp := write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"num_segments":3,"all":{"clients":[{"count":7}]}}]}`)
+	require.Equal(t, false, resp.Data["cleared"])
+	require.Equal(t, 0, resp.Data["cleared_entries"])
+	require.Len(t, monthKeys(), 3)
+
+	resp = write(`{"write":["WRITE_ENTITIES"],"data":[{"months_ago":1,"num_segments":2,"all":{"clients":[{"count":6}]}}]}`)
+	require.Equal(t, false, resp.Data["cleared"])
+	require.Len(t, monthKeys(), 3)
+
+	resp = write(`{"write":["WRITE_ENTITIES"],"overwrite":true,"data":[{"months_ago":1,"num_segments":2,"all":{"clients":[{"count":6}]}}]}`)
+	require.Equal(t, true, resp.Data["cleared"])
+	require.Equal(t, 3, resp.Data["cleared_entries"])
+	require.Equal(t, []string{"0", "1"}, monthKeys())
+
+	resp = write(`{"write":["WRITE_ENTITIES"],"overwrite":true,"data":[{"months_ago":1,"num_segments":2,"all":{"clients":[{"count":6}]}}]}`)
+	require.Equal(t, 2, resp.Data["cleared_entries"])
+	require.Equal(t, []string{"0", "1"}, monthKeys())
+}
+
+// Test_singleMonthActivityClients_populateSegments_byteSize verifies that
+// splitting the clients by segment byte size keeps every segment under the
+// target size, fills each segment before starting the next one, and doesn't
+// use skipped or empty indexes
+func Test_singleMonthActivityClients_populateSegments_byteSize(t *testing.T) {
+	s := &singleMonthActivityClients{}
+	require.NoError(t, s.addNewClients(context.Background(), &generation.Client{Count: proto.Int32(50)}, "mount", nil))
+	require.NoError(t, s.addNewClients(context.Background(), &generation.Client{Count: proto.Int32(25), NonEntity: true, Metadata: map[string]string{"team": "engineering"}}, "mount", nil))
+
+	maxBytes := 1024
+	s.generationParameters = &generation.Data{SegmentByteSize: int32(maxBytes), SkipSegmentIndexes: []int32{1}, EmptySegmentIndexes: []int32{3}}
+	segments, err := s.populateSegments()
+	require.NoError(t, err)
+	require.Nil(t, segments[1])
+	require.NotNil(t, segments[3])
+	require.Empty(t, segments[3])
+
+	indexes := sortedSegmentIndexes(segments)
+	var got []*activity.EntityRecord
+	var used []int
+	for _, i := range indexes {
+		if len(segments[i]) == 0 {
+			continue
+		}
+		used = append(used, i)
+		size := proto.Size(&activity.EntityActivityLog{Clients: segments[i]})
+		require.LessOrEqual(t, size, maxBytes, "segment %d", i)
+		got = append(got, segments[i]...)
+	}
+	require.Greater(t, len(used), 2)
+	require.Equal(t, []int{0, 2, 4}, used[:3])
+	require.Len(t, got, len(s.clients))
+	for i, client := range s.clients {
+		require.Same(t, client.EntityRecord, got[i])
+	}
+
+	// every full segment would go over the target size with the next client
+	for j := 0; j < len(used)-1; j++ {
+		next := segments[used[j+1]][0]
+		withNext := append(append([]*activity.EntityRecord{}, segments[used[j]]...), next)
+		require.Greater(t, proto.Size(&activity.EntityActivityLog{Clients: withNext}), maxBytes)
+	}
+
+	s.generationParameters = &generation.Data{SegmentByteSize: 10}
+	_, err = s.populateSegments()
+	require.ErrorContains(t, err, "which is more than the segment byte size 10")
+
+	s.generationParameters = &generation.Data{SegmentByteSize: 1024, NumSegments: 2}
+	_, err = s.populateSegments()
+	require.ErrorContains(t, err, "can't be used with num segments")
+}
+
+// Test_singleMonthActivityClients_populateSegments_capacities verifies that
+// with segment capacities, the clients fill the segments in index order up to
+// their capacities, around the skipped and empty segments, and that the
+// capacities must have room for all clients
+func Test_singleMonthActivityClients_populateSegments_capacities(t *testing.T) {
+	s := &singleMonthActivityClients{}
+	require.NoError(t, s.addNewClients(context.Background(), &generation.Client{Count: proto.Int32(10)}, "mount", nil))
+
+	s.generationParameters = &generation.Data{
+		SegmentCapacities:   map[int32]int32{4: 5, 0: 3, 2: 4, 5: 2},
+		SkipSegmentIndexes:  []int32{1},
+		EmptySegmentIndexes: []int32{3},
+	}
+	segments, err := s.populateSegments()
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2, 3, 4}, sortedSegmentIndexes(segments))
+	require.Nil(t, segments[1])
+	require.NotNil(t, segments[3])
+	require.Empty(t, segments[3])
+	require.Len(t, segments[0], 3)
+	require.Len(t, segments[2], 4)
+	require.Len(t, segments[4], 3)
+	require.Equal(t, 1, s.emptySegments)
+
+	var got []*activity.EntityRecord
+	for _, i := range []int{0, 2, 4} {
+		got = append(got, segments[i]...)
+	}
+	for i, client := range s.clients {
+		require.Same(t, client.EntityRecord, got[i])
+	}
+
+	s.generationParameters = &generation.Data{SegmentCapacities: map[int32]int32{4: 5, 0: 3, 2: 4, 5: 2}, StrictSegments: true}
+	_, err = s.populateSegments()
+	require.ErrorContains(t, err, "1 segments with a capacity don't get any of the 10 clients")
+
+	s.generationParameters = &generation.Data{SegmentCapacities: map[int32]int32{0: 6, 1: 3}}
+	_, err = s.populateSegments()
+	require.EqualError(t, err, "segment capacities add up to 9 clients, which is less than the 10 clients")
+
+	s.generationParameters = &generation.Data{SegmentCapacities: map[int32]int32{0: 10, 3: 5}, EmptySegmentIndexes: []int32{3}}
+	_, err = s.populateSegments()
+	require.EqualError(t, err, "skipped or empty segment 3 can't have a capacity")
+
+	s.generationParameters = &generation.Data{SegmentCapacities: map[int32]int32{0: 10}, NumSegments: 2}
+	_, err = s.populateSegments()
+	require.ErrorContains(t, err, "can't be used with num segments")
+}
+
+// Test_singleMonthActivityClients_populateSegments_conflicts verifies that a
+// predefined segment can't use a skipped or empty segment index, and that the
+// error names the colliding index
+func Test_singleMonthActivityClients_populateSegments_conflicts(t *testing.T) {
+	cases := []struct {
+		name         string
+		skipIndexes  []int32
+		emptyIndexes []int32
+		wantIndex    int
+		wantConflict string
+	}{
+		{
+			name:         "skipped",
+			skipIndexes:  []int32{2},
+			wantIndex:    2,
+			wantConflict: "skipped",
+		},
+		{
+			name:         "empty",
+			emptyIndexes: []int32{0},
+			wantIndex:    0,
+			wantConflict: "empty",
+		},
+		{
+			name:         "skipped and empty, lowest index reported",
+			skipIndexes:  []int32{5},
+			emptyIndexes: []int32{2},
+			wantIndex:    2,
+			wantConflict: "empty",
+		},
+		{
+			name:         "skipped and empty at the same index",
+			skipIndexes:  []int32{5},
+			emptyIndexes: []int32{5},
+			wantIndex:    5,
+			wantConflict: "skipped",
+		},
+		{
+			name:         "no conflict",
+			skipIndexes:  []int32{1},
+			emptyIndexes: []int32{3},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newMultipleMonthsActivityClients(1)
+			for _, index := range []int{0, 2, 5} {
+				segmentIndex := index
+				require.NoError(t, m.addClientToMonth(context.Background(), 0, &generation.Client{}, "mount", &segmentIndex))
+			}
+			s := m.months[0]
+			s.generationParameters = &generation.Data{SkipSegmentIndexes: tc.skipIndexes, EmptySegmentIndexes: tc.emptyIndexes}
+			segments, err := s.populateSegments()
+			if tc.wantConflict == "" {
+				require.NoError(t, err)
+				require.Len(t, segments, 5)
+				return
+			}
+			var conflictErr *segmentIndexConflictError
+			require.ErrorAs(t, err, &conflictErr)
+			require.Equal(t, tc.wantIndex, conflictErr.Index)
+			require.Equal(t, tc.wantConflict, conflictErr.Conflict)
+			require.EqualError(t, err, fmt.Sprintf("segment index %d is used by a predefined segment and is also %s", tc.wantIndex, tc.wantConflict))
+		})
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_storagePrefix verifies that data
+// written with a storage prefix can be read back by an activity log for the
+// prefix, and isn't seen by the core's activity log or by other prefixes
+func TestSystemBackend_handleActivityWriteData_storagePrefix(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	write := func(prefix string, numMonths int) *logical.Response {
+		t.Helper()
+		data := make([]string, 0, numMonths)
+		for i := 1; i <= numMonths; i++ {
+			data = append(data, fmt.Sprintf(`{"months_ago":%d,"all":{"clients":[{"count":%d}]}}`, i, i))
+		}
+		req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+		req.Data = map[string]interface{}{"input": fmt.Sprintf(`{"write":["WRITE_ENTITIES","WRITE_PRECOMPUTED_QUERIES"],"storage_prefix":%q,"data":[%s]}`, prefix, strings.Join(data, ","))}
+		resp, err := core.systemBackend.HandleRequest(ctx, req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := write("dataset-a", 2)
+	require.Equal(t, activityTestDataSubPath+"dataset-a/", resp.Data["storage_prefix"])
+	write("dataset-b/", 3)
+
+	reader := func(prefix string) *ActivityLog {
+		t.Helper()
+		a, err := NewActivityLog(core, core.baseLogger, core.systemBarrierView.SubView(activityTestDataSubPath+prefix), core.metricSink)
+		require.NoError(t, err)
+		return a
+	}
+	datasetA := reader("dataset-a/")
+	times, err := datasetA.availableLogs(ctx)
+	require.NoError(t, err)
+	require.Len(t, times, 2)
+	for _, path := range resp.Data["paths"].([]string) {
+		entry, err := datasetA.view.Get(ctx, path)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+	}
+	queries, err := datasetA.queryStore.QueriesAvailable(ctx)
+	require.NoError(t, err)
+	require.True(t, queries)
+
+	times, err = reader("dataset-b/").availableLogs(ctx)
+	require.NoError(t, err)
+	require.Len(t, times, 3)
+
+	times, err = core.activityLog.availableLogs(ctx)
+	require.NoError(t, err)
+	require.Empty(t, times)
+}
+
+// Test_checkStoragePrefix verifies that storage prefixes must be relative
+// paths without empty, "." or ".." elements
+func Test_checkStoragePrefix(t *testing.T) {
+	for _, prefix := range []string{"dataset", "dataset/", "tests/dataset-1/"} {
+		require.NoError(t, checkStoragePrefix(prefix), prefix)
+	}
+	for _, prefix := range []string{"/dataset", "a//b", "../dataset", "a/./b", "a/../../b", "/"} {
+		require.Error(t, checkStoragePrefix(prefix), prefix)
+	}
+}
+
+// TestSystemBackend_handleActivityWriteData_monthBoundaries verifies that each
+// month in the response has its UTC start and end time, relative to the
+// activity log's clock
+func TestSystemBackend_handleActivityWriteData_monthBoundaries(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+			Clock:         newMockTimeNowClock(time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)),
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[
+			{"months_ago":0,"all":{"clients":[{"count":1}]}},
+			{"months_ago":1,"all":{"clients":[{"count":1}]}},
+			{"months_ago":3,"all":{"clients":[{"count":1}]}}
+		]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	months := resp.Data["months"].([]map[string]interface{})
+	require.Len(t, months, 3)
+
+	want := []struct {
+		start time.Time
+		end   time.Time
+	}{
+		{start: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), end: time.Date(2023, 3, 31, 23, 59, 59, 0, time.UTC)},
+		{start: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), end: time.Date(2023, 2, 28, 23, 59, 59, 0, time.UTC)},
+		{start: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), end: time.Date(2022, 12, 31, 23, 59, 59, 0, time.UTC)},
+	}
+	for i, month := range months {
+		require.Equal(t, want[i].start, month["start"], "month %d", month["months_ago"])
+		require.Equal(t, want[i].end, month["end"].(time.Time).Truncate(time.Second), "month %d", month["months_ago"])
+		require.Contains(t, month["paths"].([]string)[0], fmt.Sprint(want[i].start.Unix()))
+	}
+}
+
+// Test_singleMonthActivityClients_addNewClients_tokenTTL verifies that token
+// TTLs are validated, and that valid TTLs are rejected as unsupported instead
+// of being dropped
+func Test_singleMonthActivityClients_addNewClients_tokenTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *generation.Client
+		wantError string
+	}{
+		{
+			name:      "entity client",
+			client:    &generation.Client{TokenTtl: "1h"},
+			wantError: "token TTL can only be set on non-entity token clients",
+		},
+		{
+			name:      "acme client",
+			client:    &generation.Client{TokenTtl: "1h", ClientType: acmeActivityType},
+			wantError: "token TTL can only be set on non-entity token clients",
+		},
+		{
+			name:      "invalid",
+			client:    &generation.Client{TokenTtl: "soon", NonEntity: true},
+			wantError: `invalid token TTL "soon"`,
+		},
+		{
+			name:      "zero",
+			client:    &generation.Client{TokenTtl: "0s", NonEntity: true},
+			wantError: "must be positive",
+		},
+		{
+			name:      "negative",
+			client:    &generation.Client{TokenTtl: "-5m", ClientType: nonEntityTokenActivityType},
+			wantError: "must be positive",
+		},
+		{
+			name:      "valid but unsupported",
+			client:    &generation.Client{TokenTtl: "768h", NonEntity: true},
+			wantError: "unsupported field token_ttl",
+		},
+		{
+			name:      "valid seconds but unsupported",
+			client:    &generation.Client{TokenTtl: "60", NonEntity: true},
+			wantError: "unsupported field token_ttl",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &singleMonthActivityClients{}
+			err := m.addNewClients(context.Background(), tt.client, "mount", nil)
+			require.ErrorContains(t, err, tt.wantError)
+			require.Empty(t, m.clients)
+		})
+	}
+
+	m := newMultipleMonthsActivityClients(2)
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{NonEntity: true}, "mount", nil))
+	err := m.addClientToMonth(context.Background(), 0, &generation.Client{Repeated: true, NonEntity: true, TokenTtl: "1h"}, "mount", nil)
+	require.ErrorContains(t, err, "token TTL can't be set on repeated clients")
+}
+
+// failingPutStorage is in memory storage which fails to write the keys that
+// contain the given string, calling onFail first if it's set
+type failingPutStorage struct {
+	*logical.InmemStorage
+	failOn string
+	onFail func()
+}
+
+func (s *failingPutStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if strings.Contains(entry.Key, s.failOn) {
+		if s.onFail != nil {
+			s.onFail()
+		}
+		return errors.New("put failed")
+	}
+	return s.InmemStorage.Put(ctx, entry)
+}
+
+// Test_multipleMonthsActivityClients_write_checkpoints verifies that segments
+// are written with checkpoints of any size, and that when a segment can't be
+// written, the error names the segment and the segments that were already
+// written in the month and earlier months are removed
+func Test_multipleMonthsActivityClients_write_checkpoints(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	opts := map[generation.WriteOptions]struct{}{generation.WriteOptions_WRITE_ENTITIES: {}}
+	generate := func(t *testing.T) *multipleMonthsActivityClients {
+		t.Helper()
+		m := newMultipleMonthsActivityClients(3)
+		m.setWorkers(2)
+		require.NoError(t, m.addClientToMonth(context.Background(), 2, &generation.Client{Count: proto.Int32(6)}, "mount", nil))
+		require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(6)}, "mount", nil))
+		m.months[2].generationParameters = &generation.Data{NumSegments: 6}
+		m.months[1].generationParameters = &generation.Data{NumSegments: 7, SkipSegmentIndexes: []int32{2}}
+		return m
+	}
+	newActivityLog := func(t *testing.T, failOn string) (*ActivityLog, *failingPutStorage) {
+		t.Helper()
+		storage := &failingPutStorage{InmemStorage: &logical.InmemStorage{}, failOn: failOn}
+		a, err := NewActivityLog(core, core.baseLogger, NewBarrierView(storage, ""), core.metricSink)
+		require.NoError(t, err)
+		return a, storage
+	}
+
+	for _, checkpointSize := range []int{0, 1, 4, 6, 100} {
+		t.Run(fmt.Sprintf("checkpoint_size=%d", checkpointSize), func(t *testing.T) {
+			m := generate(t)
+			m.checkpointSize = checkpointSize
+			a, storage := newActivityLog(t, "none")
+			paths, err := m.write(ctx, opts, a)
+			require.NoError(t, err)
+			require.Len(t, paths, 12)
+			keys, err := logical.CollectKeys(ctx, storage)
+			require.NoError(t, err)
+			require.ElementsMatch(t, paths, keys)
+		})
+	}
+
+	// month 1 is written first, and a single worker writes the segments
+	// in order
+	m := generate(t)
+	m.checkpointSize = 2
+	m.setWorkers(1)
+	a, storage := newActivityLog(t, fmt.Sprintf("%d/5", monthTimestamp(2, m.now).Unix()))
+	_, err := m.write(ctx, opts, a)
+	require.ErrorContains(t, err, "failed to write segment 5 of month 2: put failed")
+	require.ErrorContains(t, err, "removed the 11 storage entries already written")
+	keys, err := logical.CollectKeys(ctx, storage)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+// Test_singleMonthActivityClients_populateSegments_indexRange verifies that
+// skipped and empty segment indexes must be within the number of segments,
+// including at the boundaries, and that every invalid index is listed
+func Test_singleMonthActivityClients_populateSegments_indexRange(t *testing.T) {
+	cases := []struct {
+		name       string
+		params     *generation.Data
+		predefined bool
+		wantError  string
+	}{
+		{
+			name:   "first and last index",
+			params: &generation.Data{NumSegments: 4, SkipSegmentIndexes: []int32{0}, EmptySegmentIndexes: []int32{3}},
+		},
+		{
+			name:      "index equal to num segments",
+			params:    &generation.Data{NumSegments: 4, SkipSegmentIndexes: []int32{4}},
+			wantError: "segment indexes must be between 0 and 3, invalid skip segment indexes [4]",
+		},
+		{
+			name:      "default single segment",
+			params:    &generation.Data{EmptySegmentIndexes: []int32{1}},
+			wantError: "segment indexes must be between 0 and 0, invalid empty segment indexes [1]",
+		},
+		{
+			name:      "all invalid indexes listed",
+			params:    &generation.Data{NumSegments: 4, SkipSegmentIndexes: []int32{1, 5, 9}, EmptySegmentIndexes: []int32{-1, 2, 4}},
+			wantError: "segment indexes must be between 0 and 3, invalid skip segment indexes [5 9] and empty segment indexes [-1 4]",
+		},
+		{
+			name:       "negative with predefined segments",
+			params:     &generation.Data{SkipSegmentIndexes: []int32{-2}},
+			predefined: true,
+			wantError:  "segment indexes must not be negative, invalid skip segment indexes [-2]",
+		},
+		{
+			name:      "negative with segment byte size",
+			params:    &generation.Data{SegmentByteSize: 1024, EmptySegmentIndexes: []int32{-1}},
+			wantError: "segment indexes must not be negative, invalid empty segment indexes [-1]",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &singleMonthActivityClients{predefinedSegments: make(map[int][]int), generationParameters: tc.params}
+			var segmentIndex *int
+			if tc.predefined {
+				index := 0
+				segmentIndex = &index
+			}
+			require.NoError(t, s.addNewClients(context.Background(), &generation.Client{Count: proto.Int32(4)}, "mount", segmentIndex))
+			_, err := s.populateSegments()
+			if tc.wantError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.wantError)
+		})
+	}
+}
+
+// Test_singleMonthActivityClients_addNewClients_entityRatio verifies that a
+// client with an entity ratio generates that fraction of entity clients, with
+// the rest as non-entity token clients spread between them, and that invalid
+// ratios are rejected
+func Test_singleMonthActivityClients_addNewClients_entityRatio(t *testing.T) {
+	ratio := func(r float64) *float64 { return &r }
+	tests := []struct {
+		name       string
+		client     *generation.Client
+		wantEntity []bool
+		wantError  string
+	}{
+		{
+			name:       "70 percent",
+			client:     &generation.Client{Count: proto.Int32(10), EntityRatio: ratio(0.7)},
+			wantEntity: []bool{false, true, true, false, true, true, false, true, true, true},
+		},
+		{
+			name:       "rounded",
+			client:     &generation.Client{Count: proto.Int32(3), EntityRatio: ratio(0.5)},
+			wantEntity: []bool{false, true, true},
+		},
+		{
+			name:       "no entities",
+			client:     &generation.Client{Count: proto.Int32(3), EntityRatio: ratio(0)},
+			wantEntity: []bool{false, false, false},
+		},
+		{
+			name:       "all entities",
+			client:     &generation.Client{Count: proto.Int32(3), EntityRatio: ratio(1)},
+			wantEntity: []bool{true, true, true},
+		},
+		{
+			name:      "too high",
+			client:    &generation.Client{Count: proto.Int32(3), EntityRatio: ratio(1.5)},
+			wantError: "entity ratio 1.5 must be between 0 and 1",
+		},
+		{
+			name:      "negative",
+			client:    &generation.Client{Count: proto.Int32(3), EntityRatio: ratio(-0.1)},
+			wantError: "must be between 0 and 1",
+		},
+		{
+			name:      "with client type",
+			client:    &generation.Client{Count: proto.Int32(3), EntityRatio: ratio(0.5), ClientType: acmeActivityType},
+			wantError: "can't be used with a client type or non-entity",
+		},
+		{
+			name:      "with non-entity",
+			client:    &generation.Client{Count: proto.Int32(3), EntityRatio: ratio(0.5), NonEntity: true},
+			wantError: "can't be used with a client type or non-entity",
+		},
+		{
+			name:      "with ID",
+			client:    &generation.Client{Id: "client", EntityRatio: ratio(0.5)},
+			wantError: "can't be used with a client ID",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &singleMonthActivityClients{}
+			err := m.addNewClients(context.Background(), tt.client, "mount", nil)
+			if tt.wantError != "" {
+				require.ErrorContains(t, err, tt.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, m.clients, len(tt.wantEntity))
+			for i, client := range m.clients {
+				require.Equal(t, !tt.wantEntity[i], client.NonEntity, "client %d", i)
+				if tt.wantEntity[i] {
+					require.Equal(t, entityActivityType, client.ClientType)
+				} else {
+					require.Equal(t, nonEntityTokenActivityType, client.ClientType)
+				}
+			}
+		})
+	}
+
+	m := newMultipleMonthsActivityClients(2)
+	require.NoError(t, m.addClientToMonth(context.Background(), 1, &generation.Client{Count: proto.Int32(4), EntityRatio: ratio(0.5)}, "mount", nil))
+	require.NoError(t, m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(2), Repeated: true, NonEntity: true}, "mount", nil))
+	err := m.addClientToMonth(context.Background(), 0, &generation.Client{Count: proto.Int32(2), Repeated: true, EntityRatio: ratio(0.5)}, "mount", nil)
+	require.ErrorContains(t, err, "entity ratio can't be set on repeated clients")
+}
+
+// TestSystemBackend_handleActivityWriteData_noPartialData verifies that when
+// generating one of the months fails, nothing is written for any of the months
+func TestSystemBackend_handleActivityWriteData_noPartialData(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	existingKeys, err := logical.CollectKeys(ctx, core.activityLog.view)
+	require.NoError(t, err)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES","WRITE_PRECOMPUTED_QUERIES","WRITE_INTENT_LOGS"],
+		"data":[
+			{"months_ago":0,"all":{"clients":[{"count":2}]}},
+			{"months_ago":1,"all":{"clients":[{"count":2}]}},
+			{"months_ago":2,"all":{"clients":[{"count":2}]}},
+			{"months_ago":3,"all":{"clients":[{"count":5,"repeated":true}]}},
+			{"months_ago":4,"all":{"clients":[{"count":2}]}},
+			{"months_ago":5,"all":{"clients":[{"count":2}]}}
+		]}`}
+	_, err = core.systemBackend.HandleRequest(ctx, req)
+	require.ErrorContains(t, err, "missing repeated 3 clients from month 4")
+
+	keys, err := logical.CollectKeys(ctx, core.activityLog.view)
+	require.NoError(t, err)
+	require.ElementsMatch(t, existingKeys, keys)
+}
+
+// Test_multipleMonthsActivityClients_write_rollback verifies that when writing
+// the intent log fails after the segments and precomputed queries of every
+// month are written, all of the written entries are removed, and the entries
+// that were already in storage or that were written by something else in the
+// meantime are kept
+func Test_multipleMonthsActivityClients_write_rollback(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &failingPutStorage{InmemStorage: &logical.InmemStorage{}, failOn: activityIntentLogKey}
+	storage.onFail = func() {
+		require.NoError(t, storage.InmemStorage.Put(ctx, &logical.StorageEntry{Key: "log/entity/concurrent", Value: []byte("value")}))
+	}
+	require.NoError(t, storage.Put(ctx, &logical.StorageEntry{Key: "existing", Value: []byte("value")}))
+	a, err := NewActivityLog(core, core.baseLogger, NewBarrierView(storage, ""), core.metricSink)
+	require.NoError(t, err)
+
+	m := newMultipleMonthsActivityClients(3)
+	for i := int32(1); i < 3; i++ {
+		require.NoError(t, m.addClientToMonth(context.Background(), i, &generation.Client{Count: proto.Int32(4)}, "mount", nil))
+		m.months[i].generationParameters = &generation.Data{NumSegments: 2}
+	}
+	opts := map[generation.WriteOptions]struct{}{
+		generation.WriteOptions_WRITE_ENTITIES:            {},
+		generation.WriteOptions_WRITE_PRECOMPUTED_QUERIES: {},
+		generation.WriteOptions_WRITE_INTENT_LOGS:         {},
+	}
+	_, err = m.write(ctx, opts, a)
+	require.ErrorContains(t, err, "put failed")
+	require.ErrorContains(t, err, "storage entries already written")
+	require.NotContains(t, err.Error(), "removed the 0 ")
+
+	keys, err := logical.CollectKeys(ctx, storage)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"existing", "log/entity/concurrent"}, keys)
+}
+
+// cancelAfterContext is a context which is cancelled once Err has been called
+// the given number of times
+type cancelAfterContext struct {
+	context.Context
+	cancel context.CancelFunc
+	after  int
+
+	l     sync.Mutex
+	calls int
+}
+
+func (c *cancelAfterContext) Err() error {
+	c.l.Lock()
+	c.calls++
+	if c.calls > c.after {
+		c.cancel()
+	}
+	c.l.Unlock()
+	return c.Context.Err()
+}
+
+// TestSystemBackend_handleActivityWriteData_cancelled verifies that
+// generation stops once the request's context is cancelled, and that nothing
+// is written
+func TestSystemBackend_handleActivityWriteData_cancelled(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	existingKeys, err := logical.CollectKeys(namespace.RootContext(nil), core.activityLog.view)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(namespace.RootContext(nil))
+	defer cancel()
+	cancelCtx := &cancelAfterContext{Context: ctx, cancel: cancel, after: 1000}
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{
+		"write":["WRITE_ENTITIES"],
+		"data":[
+			{"months_ago":1,"all":{"clients":[{"count":100000}]}},
+			{"months_ago":2,"all":{"clients":[{"count":100000}]}}
+		]}`}
+	_, err = core.systemBackend.HandleRequest(cancelCtx, req)
+	require.ErrorIs(t, err, context.Canceled)
+	// generation stopped soon after the cancellation
+	require.Less(t, cancelCtx.calls, 1100)
+
+	keys, err := logical.CollectKeys(namespace.RootContext(nil), core.activityLog.view)
+	require.NoError(t, err)
+	require.ElementsMatch(t, existingKeys, keys)
+}
+
+// cancellingPutStorage is in memory storage which cancels a context on the
+// first write, and counts the writes
+type cancellingPutStorage struct {
+	*logical.InmemStorage
+	cancel context.CancelFunc
+	puts   int
+}
+
+func (s *cancellingPutStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	s.puts++
+	defer s.cancel()
+	return s.InmemStorage.Put(ctx, entry)
+}
+
+// Test_multipleMonthsActivityClients_write_cancelled verifies that once the
+// context is cancelled during a write, no more segments are written and the
+// segments that were written are removed
+func Test_multipleMonthsActivityClients_write_cancelled(t *testing.T) {
+	core, _, _ := TestCoreUnsealed(t)
+	ctx, cancel := context.WithCancel(namespace.RootContext(nil))
+	defer cancel()
+	storage := &cancellingPutStorage{InmemStorage: &logical.InmemStorage{}}
+	a, err := NewActivityLog(core, core.baseLogger, NewBarrierView(storage, ""), core.metricSink)
+	require.NoError(t, err)
+	storage.cancel = cancel
+
+	m := newMultipleMonthsActivityClients(2)
+	m.setWorkers(1)
+	m.checkpointSize = 1
+	require.NoError(t, m.addClientToMonth(ctx, 1, &generation.Client{Count: proto.Int32(10)}, "mount", nil))
+	m.months[1].generationParameters = &generation.Data{NumSegments: 5}
+
+	_, err = m.write(ctx, map[generation.WriteOptions]struct{}{generation.WriteOptions_WRITE_ENTITIES: {}}, a)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorContains(t, err, "removed the 1 storage entries already written")
+	require.Equal(t, 1, storage.puts)
+	keys, err := logical.CollectKeys(context.Background(), storage)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+// TestSystemBackend_handleActivityWriteData_validation verifies that every
+// problem with the input is returned in one error response, before any clients
+// are generated
+func TestSystemBackend_handleActivityWriteData_validation(t *testing.T) {
+	b := testSystemBackend(t)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{"write":["WRITE_DIRECT_TOKENS"],"workers":-1,"storage_prefix":"../other","data":[
+		{"months_ago":-1,"all":{"clients":[{"count":1}]}},
+		{"months_ago":1,"num_segments":-2,"segment_capacities":{"3":-4},"all":{"clients":[{"count":-3},{"count":0},{"count":1,"entity_ratio":1.5,"namespace":"missing_ns"}]}}
+	]}`}
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	for _, want := range []string{
+		"unsupported write option WRITE_DIRECT_TOKENS",
+		"invalid \"workers\" value -1: must not be negative",
+		"invalid \"storage_prefix\"",
+		"invalid \"months_ago\" value -1: must not be negative",
+		"month 1: invalid \"num_segments\" value -2: must not be negative",
+		"month 1: invalid \"segment_capacities\" value -4 for segment 3: must not be negative",
+		"month 1: invalid client count -3: must not be negative",
+		"month 1: invalid client count 0: must be positive, leave count out for one client",
+		"month 1: entity ratio 1.5 must be between 0 and 1",
+		"month 1: namespace missing_ns does not exist",
+	} {
+		require.ErrorContains(t, resp.Error(), want)
+	}
+
+	req.Data = map[string]interface{}{"input": `{"data":[]}`}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	require.ErrorContains(t, resp.Error(), "missing required \"write\" values")
+	require.ErrorContains(t, resp.Error(), "missing required \"data\" values")
+}
+
+// TestSystemBackend_handleActivityWriteData_returnOutput verifies that with
+// the "return" output the serialized segments are returned by month and segment
+// index, that nothing is written to storage, and that the returned segments can
+// be loaded into another activity log
+func TestSystemBackend_handleActivityWriteData_returnOutput(t *testing.T) {
+	core, _, _ := TestCoreUnsealedWithConfig(t, &CoreConfig{
+		ActivityLogConfig: ActivityLogCoreConfig{
+			DisableTimers: true,
+			ForceEnable:   true,
+		},
+	})
+	ctx := namespace.RootContext(nil)
+	req := logical.TestRequest(t, logical.CreateOperation, "internal/counters/activity/write")
+	req.Data = map[string]interface{}{"input": `{"write":["WRITE_ENTITIES"],"output":"return","data":[
+		{"months_ago":1,"num_segments":2,"all":{"clients":[{"count":4}]}},
+		{"months_ago":2,"all":{"clients":[{"count":3}]}}
+	]}`}
+	resp, err := core.systemBackend.HandleRequest(ctx, req)
+	require.NoError(t, err)
+	segments := resp.Data["segments"].(map[int]map[int]string)
+	require.Len(t, segments, 2)
+	require.Len(t, segments[1], 2)
+	require.Len(t, segments[2], 1)
+
+	times, err := core.activityLog.availableLogs(ctx)
+	require.NoError(t, err)
+	require.Empty(t, times)
+
+	now := timeutil.StartOfMonth(core.activityLog.clock.Now().UTC())
+	numClients := make(map[int]int)
+	for monthsAgo, monthSegments := range segments {
+		for segmentIndex, encoded := range monthSegments {
+			b, err := base64.StdEncoding.DecodeString(encoded)
+			require.NoError(t, err)
+			clients := &activity.EntityActivityLog{}
+			require.NoError(t, proto.Unmarshal(b, clients))
+			numClients[monthsAgo] += len(clients.Clients)
+
+			path := fmt.Sprintf("%s%d/%d", activityEntityBasePath, monthTimestamp(monthsAgo, now).Unix(), segmentIndex)
+			require.NoError(t, core.activityLog.view.Put(ctx, &logical.StorageEntry{Key: path, Value: b}))
+		}
+	}
+	require.Equal(t, map[int]int{1: 4, 2: 3}, numClients)
+	times, err = core.activityLog.availableLogs(ctx)
+	require.NoError(t, err)
+	require.Len(t, times, 2)
+
+	req.Data["dry_run"] = true
+	_, err = core.systemBackend.HandleRequest(ctx, req)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+
+	req.Data = map[string]interface{}{"input": `{"write":["WRITE_ENTITIES"],"output":"print","data":[{"current_month":true,"all":{"clients":[{"count":1}]}}]}`}
+	resp, err = core.systemBackend.HandleRequest(ctx, req)
+	require.Equal(t, logical.ErrInvalidRequest, err)
+	require.ErrorContains(t, resp.Error(), "unsupported output \"print\"")
+}